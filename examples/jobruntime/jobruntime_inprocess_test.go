@@ -0,0 +1,46 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+	. "github.com/dgruber/jsv/test/jsvtesting"
+)
+
+// The verification function runs in the test process, which needs no
+// binary and reports the coverage of jobruntime.go.
+var _ = Describe("Jobruntime in-process", func() {
+	var server *jsvserver.JSVTestServer
+
+	BeforeEach(func() {
+		var err error
+		server, err = jsvserver.NewInProcessJSVTestServer(true, jsvVerificationFunction, jsvOnStartFunction)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(server.Stop()).To(Succeed())
+	})
+
+	It("should accept jobs without long.q", func() {
+		result, err := server.SendJob(NewJob().Build())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(BeAccepted())
+		Expect(result.Message).To(Equal("No long.q job"))
+	})
+
+	It("should reject a long.q job with an invalid runtime limit", func() {
+		result, err := server.SendJob(NewJob().Queue("long.q").HardResource("h_rt", "1:00:00").Build())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(BeRejectedWith("Unexpected runtime limit: 1:00:00"))
+	})
+
+	It("should increase the runtime limit to 10 minutes", func() {
+		result, err := server.SendJob(NewJob().Queue("long.q").HardResource("h_rt", "60").Build())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result).To(BeCorrected())
+		Expect(result).To(HaveSubParam("l_hard", "h_rt", "600"))
+	})
+})
@@ -7,6 +7,7 @@ import (
 	"os/exec"
 
 	"github.com/dgruber/jsv/test/jsvserver"
+	. "github.com/dgruber/jsv/test/jsvtesting"
 )
 
 var binaryName = "./jobruntime_test"
@@ -50,8 +51,7 @@ var _ = Describe("Jobruntime", func() {
 				},
 			})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(result.State).To(Equal("REJECT"))
-			Expect(result.Message).To(ContainSubstring("No hard runtime limit requested (h_rt)"))
+			Expect(result).To(BeRejectedWith("No hard runtime limit requested (h_rt)"))
 		})
 
 		It("should accept the job since a hard runtime limit is requested", func() {
@@ -65,7 +65,7 @@ var _ = Describe("Jobruntime", func() {
 				},
 			})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(result.State).To(Equal("ACCEPT"))
+			Expect(result).To(BeAccepted())
 		})
 
 		It("should modify the runtime limit to 10 minutes", func() {
@@ -79,9 +79,9 @@ var _ = Describe("Jobruntime", func() {
 				},
 			})
 			Expect(err).ToNot(HaveOccurred())
-			Expect(result.State).To(Equal("CORRECT"))
+			Expect(result).To(BeCorrected())
 			Expect(result.Message).To(ContainSubstring("Runtime limit was increased to 10 minutes"))
-			Expect(result.ModifiedParams["l_hard"]).To(Equal("h_rt=600"))
+			Expect(result).To(HaveModifiedParam("l_hard", "h_rt=600"))
 		})
 
 	})
@@ -0,0 +1,126 @@
+package jobscript
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/maintenance"
+)
+
+// Conflict is an embedded option which differs from the parameter
+// Grid Engine sent to the JSV. The command line options of qsub
+// override the embedded options, hence a conflict means that the
+// option was overridden on the command line.
+type Conflict struct {
+	// Directive is the embedded option.
+	Directive Directive
+	// Param is the JSV parameter, like "N" or "l_hard".
+	Param string
+	// Embedded is the value of the embedded option.
+	Embedded string
+	// Submitted is the value of the JSV parameter.
+	Submitted string
+}
+
+// simpleOptions maps qsub options with a single argument to the
+// JSV parameter with the same value.
+var simpleOptions = map[string]string{
+	"A": "A", "ar": "ar", "ckpt": "ckpt",
+	"e": "e", "i": "i", "j": "j", "js": "js", "M": "M", "m": "m",
+	"N": "N", "now": "now", "o": "o", "P": "P", "p": "p", "R": "R",
+	"r": "r", "S": "S", "shell": "shell", "w": "w", "wd": "wd",
+}
+
+// Conflicts compares the embedded options with the parameters of the
+// currently processed job. Date times (-a, -dl) are compared after
+// parsing, resource requests without value match the boolean true.
+func (s *Script) Conflicts() []Conflict {
+	var conflicts []Conflict
+	isSoft := false
+	for _, d := range s.Directives {
+		switch d.Option {
+		case "hard":
+			isSoft = false
+		case "soft":
+			isSoft = true
+		case "l":
+			param := "l_hard"
+			if isSoft {
+				param = "l_soft"
+			}
+			for _, arg := range d.Args {
+				for _, request := range strings.Split(arg, ",") {
+					name, value, _ := strings.Cut(request, "=")
+					submitted, exists := jsv.SubGetParam(param, name)
+					if !exists || requestValue(submitted) != requestValue(value) {
+						conflicts = append(conflicts, Conflict{
+							Directive: d,
+							Param:     param + ":" + name,
+							Embedded:  value,
+							Submitted: submitted,
+						})
+					}
+				}
+			}
+		case "q":
+			param := "q_hard"
+			if isSoft {
+				param = "q_soft"
+			}
+			conflicts = append(conflicts, compare(d, param, strings.Join(d.Args, ","))...)
+		case "pe":
+			if len(d.Args) > 0 {
+				conflicts = append(conflicts, compare(d, "pe_name", d.Args[0])...)
+			}
+		case "a", "dl":
+			conflicts = append(conflicts, compareDateTime(d, strings.Join(d.Args, " "))...)
+		default:
+			if param, exists := simpleOptions[d.Option]; exists {
+				conflicts = append(conflicts, compare(d, param, strings.Join(d.Args, " "))...)
+			}
+		}
+	}
+	return conflicts
+}
+
+func compare(d Directive, param, embedded string) []Conflict {
+	submitted, _ := jsv.GetParam(param)
+	if submitted == embedded {
+		return nil
+	}
+	return []Conflict{{
+		Directive: d,
+		Param:     param,
+		Embedded:  embedded,
+		Submitted: submitted,
+	}}
+}
+
+// compareDateTime compares a date time option (-a, -dl) after parsing,
+// as Grid Engine sends it with century and seconds.
+func compareDateTime(d Directive, embedded string) []Conflict {
+	submitted, _ := jsv.GetParam(d.Option)
+	now := time.Now()
+	embeddedTime, err := maintenance.ParseDateTime(embedded, now)
+	if err == nil {
+		submittedTime, err := maintenance.ParseDateTime(submitted, now)
+		if err == nil && submittedTime.Equal(embeddedTime) {
+			return nil
+		}
+	}
+	return compare(d, d.Option, embedded)
+}
+
+// requestValue normalizes the value of a resource request. A request
+// without value (like "-l exclusive") is a boolean request for true,
+// boolean values are compared case-insensitively.
+func requestValue(value string) string {
+	switch strings.ToLower(value) {
+	case "", "true":
+		return "true"
+	case "false":
+		return "false"
+	}
+	return value
+}
@@ -0,0 +1,294 @@
+// Package jobscript inspects the job script of a submitted job.
+//
+// Grid Engine allows to embed submission options in the job script
+// in lines starting with the directive prefix ("#$" by default, it can
+// be changed with qsub -C):
+//
+//	#!/bin/bash
+//	#$ -l h_rt=3600
+//	#$ -N myjob
+//
+// The path of the job script is sent as SCRIPT pseudo-parameter to
+// the JSV. Inspect() reads the script of the currently processed job
+// and returns the embedded directives and the interpreter.
+package jobscript
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dgruber/jsv"
+)
+
+// DefaultPrefix is the default directive prefix of Grid Engine.
+const DefaultPrefix = "#$"
+
+// DefaultMaxSize is the default maximum size of a job script which
+// is read.
+const DefaultMaxSize = 1 << 20
+
+// ErrNoScript is returned when the job has no script, like binary
+// jobs (qsub -b y) or jobs where the script was sent over stdin.
+var ErrNoScript = errors.New("job has no script file")
+
+// ErrTooLarge is returned when the script exceeds the maximum size.
+var ErrTooLarge = errors.New("job script exceeds size limit")
+
+// Directive is an option embedded in the job script.
+type Directive struct {
+	// Line is the line number in the script (starting with 1).
+	Line int
+	// Option is the option name without leading dash, like "l".
+	Option string
+	// Args are the arguments of the option.
+	Args []string
+}
+
+// Script is the result of the inspection of a job script.
+type Script struct {
+	// Path is the path of the job script.
+	Path string
+	// Interpreter is the interpreter from the shebang line, like
+	// "/bin/bash". It is empty when the script has no shebang.
+	Interpreter string
+	// InterpreterArgs are the arguments of the interpreter in the
+	// shebang line.
+	InterpreterArgs []string
+	// Prefix is the directive prefix which was used.
+	Prefix string
+	// Directives are the embedded options in order of appearance.
+	Directives []Directive
+}
+
+// Path returns the path of the job script of the currently processed
+// job. It is taken from the SCRIPT pseudo-parameter (or CMDNAME when
+// SCRIPT is not sent). ErrNoScript is returned for binary jobs.
+func Path() (string, error) {
+	if binary, _ := jsv.GetParam("b"); binary == "y" {
+		return "", ErrNoScript
+	}
+	path, exists := jsv.GetParam("SCRIPT")
+	if !exists || path == "" {
+		path, exists = jsv.GetParam("CMDNAME")
+	}
+	if !exists || path == "" || path == "NONE" {
+		return "", ErrNoScript
+	}
+	return path, nil
+}
+
+// Inspect reads the job script of the currently processed job. The
+// path is returned by Path() and the directive prefix is taken from
+// the C parameter (qsub -C). Scripts which are larger than maxSize
+// bytes are not read (ErrTooLarge).
+func Inspect(maxSize int64) (*Script, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	prefix := DefaultPrefix
+	if c, exists := jsv.GetParam("C"); exists {
+		prefix = c
+	}
+	return Read(path, prefix, maxSize)
+}
+
+// Open opens the job script at the given path for reading. When
+// maxSize is greater than 0, scripts which are larger are not
+// opened (ErrTooLarge) and at most maxSize bytes are read.
+func Open(path string, maxSize int64) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job script: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat job script: %w", err)
+	}
+	if maxSize <= 0 {
+		return f, nil
+	}
+	if info.Size() > maxSize {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s has %d bytes", ErrTooLarge, path, info.Size())
+	}
+	// the script could grow while reading it
+	return limitedFile{Reader: io.LimitReader(f, maxSize), Closer: f}, nil
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
+// Read reads and parses the job script at the given path.
+func Read(path string, prefix string, maxSize int64) (*Script, error) {
+	f, err := Open(path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	script, err := Parse(f, prefix)
+	if err != nil {
+		return nil, err
+	}
+	script.Path = path
+	return script, nil
+}
+
+// Parse parses a job script. An empty prefix disables the parsing of
+// directives (qsub -C with an empty string).
+func Parse(r io.Reader, prefix string) (*Script, error) {
+	script := &Script{Prefix: prefix}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), DefaultMaxSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if lineNumber == 1 && strings.HasPrefix(line, "#!") {
+			fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+			if len(fields) > 0 {
+				script.Interpreter = fields[0]
+				script.InterpreterArgs = fields[1:]
+			}
+			continue
+		}
+
+		if prefix == "" || !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		args, err := SplitArgs(strings.TrimPrefix(line, prefix))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		script.Directives = append(script.Directives, groupOptions(lineNumber, args)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job script: %w", err)
+	}
+	return script, nil
+}
+
+// groupOptions groups a list of arguments into options with their
+// arguments.
+func groupOptions(line int, args []string) []Directive {
+	var directives []Directive
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			directives = append(directives, Directive{
+				Line:   line,
+				Option: strings.TrimPrefix(arg, "-"),
+			})
+			continue
+		}
+		if len(directives) == 0 {
+			// argument without option, like the job arguments
+			directives = append(directives, Directive{Line: line})
+		}
+		last := &directives[len(directives)-1]
+		last.Args = append(last.Args, arg)
+	}
+	return directives
+}
+
+// Get returns the arguments of the last occurrence of the option.
+func (s *Script) Get(option string) ([]string, bool) {
+	for i := len(s.Directives) - 1; i >= 0; i-- {
+		if s.Directives[i].Option == option {
+			return s.Directives[i].Args, true
+		}
+	}
+	return nil, false
+}
+
+// Has returns true when the option is embedded in the script.
+func (s *Script) Has(option string) bool {
+	_, exists := s.Get(option)
+	return exists
+}
+
+// Resources returns the resource requests (-l) of the script. When
+// soft is true the soft requests (after -soft) are returned,
+// otherwise the hard requests.
+func (s *Script) Resources(soft bool) map[string]string {
+	resources := make(map[string]string)
+	isSoft := false
+	for _, d := range s.Directives {
+		switch d.Option {
+		case "hard":
+			isSoft = false
+		case "soft":
+			isSoft = true
+		case "l":
+			if isSoft != soft {
+				continue
+			}
+			for _, arg := range d.Args {
+				for _, request := range strings.Split(arg, ",") {
+					name, value, _ := strings.Cut(request, "=")
+					if name != "" {
+						resources[name] = value
+					}
+				}
+			}
+		}
+	}
+	return resources
+}
+
+// SplitArgs splits a directive line into arguments like a shell
+// does. Single and double quotes group arguments, a backslash
+// escapes the next character.
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case c == '#' && !inArg:
+			// rest of the line is a comment
+			return args, nil
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
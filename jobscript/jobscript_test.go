@@ -0,0 +1,170 @@
+package jobscript_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/jobscript"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+const script = `#!/bin/bash -l
+#$ -l h_rt=3600,mem_free=2G
+#$ -N "my job" -j y
+#$ -soft -l arch=lx-amd64 # comment
+#% -q other.q
+echo hello
+#$ -pe mpi 4
+`
+
+func init() {
+	// conflicts accepts the jobs with the conflicts between the job
+	// and the script of the configuration as message
+	jsvs["conflicts"] = func() {
+		var content string
+		readConfig(&content)
+		jsv.Run(false, func() {
+			s, err := jobscript.Parse(strings.NewReader(content), jobscript.DefaultPrefix)
+			if err != nil {
+				jsv.Reject(err.Error())
+				return
+			}
+			data, err := json.Marshal(s.Conflicts())
+			if err != nil {
+				jsv.Reject(err.Error())
+				return
+			}
+			jsv.Accept(string(data))
+		}, nil)
+	}
+}
+
+var _ = Describe("Jobscript", func() {
+
+	It("should parse the shebang and the directives", func() {
+		s, err := jobscript.Parse(strings.NewReader(script), jobscript.DefaultPrefix)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Interpreter).To(Equal("/bin/bash"))
+		Expect(s.InterpreterArgs).To(Equal([]string{"-l"}))
+		Expect(s.Directives).To(HaveLen(6))
+		Expect(s.Directives[1]).To(Equal(jobscript.Directive{Line: 3, Option: "N", Args: []string{"my job"}}))
+
+		args, exists := s.Get("pe")
+		Expect(exists).To(BeTrue())
+		Expect(args).To(Equal([]string{"mpi", "4"}))
+		Expect(s.Has("q")).To(BeFalse())
+
+		Expect(s.Resources(false)).To(Equal(map[string]string{"h_rt": "3600", "mem_free": "2G"}))
+		Expect(s.Resources(true)).To(Equal(map[string]string{"arch": "lx-amd64"}))
+	})
+
+	It("should honour a custom directive prefix", func() {
+		s, err := jobscript.Parse(strings.NewReader(script), "#%")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Directives).To(HaveLen(1))
+		Expect(s.Directives[0].Option).To(Equal("q"))
+	})
+
+	It("should not parse directives with an empty prefix", func() {
+		s, err := jobscript.Parse(strings.NewReader(script), "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Directives).To(BeEmpty())
+	})
+
+	It("should not read scripts exceeding the size limit", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "job.sh")
+		Expect(os.WriteFile(path, []byte(script), 0644)).To(Succeed())
+		_, err := jobscript.Read(path, jobscript.DefaultPrefix, 10)
+		Expect(errors.Is(err, jobscript.ErrTooLarge)).To(BeTrue())
+		s, err := jobscript.Read(path, jobscript.DefaultPrefix, jobscript.DefaultMaxSize)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Path).To(Equal(path))
+	})
+
+	Context("conflicts", func() {
+
+		// submitted is the job as Grid Engine sends it when the script
+		// was submitted without command line options
+		submitted := func() *jsvserver.JobSpec {
+			return &jsvserver.JobSpec{
+				Client:  "qsub",
+				CmdName: "job.sh",
+				Params: map[string]string{
+					"l_hard":  "h_rt=3600,mem_free=2G",
+					"l_soft":  "arch=lx-amd64",
+					"N":       "my job",
+					"j":       "y",
+					"pe_name": "mpi",
+					"pe_min":  "4",
+					"pe_max":  "4",
+				},
+			}
+		}
+
+		conflicts := func(script string, job *jsvserver.JobSpec) []jobscript.Conflict {
+			result := verify("conflicts", script, job)
+			Expect(result.State).To(Equal("ACCEPT"))
+			var conflicts []jobscript.Conflict
+			Expect(json.Unmarshal([]byte(result.Message), &conflicts)).To(Succeed())
+			return conflicts
+		}
+
+		It("should not report conflicts when the options were not overridden", func() {
+			Expect(conflicts(script, submitted())).To(BeEmpty())
+		})
+
+		It("should report the options which were overridden on the command line", func() {
+			job := submitted()
+			job.Params["l_hard"] = "h_rt=600,mem_free=2G"
+			job.Params["N"] = "other"
+			Expect(conflicts(script, job)).To(Equal([]jobscript.Conflict{
+				{
+					Directive: jobscript.Directive{Line: 2, Option: "l", Args: []string{"h_rt=3600,mem_free=2G"}},
+					Param:     "l_hard:h_rt",
+					Embedded:  "3600",
+					Submitted: "600",
+				},
+				{
+					Directive: jobscript.Directive{Line: 3, Option: "N", Args: []string{"my job"}},
+					Param:     "N",
+					Embedded:  "my job",
+					Submitted: "other",
+				},
+			}))
+		})
+
+		It("should compare date times and boolean requests by their values", func() {
+			const dates = `#!/bin/sh
+#$ -a 2403011600 -dl 202403021600.30
+#$ -l exclusive,gpu=TRUE
+`
+			job := &jsvserver.JobSpec{
+				Client:  "qsub",
+				CmdName: "job.sh",
+				Params: map[string]string{
+					"a":      "202403011600.00",
+					"dl":     "202403021600.30",
+					"l_hard": "exclusive=true,gpu=true",
+				},
+			}
+			Expect(conflicts(dates, job)).To(BeEmpty())
+
+			job.Params["a"] = "202403011700.00"
+			job.Params["l_hard"] = "exclusive=false,gpu=true"
+			found := conflicts(dates, job)
+			Expect(found).To(HaveLen(2))
+			Expect(found[0].Param).To(Equal("a"))
+			Expect(found[0].Embedded).To(Equal("2403011600"))
+			Expect(found[0].Submitted).To(Equal("202403011700.00"))
+			Expect(found[1].Param).To(Equal("l_hard:exclusive"))
+			Expect(found[1].Submitted).To(Equal("false"))
+		})
+	})
+})
@@ -34,8 +34,10 @@ package jsv
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 )
 
 // State represents the internal state within the JSV
@@ -65,6 +67,17 @@ var LoggingEnabled = false
 // for logging when LoggingEnabled is set to true.
 var Logfile = "/tmp/jsv_logfile.log"
 
+// OnResult is called after the RESULT of a job verification was sent
+// to Grid Engine. The state is one of ACCEPT, CORRECT, REJECT, or
+// REJECT_WAIT. It can be used for collecting statistics about the
+// decisions of the JSV. The job parameters can still be accessed
+// with GetParam() during the call.
+var OnResult func(state string, message string)
+
+// OnProtocolError is called when the JSV sends an ERROR to Grid
+// Engine because of an unexpected command or state.
+var OnProtocolError func(message string)
+
 // Available parameters:
 // var jsv_cli_params = "a ar A b ckpt cwd C display dl e hard h hold_jid hold_jid_ad i inherit j jc js m M masterq notify now N noshell nostdin o ot P p pty R r shell sync S t tc terse u w wd"
 // var jsv_mod_params = "ac l_hard l_soft masterl q_hard q_soft pe_min pe_max pe_name binding_strategy binding_type binding_amount binding_socket binding_core binding_step binding_exp_n"
@@ -96,7 +109,7 @@ func handleStartCommand(checkEnvironment bool, jsvOnStartFunction func()) {
 		sendCommand("STARTED")
 		state = started
 	} else {
-		sendCommand("ERROR JSV script got START command bit is in state ...")
+		sendError("JSV script got START command bit is in state ...")
 	}
 }
 
@@ -113,7 +126,7 @@ func handleBeginCommand(verificationCommand func()) {
 		commandList = make(map[string]string)
 		environmentList = make(map[string]string)
 	} else {
-		sendCommand("ERROR JSV script got BEGIN command but is in state ...")
+		sendError("JSV script got BEGIN command but is in state ...")
 	}
 }
 
@@ -126,6 +139,30 @@ func scriptLog(param string, param2 string) {
 	}
 }
 
+// sendError sends an ERROR command and reports it to the
+// OnProtocolError function when set.
+func sendError(message string) {
+	sendCommand("ERROR " + message)
+	if OnProtocolError != nil {
+		OnProtocolError(message)
+	}
+}
+
+// sendResult sends the RESULT of the verification to Grid Engine
+// when the JSV is in verifying state. In any other state the error is
+// "jsv_correct() called in wrong state" for all results.
+func sendResult(result string, args string) {
+	if state != verifying {
+		sendError("jsv_correct() called in wrong state")
+		return
+	}
+	sendCommand("RESULT STATE " + result + " " + args)
+	state = initialized
+	if OnResult != nil {
+		OnResult(result, args)
+	}
+}
+
 // sendCommand sends the given parameter (command) to STDOUT.
 func sendCommand(param string) {
 	/* echo $@ */
@@ -146,7 +183,7 @@ func handleEnvCommand(line string) {
 			}
 		}
 	} else {
-		sendCommand("ERROR JSV script got ENV command but is not in state STARTED")
+		sendError("JSV script got ENV command but is not in state STARTED")
 	}
 }
 
@@ -208,10 +245,10 @@ func handleParamCommand(line string) {
 		} else if len(tokens) == 2 {
 			commandList[tokens[1]] = ""
 		} else {
-			sendCommand("ERROR PARAM without any argument: " + line)
+			sendError("PARAM without any argument: " + line)
 		}
 	} else {
-		sendCommand("ERROR JSV script got PARAM command but is not in STARTED state")
+		sendError("JSV script got PARAM command but is not in STARTED state")
 	}
 }
 
@@ -309,7 +346,7 @@ func Run(checkEnvironment bool, verificationFunction func(), onStartFunction fun
 			}
 
 			/* ERROR JSV script got unknown command ... */
-			sendCommand("ERROR JSV script got unknown command xy")
+			sendError("JSV script got unknown command xy")
 			abort = true
 		} else {
 			/* buffer should always be big enough, we treat it like an input error */
@@ -318,6 +355,28 @@ func Run(checkEnvironment bool, verificationFunction func(), onStartFunction fun
 	}
 }
 
+// runMu serializes RunWithIO, the JSV state is global.
+var runMu sync.Mutex
+
+// RunWithIO is Run with the protocol on the given reader and writer
+// instead of stdin and stdout. The JSV starts in its initial state.
+// It is used to test verification functions in the test process; as
+// the JSV state is global, concurrent calls wait for each other.
+func RunWithIO(input io.Reader, output io.Writer, checkEnvironment bool, verificationFunction func(), onStartFunction func()) {
+	runMu.Lock()
+	defer runMu.Unlock()
+	in = bufio.NewReader(input)
+	out = bufio.NewWriter(output)
+	defer func() {
+		in = bufio.NewReader(os.Stdin)
+		out = bufio.NewWriter(os.Stdout)
+	}()
+	state = initialized
+	commandList = make(map[string]string)
+	environmentList = make(map[string]string)
+	Run(checkEnvironment, verificationFunction, onStartFunction)
+}
+
 // IsParam checks if the given parameter is requested by the job.
 func IsParam(param string) bool {
 	_, exists := GetParam(param)
@@ -477,12 +536,7 @@ func ListEnvs() {
 // Correct must be called in the JSV function when the job was modified
 // and corrected. Currently it the same like jsv_accept().
 func Correct(args string) {
-	if state == verifying {
-		sendCommand("RESULT STATE CORRECT " + args)
-		state = initialized
-	} else {
-		sendCommand("ERROR jsv_correct() called in wrong state")
-	}
+	sendResult("CORRECT", args)
 }
 
 // Accept must be called in the JSV function when the job is accepted.
@@ -490,24 +544,14 @@ func Correct(args string) {
 // the job was modified.
 // Currently both have the same semantic only Java JSV differs in that.
 func Accept(args string) {
-	if state == verifying {
-		sendCommand("RESULT STATE ACCEPT " + args)
-		state = initialized
-	} else {
-		sendCommand("ERROR jsv_correct() called in wrong state")
-	}
+	sendResult("ACCEPT", args)
 }
 
 // Reject rejects a job. That means the job is not added
 // to the qmasters job list. The argument specifies the
 // reject message.
 func Reject(args string) {
-	if state == verifying {
-		sendCommand("RESULT STATE REJECT " + args)
-		state = initialized
-	} else {
-		sendCommand("ERROR jsv_correct() called in wrong state")
-	}
+	sendResult("REJECT", args)
 }
 
 // RejectWait rejects a job due to a temporary reason.
@@ -515,12 +559,7 @@ func Reject(args string) {
 // of a temporary reason. The only difference to jsv_reject() is
 // that a different message is logged by Grid Engine.
 func RejectWait(args string) {
-	if state == verifying {
-		sendCommand("RESULT STATE REJECT_WAIT " + args)
-		state = initialized
-	} else {
-		sendCommand("ERROR jsv_correct() called in wrong state")
-	}
+	sendResult("REJECT_WAIT", args)
 }
 
 // SendEnv can be called in the jsv_on_start function in order
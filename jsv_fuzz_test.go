@@ -0,0 +1,124 @@
+package jsv
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// reset puts the JSV into the state before the first line and returns
+// the buffer with its output.
+func reset(input []byte, s State) *bytes.Buffer {
+	var output bytes.Buffer
+	in = bufio.NewReader(bytes.NewReader(input))
+	out = bufio.NewWriter(&output)
+	state = s
+	commandList = make(map[string]string)
+	environmentList = make(map[string]string)
+	return &output
+}
+
+func FuzzHandleParamCommand(f *testing.F) {
+	f.Add("N", "job")
+	f.Add("l_hard", "h_rt=60,mem=1G")
+	f.Add("l_hard", "{~}h_rt=60,{}mem=1G")
+	f.Add("l_soft", "a{=b,=,{}")
+	f.Add("CMDARG0", "")
+	f.Add("", " ")
+	f.Fuzz(func(t *testing.T, name, value string) {
+		output := reset(nil, started)
+		handleParamCommand("PARAM " + name + " " + value)
+		if output.Len() > 0 {
+			t.Fatalf("unexpected output %q", output.String())
+		}
+		if strings.Contains(name, " ") || name == "l_hard" || name == "l_soft" {
+			return
+		}
+		if got, exists := GetParam(name); !exists || got != value {
+			t.Fatalf("PARAM %q %q stored as %q (%v)", name, value, got, exists)
+		}
+	})
+}
+
+func FuzzHandleEnvCommand(f *testing.F) {
+	f.Add("ADD", "PATH", "/bin:/usr/bin")
+	f.Add("ADD", "EMPTY", "")
+	f.Add("MOD", "PATH", "/bin")
+	f.Add("DEL", "PATH", "")
+	f.Add("", "", "")
+	f.Fuzz(func(t *testing.T, operation, name, value string) {
+		output := reset(nil, started)
+		handleEnvCommand("ENV " + operation + " " + name + " " + value)
+		if output.Len() > 0 {
+			t.Fatalf("unexpected output %q", output.String())
+		}
+		if operation != "ADD" || strings.Contains(name, " ") {
+			return
+		}
+		if got, exists := GetEnv(name); !exists || got != value {
+			t.Fatalf("ENV ADD %q %q stored as %q (%v)", name, value, got, exists)
+		}
+	})
+}
+
+func FuzzFilterJobClassSpec(f *testing.F) {
+	f.Add("h_rt")
+	f.Add("{~}h_rt")
+	f.Add("h_{x}rt")
+	f.Add("}a{")
+	f.Add("{{}}")
+	f.Fuzz(func(t *testing.T, unfiltered string) {
+		// the filter works on runes, invalid UTF-8 is not sent by qmaster
+		if !utf8.ValidString(unfiltered) {
+			return
+		}
+		filtered := filterJobClassSpec(unfiltered)
+		expected := unfiltered
+		first, last := strings.Index(unfiltered, "{"), strings.LastIndex(unfiltered, "}")
+		if first >= 0 && last > first {
+			expected = unfiltered[:first] + unfiltered[last+1:]
+		}
+		if filtered != expected {
+			t.Fatalf("filtered %q into %q, expected %q", unfiltered, filtered, expected)
+		}
+	})
+}
+
+func FuzzRun(f *testing.F) {
+	f.Add([]byte("START\nPARAM N job\nENV ADD PATH /bin\nBEGIN\nQUIT\n"))
+	f.Add([]byte("PARAM N early\nSTART\nBEGIN\nBEGIN\n"))
+	f.Add([]byte("START\nSTART\nSHOW\nPARAM\nENV\nBEGIN\n"))
+	f.Add([]byte("START\r\nFOO\nBEGIN\n"))
+	f.Add([]byte("START\nPARAM N " + strings.Repeat("x", 8192) + "\nBEGIN\n"))
+	f.Add([]byte{0, 0xff, '\n', 'S', 'T', 'A', 'R', 'T'})
+	f.Fuzz(func(t *testing.T, input []byte) {
+		output := reset(input, initialized)
+		Run(false, func() { Accept("") }, nil)
+
+		begins := 0
+		for _, line := range strings.Split(string(input), "\n") {
+			if strings.HasPrefix(line, "BEGIN") {
+				begins++
+			}
+		}
+		results := 0
+		for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+			switch command, _, _ := strings.Cut(line, " "); command {
+			case "RESULT":
+				results++
+			case "", "STARTED", "ERROR", "LOG":
+			default:
+				// LOG lines of SHOW contain the values, which may
+				// contain any byte but a newline
+				if !strings.Contains(string(input), "SHOW") {
+					t.Fatalf("unexpected output %q", line)
+				}
+			}
+		}
+		if results > begins {
+			t.Fatalf("%d RESULT for %d BEGIN", results, begins)
+		}
+	})
+}
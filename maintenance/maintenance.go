@@ -0,0 +1,209 @@
+// Package maintenance implements draining of a Grid Engine cluster
+// for maintenance windows in a JSV.
+//
+// A maintenance window is either active as long as a flag file
+// exists, or it is defined by a cron-style schedule and a duration.
+// During the window new jobs are rejected (or rejected with
+// RejectWait so that they can be resubmitted later). Optionally jobs
+// whose runtime limit (h_rt) would overlap the next window are
+// rejected before the window starts.
+//
+// Typical usage in a verification function:
+//
+//	m := maintenance.New()
+//	m.FlagFile = "/etc/gridengine/maintenance"
+//
+//	func jsvVerificationFunction() {
+//		if !m.Check() {
+//			return
+//		}
+//		...
+//	}
+package maintenance
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv"
+)
+
+// Action defines how jobs are rejected during a maintenance window.
+type Action int
+
+const (
+	// RejectWait rejects the job with jsv.RejectWait().
+	RejectWait Action = iota
+	// Reject rejects the job with jsv.Reject().
+	Reject
+)
+
+// Maintenance rejects jobs during maintenance windows.
+type Maintenance struct {
+	// FlagFile is a file which activates the maintenance when it
+	// exists. When the file is not empty its content is used as
+	// reject message.
+	FlagFile string
+	// Schedule defines the start times of the maintenance windows.
+	Schedule *Schedule
+	// Duration is the length of a scheduled maintenance window.
+	Duration time.Duration
+	// Action defines how jobs are rejected.
+	Action Action
+	// Message is the reject message. It defaults to DefaultMessage.
+	Message string
+	// RejectOverlapping rejects jobs whose runtime limit (h_rt)
+	// overlaps the next scheduled maintenance window, taking the
+	// requested start time (qsub -a) into account.
+	RejectOverlapping bool
+	// RejectUnlimited rejects jobs without a runtime limit before
+	// a scheduled maintenance window when RejectOverlapping is set.
+	RejectUnlimited bool
+	// ExemptUsers are users whose jobs are never rejected.
+	ExemptUsers []string
+}
+
+// DefaultMessage is the reject message used when no message is
+// configured.
+const DefaultMessage = "Cluster is in maintenance, job submission is disabled"
+
+// New creates a new Maintenance which rejects jobs with RejectWait.
+func New() *Maintenance {
+	return &Maintenance{Action: RejectWait}
+}
+
+// Window returns the start and end time of the maintenance window
+// which is active at the given time or which starts next. The
+// returned bool is true when the window is active at the given time.
+// A window activated by the flag file has no start and end time.
+// When no window is configured zero times and false are returned.
+func (m *Maintenance) Window(now time.Time) (time.Time, time.Time, bool) {
+	if m.FlagFile != "" {
+		if _, err := os.Stat(m.FlagFile); err == nil {
+			return time.Time{}, time.Time{}, true
+		}
+	}
+	if m.Schedule == nil || m.Duration <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	// a window which started within the last Duration is still active
+	start := m.Schedule.Next(now.Add(-m.Duration))
+	if start.IsZero() {
+		return time.Time{}, time.Time{}, false
+	}
+	end := start.Add(m.Duration)
+	return start, end, !start.After(now)
+}
+
+// Check verifies the currently processed job. When the job must be
+// rejected because of a maintenance window it is rejected and false
+// is returned.
+func (m *Maintenance) Check() bool {
+	return m.CheckAt(time.Now())
+}
+
+// CheckAt is Check at the given time. Overlapping jobs are checked
+// against the window which is active at, or starts after, the
+// requested start time of the job (qsub -a).
+func (m *Maintenance) CheckAt(now time.Time) bool {
+	if user, exists := jsv.GetParam("USER"); exists && m.isExempt(user) {
+		return true
+	}
+
+	start, end, active := m.Window(now)
+	if active {
+		m.reject(m.message(start, end))
+		return false
+	}
+	if !m.RejectOverlapping || start.IsZero() {
+		return true
+	}
+
+	jobStart, _, _, err := JobInterval(now)
+	if err != nil {
+		jsv.Reject(err.Error())
+		return false
+	}
+	if jobStart.After(now) {
+		if start, end, _ = m.Window(jobStart); start.IsZero() {
+			return true
+		}
+	}
+
+	check := RuntimeCheck{
+		Downtimes: []Downtime{{Name: "maintenance", Start: start, End: end}},
+		Action:    m.Action,
+	}
+	if m.RejectUnlimited {
+		check.Unlimited = RejectUnlimitedJobs
+	}
+	accepted, _ := check.CheckAt(now)
+	return accepted
+}
+
+func (m *Maintenance) isExempt(user string) bool {
+	for _, exempt := range m.ExemptUsers {
+		if exempt == user {
+			return true
+		}
+	}
+	return false
+}
+
+// message returns the reject message for an active window.
+func (m *Maintenance) message(start, end time.Time) string {
+	if m.FlagFile != "" {
+		if content, err := os.ReadFile(m.FlagFile); err == nil {
+			if message := strings.TrimSpace(string(content)); message != "" {
+				return message
+			}
+		}
+	}
+	message := m.Message
+	if message == "" {
+		message = DefaultMessage
+	}
+	if !end.IsZero() {
+		message += " until " + end.Format(time.RFC3339)
+	}
+	return message
+}
+
+func (m *Maintenance) reject(message string) {
+	if m.Action == Reject {
+		jsv.Reject(message)
+		return
+	}
+	jsv.RejectWait(message)
+}
+
+// ParseTime parses a Grid Engine time value like it is used for h_rt.
+// Supported formats are seconds ("3600"), "hh:mm:ss" ("1:00:00"),
+// where empty fields count as 0 (":30:"), and "INFINITY" which
+// returns a negative duration.
+func ParseTime(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "INFINITY") {
+		return -1, nil
+	}
+	fields := strings.Split(value, ":")
+	if value == "" || (len(fields) != 1 && len(fields) != 3) {
+		return 0, fmt.Errorf("invalid time value %q", value)
+	}
+	var seconds int64
+	for _, field := range fields {
+		var n int64
+		if field != "" {
+			var err error
+			n, err = strconv.ParseInt(field, 10, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid time value %q", value)
+			}
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,119 @@
+package maintenance_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/maintenance"
+)
+
+var _ = Describe("Maintenance", func() {
+
+	Context("schedule", func() {
+
+		It("should find the next matching time", func() {
+			// Sundays at 06:00
+			s, err := maintenance.ParseSchedule("0 6 * * 0")
+			Expect(err).ToNot(HaveOccurred())
+			// Wednesday
+			next := s.Next(time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2024, 1, 7, 6, 0, 0, 0, time.UTC)))
+		})
+
+		It("should support steps, ranges, and lists", func() {
+			s, err := maintenance.ParseSchedule("*/15 8-9 1,15 * *")
+			Expect(err).ToNot(HaveOccurred())
+			next := s.Next(time.Date(2024, 1, 1, 9, 50, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)))
+			Expect(s.Matches(time.Date(2024, 1, 15, 9, 45, 0, 0, time.UTC))).To(BeTrue())
+			Expect(s.Matches(time.Date(2024, 1, 15, 9, 40, 0, 0, time.UTC))).To(BeFalse())
+		})
+
+		It("should match either restricted day field like cron", func() {
+			// the 1st or Mondays
+			s, err := maintenance.ParseSchedule("0 2 1 * 1")
+			Expect(err).ToNot(HaveOccurred())
+			next := s.Next(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2024, 1, 8, 2, 0, 0, 0, time.UTC)))
+
+			// a step of "*" does not restrict the day of month: Mondays
+			// on odd days
+			s, err = maintenance.ParseSchedule("0 2 */2 * 1")
+			Expect(err).ToNot(HaveOccurred())
+			next = s.Next(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2024, 1, 15, 2, 0, 0, 0, time.UTC)))
+		})
+
+		It("should reject invalid schedules", func() {
+			_, err := maintenance.ParseSchedule("0 6 * *")
+			Expect(err).To(HaveOccurred())
+			_, err = maintenance.ParseSchedule("60 6 * * *")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("window", func() {
+
+		It("should detect an active scheduled window", func() {
+			s, err := maintenance.ParseSchedule("0 6 * * 0")
+			Expect(err).ToNot(HaveOccurred())
+			m := maintenance.New()
+			m.Schedule = s
+			m.Duration = 4 * time.Hour
+
+			start, end, active := m.Window(time.Date(2024, 1, 7, 8, 0, 0, 0, time.UTC))
+			Expect(active).To(BeTrue())
+			Expect(start).To(Equal(time.Date(2024, 1, 7, 6, 0, 0, 0, time.UTC)))
+			Expect(end).To(Equal(time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC)))
+
+			start, _, active = m.Window(time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC))
+			Expect(active).To(BeFalse())
+			Expect(start).To(Equal(time.Date(2024, 1, 14, 6, 0, 0, 0, time.UTC)))
+		})
+
+		It("should be active when the flag file exists", func() {
+			flagFile := filepath.Join(GinkgoT().TempDir(), "maintenance")
+			m := maintenance.New()
+			m.FlagFile = flagFile
+			_, _, active := m.Window(time.Now())
+			Expect(active).To(BeFalse())
+
+			Expect(os.WriteFile(flagFile, nil, 0644)).To(Succeed())
+			_, _, active = m.Window(time.Now())
+			Expect(active).To(BeTrue())
+		})
+	})
+
+	Context("time values", func() {
+
+		It("should parse Grid Engine time values", func() {
+			Expect(maintenance.ParseTime("3600")).To(Equal(time.Hour))
+			Expect(maintenance.ParseTime("1:30:00")).To(Equal(90 * time.Minute))
+			Expect(maintenance.ParseTime(":30:")).To(Equal(30 * time.Minute))
+			Expect(maintenance.ParseTime("INFINITY")).To(BeNumerically("<", 0))
+			_, err := maintenance.ParseTime("1h")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("date time values", func() {
+		now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+		It("should parse the qsub -a format", func() {
+			Expect(maintenance.ParseDateTime("03151830", now)).To(Equal(time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC)))
+			Expect(maintenance.ParseDateTime("2503151830.45", now)).To(Equal(time.Date(2025, 3, 15, 18, 30, 45, 0, time.UTC)))
+			Expect(maintenance.ParseDateTime("202503151830", now)).To(Equal(time.Date(2025, 3, 15, 18, 30, 0, 0, time.UTC)))
+			Expect(maintenance.ParseDateTime("9903151830", now)).To(Equal(time.Date(1999, 3, 15, 18, 30, 0, 0, time.UTC)))
+		})
+
+		It("should reject invalid date times", func() {
+			for _, value := range []string{"0315183", "03151830.5", "13011200", "02301200", "0315x830"} {
+				_, err := maintenance.ParseDateTime(value, now)
+				Expect(err).To(HaveOccurred(), value)
+			}
+		})
+	})
+})
@@ -0,0 +1,229 @@
+package maintenance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv"
+)
+
+// Downtime is a time range in which jobs must not run, like an
+// advance reservation of the whole cluster or a planned downtime.
+type Downtime struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// UnlimitedPolicy defines how jobs without a runtime limit (h_rt)
+// are treated when they could overlap a downtime.
+type UnlimitedPolicy int
+
+const (
+	// AcceptUnlimited accepts jobs without runtime limit.
+	AcceptUnlimited UnlimitedPolicy = iota
+	// RejectUnlimitedJobs rejects jobs without runtime limit.
+	RejectUnlimitedJobs
+	// LimitUnlimited sets the runtime limit of jobs without runtime
+	// limit so that they end before the next downtime.
+	LimitUnlimited
+)
+
+// RuntimeCheck rejects or shortens jobs whose runtime limit crosses
+// a downtime.
+type RuntimeCheck struct {
+	// Downtimes are the windows in which jobs must not run.
+	Downtimes []Downtime
+	// Shorten reduces the runtime limit of overlapping jobs so that
+	// they end before the downtime starts, instead of rejecting them.
+	Shorten bool
+	// MinRuntime is the smallest runtime limit a job is shortened to.
+	// When the remaining time is smaller the job is rejected.
+	MinRuntime time.Duration
+	// Unlimited defines how jobs without runtime limit are treated.
+	Unlimited UnlimitedPolicy
+	// Action defines how jobs are rejected.
+	Action Action
+}
+
+// JobInterval returns the earliest start time of the currently
+// processed job, taking the requested start time (qsub -a) into
+// account, and the end time when the job runs for its full runtime
+// limit (h_rt). The returned duration is the runtime limit, which
+// is negative when the job has no runtime limit.
+func JobInterval(now time.Time) (time.Time, time.Time, time.Duration, error) {
+	start := now
+	if a, exists := jsv.GetParam("a"); exists && a != "" {
+		requested, err := ParseDateTime(a, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, err
+		}
+		if requested.After(start) {
+			start = requested
+		}
+	}
+	runtime := time.Duration(-1)
+	if hrt, exists := jsv.SubGetParam("l_hard", "h_rt"); exists {
+		var err error
+		if runtime, err = ParseTime(hrt); err != nil {
+			return time.Time{}, time.Time{}, 0, err
+		}
+	}
+	if runtime < 0 {
+		return start, time.Time{}, runtime, nil
+	}
+	return start, start.Add(runtime), runtime, nil
+}
+
+// Check verifies the runtime of the currently processed job against
+// the downtimes. The first result is false when the job was rejected.
+// The second result is true when the runtime limit of the job was
+// changed; the verification function should then finish with
+// jsv.Correct().
+func (r *RuntimeCheck) Check() (bool, bool) {
+	return r.CheckAt(time.Now())
+}
+
+// CheckAt is Check at the given time.
+func (r *RuntimeCheck) CheckAt(now time.Time) (bool, bool) {
+	start, end, runtime, err := JobInterval(now)
+	if err != nil {
+		jsv.Reject(err.Error())
+		return false, false
+	}
+
+	downtime, found := r.next(start, end)
+	if !found {
+		return true, false
+	}
+
+	if start.Before(downtime.End) && !start.Before(downtime.Start) {
+		r.reject(fmt.Sprintf("Job would start during downtime %s", downtime.describe()))
+		return false, false
+	}
+
+	remaining := downtime.Start.Sub(start).Truncate(time.Second)
+	if runtime < 0 {
+		switch r.Unlimited {
+		case AcceptUnlimited:
+			return true, false
+		case RejectUnlimitedJobs:
+			r.reject(fmt.Sprintf("Job without runtime limit (h_rt) would overlap downtime %s", downtime.describe()))
+			return false, false
+		}
+		return r.shorten(remaining, downtime)
+	}
+
+	if !r.Shorten {
+		r.reject(fmt.Sprintf("Job runtime limit of %d seconds overlaps downtime %s, maximum is %d seconds",
+			int64(runtime.Seconds()), downtime.describe(), int64(remaining.Seconds())))
+		return false, false
+	}
+	return r.shorten(remaining, downtime)
+}
+
+// next returns the first downtime which overlaps the interval from
+// start to end. An end of zero means unlimited.
+func (r *RuntimeCheck) next(start, end time.Time) (Downtime, bool) {
+	var first Downtime
+	found := false
+	for _, downtime := range r.Downtimes {
+		if !downtime.End.After(start) {
+			continue
+		}
+		if !end.IsZero() && !end.After(downtime.Start) {
+			continue
+		}
+		if !found || downtime.Start.Before(first.Start) {
+			first = downtime
+			found = true
+		}
+	}
+	return first, found
+}
+
+func (r *RuntimeCheck) shorten(remaining time.Duration, downtime Downtime) (bool, bool) {
+	if remaining <= 0 || remaining < r.MinRuntime {
+		r.reject(fmt.Sprintf("Job can't finish before downtime %s", downtime.describe()))
+		return false, false
+	}
+	seconds := strconv.FormatInt(int64(remaining.Seconds()), 10)
+	jsv.SubAddParam("l_hard", "h_rt", seconds)
+	jsv.LogInfo(fmt.Sprintf("Runtime limit set to %s seconds because of downtime %s", seconds, downtime.describe()))
+	return true, true
+}
+
+func (r *RuntimeCheck) reject(message string) {
+	if r.Action == Reject {
+		jsv.Reject(message)
+		return
+	}
+	jsv.RejectWait(message)
+}
+
+func (d Downtime) describe() string {
+	window := d.Start.Format(time.RFC3339) + " - " + d.End.Format(time.RFC3339)
+	if d.Name != "" {
+		return d.Name + " (" + window + ")"
+	}
+	return window
+}
+
+// ParseDateTime parses the [[CC]YY]MMDDhhmm[.SS] format which is used
+// by qsub -a. Without a year the year of now is used. Two digit years
+// from 69 to 99 are in the 20th century, from 00 to 68 in the 21st
+// century. The time is interpreted in the location of now.
+func ParseDateTime(value string, now time.Time) (time.Time, error) {
+	datetime, seconds, hasSeconds := strings.Cut(value, ".")
+	invalid := fmt.Errorf("invalid date time %q, expected [[CC]YY]MMDDhhmm[.SS]", value)
+	if hasSeconds && len(seconds) != 2 {
+		return time.Time{}, invalid
+	}
+	if len(datetime) != 8 && len(datetime) != 10 && len(datetime) != 12 {
+		return time.Time{}, invalid
+	}
+	if hasSeconds {
+		datetime += seconds
+	} else {
+		datetime += "00"
+	}
+	for _, c := range datetime {
+		if c < '0' || c > '9' {
+			return time.Time{}, invalid
+		}
+	}
+	number := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	year := now.Year()
+	switch len(datetime) {
+	case 14:
+		year = number(datetime[:4])
+		datetime = datetime[4:]
+	case 12:
+		year = number(datetime[:2])
+		if year >= 69 {
+			year += 1900
+		} else {
+			year += 2000
+		}
+		datetime = datetime[2:]
+	}
+	month := number(datetime[0:2])
+	day := number(datetime[2:4])
+	hour := number(datetime[4:6])
+	minute := number(datetime[6:8])
+	second := number(datetime[8:10])
+
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, now.Location())
+	// time.Date normalizes invalid values like month 13
+	if t.Month() != time.Month(month) || t.Day() != day || t.Hour() != hour ||
+		t.Minute() != minute || t.Second() != second {
+		return time.Time{}, invalid
+	}
+	return t, nil
+}
@@ -0,0 +1,206 @@
+package maintenance_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/maintenance"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+type runtimeConfig struct {
+	Check maintenance.RuntimeCheck
+	Now   time.Time
+}
+
+type windowConfig struct {
+	Schedule          string
+	Duration          time.Duration
+	FlagFile          string
+	ExemptUsers       []string
+	RejectOverlapping bool
+	RejectUnlimited   bool
+	Now               time.Time
+}
+
+// finish ends the verification like a JSV which uses the checks
+func finish(accepted, corrected bool) {
+	switch {
+	case !accepted:
+	case corrected:
+		jsv.Correct("runtime shortened")
+	default:
+		jsv.Accept("")
+	}
+}
+
+func init() {
+	jsvs["runtime"] = func() {
+		var config runtimeConfig
+		readConfig(&config)
+		jsv.Run(false, func() { finish(config.Check.CheckAt(config.Now)) }, nil)
+	}
+	jsvs["window"] = func() {
+		var config windowConfig
+		readConfig(&config)
+		schedule, err := maintenance.ParseSchedule(config.Schedule)
+		if err != nil {
+			panic(err)
+		}
+		m := maintenance.New()
+		m.Schedule = schedule
+		m.Duration = config.Duration
+		m.FlagFile = config.FlagFile
+		m.ExemptUsers = config.ExemptUsers
+		m.RejectOverlapping = config.RejectOverlapping
+		m.RejectUnlimited = config.RejectUnlimited
+		jsv.Run(false, func() { finish(m.CheckAt(config.Now), false) }, nil)
+	}
+}
+
+// job creates a job of the user with the parameters given as
+// name and value pairs
+func job(user string, params ...string) *jsvserver.JobSpec {
+	spec := &jsvserver.JobSpec{Client: "qsub", User: user, CmdName: "job.sh", Params: map[string]string{}}
+	for i := 0; i+1 < len(params); i += 2 {
+		spec.Params[params[i]] = params[i+1]
+	}
+	return spec
+}
+
+var _ = Describe("Verification", func() {
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	downtime := maintenance.Downtime{
+		Name:  "upgrade",
+		Start: time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC),
+	}
+
+	Context("runtime check", func() {
+
+		var check maintenance.RuntimeCheck
+
+		BeforeEach(func() {
+			check = maintenance.RuntimeCheck{Downtimes: []maintenance.Downtime{downtime}}
+		})
+
+		send := func(job *jsvserver.JobSpec) *jsvserver.JSVResult {
+			return verify("runtime", runtimeConfig{Check: check, Now: now}, job)
+		}
+
+		It("should accept jobs which end before the downtime", func() {
+			Expect(send(job("alice", "l_hard", "h_rt=3600")).State).To(Equal("ACCEPT"))
+			Expect(send(job("alice", "l_hard", "h_rt=7200")).State).To(Equal("ACCEPT"))
+			// deferred after the downtime
+			Expect(send(job("alice", "a", "03011600", "l_hard", "h_rt=36000")).State).To(Equal("ACCEPT"))
+		})
+
+		It("should reject jobs which overlap the downtime", func() {
+			result := send(job("alice", "l_hard", "h_rt=3:00:00"))
+			Expect(result.State).To(Equal("REJECT_WAIT"))
+			Expect(result.Message).To(Equal("Job runtime limit of 10800 seconds overlaps downtime upgrade " +
+				"(2024-03-01T14:00:00Z - 2024-03-01T16:00:00Z), maximum is 7200 seconds"))
+
+			check.Action = maintenance.Reject
+			result = send(job("alice", "a", "03011500", "l_hard", "h_rt=60"))
+			Expect(result.State).To(Equal("REJECT"))
+			Expect(result.Message).To(HavePrefix("Job would start during downtime upgrade"))
+		})
+
+		It("should shorten jobs which overlap the downtime", func() {
+			check.Shorten = true
+			result := send(job("alice", "l_hard", "h_rt=10800,mem=1G"))
+			Expect(result.State).To(Equal("CORRECT"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("l_hard", "h_rt=7200,mem=1G"))
+
+			// the requested start time reduces the remaining time
+			result = send(job("alice", "a", "03011330", "l_hard", "h_rt=10800"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("l_hard", "h_rt=1800"))
+		})
+
+		It("should not shorten jobs below the minimum runtime", func() {
+			check.Shorten = true
+			check.MinRuntime = 3 * time.Hour
+			result := send(job("alice", "l_hard", "h_rt=14400"))
+			Expect(result.State).To(Equal("REJECT_WAIT"))
+			Expect(result.Message).To(HavePrefix("Job can't finish before downtime upgrade"))
+		})
+
+		It("should apply the policy for jobs without runtime limit", func() {
+			Expect(send(job("alice")).State).To(Equal("ACCEPT"))
+
+			check.Unlimited = maintenance.RejectUnlimitedJobs
+			Expect(send(job("alice")).Message).To(HavePrefix("Job without runtime limit (h_rt) would overlap downtime upgrade"))
+
+			check.Unlimited = maintenance.LimitUnlimited
+			result := send(job("alice", "l_hard", "mem=1G"))
+			Expect(result.State).To(Equal("CORRECT"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("l_hard", "mem=1G,h_rt=7200"))
+
+			// INFINITY is no runtime limit
+			result = send(job("alice", "l_hard", "h_rt=INFINITY"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("l_hard", "h_rt=7200"))
+		})
+
+		It("should reject jobs with invalid time values", func() {
+			Expect(send(job("alice", "l_hard", "h_rt=1h")).Message).To(ContainSubstring(`invalid time value "1h"`))
+			Expect(send(job("alice", "a", "tomorrow")).Message).To(ContainSubstring(`invalid date time "tomorrow"`))
+		})
+	})
+
+	Context("maintenance", func() {
+
+		var config windowConfig
+
+		BeforeEach(func() {
+			config = windowConfig{Schedule: "0 14 * * *", Duration: 2 * time.Hour, Now: now}
+		})
+
+		send := func(job *jsvserver.JobSpec) *jsvserver.JSVResult {
+			return verify("window", config, job)
+		}
+
+		It("should reject jobs during the window except for exempt users", func() {
+			flagFile := filepath.Join(GinkgoT().TempDir(), "maintenance")
+			Expect(os.WriteFile(flagFile, []byte("Upgrade to 9.0\n"), 0644)).To(Succeed())
+			config.FlagFile = flagFile
+			config.ExemptUsers = []string{"root"}
+
+			result := send(job("alice"))
+			Expect(result.State).To(Equal("REJECT_WAIT"))
+			Expect(result.Message).To(Equal("Upgrade to 9.0"))
+			Expect(send(job("root")).State).To(Equal("ACCEPT"))
+
+			config.FlagFile = ""
+			config.Now = time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+			Expect(send(job("alice")).Message).To(Equal(maintenance.DefaultMessage + " until 2024-03-01T16:00:00Z"))
+		})
+
+		It("should reject jobs which overlap the next window", func() {
+			config.RejectOverlapping = true
+			Expect(send(job("alice", "l_hard", "h_rt=3600")).State).To(Equal("ACCEPT"))
+			Expect(send(job("alice", "l_hard", "h_rt=10800")).Message).To(ContainSubstring("overlaps downtime maintenance"))
+			Expect(send(job("alice")).State).To(Equal("ACCEPT"))
+
+			config.RejectUnlimited = true
+			Expect(send(job("alice")).Message).To(HavePrefix("Job without runtime limit"))
+		})
+
+		It("should check deferred jobs against the window after their start time", func() {
+			config.RejectOverlapping = true
+			// starts after today's window and overlaps tomorrow's window
+			result := send(job("alice", "a", "03021000", "l_hard", "h_rt=18000"))
+			Expect(result.Message).To(ContainSubstring("overlaps downtime maintenance (2024-03-02T14:00:00Z - 2024-03-02T16:00:00Z)"))
+			// starts during tomorrow's window
+			result = send(job("alice", "a", "03021500", "l_hard", "h_rt=60"))
+			Expect(result.Message).To(HavePrefix("Job would start during downtime maintenance (2024-03-02T14:00:00Z"))
+			Expect(send(job("alice", "a", "03011700", "l_hard", "h_rt=3600")).State).To(Equal("ACCEPT"))
+		})
+	})
+})
@@ -0,0 +1,273 @@
+// Package metrics collects statistics about the decisions of a JSV
+// and writes them in the Prometheus text exposition format to a file
+// which can be picked up by the node_exporter textfile collector.
+//
+// A JSV is started as a child process of qmaster (or of qsub for client
+// side JSVs) and communicates over stdin/stdout, hence it can't serve
+// the metrics over HTTP. Instead the metrics are written periodically
+// and atomically to a .prom file.
+//
+// Typical usage:
+//
+//	c := metrics.NewCollector("/var/lib/node_exporter/textfile/jsv.prom")
+//	c.Start()
+//	defer c.Stop()
+//	jsv.Run(true, c.Wrap(jsvVerificationFunction), jsvOnStartFunction)
+//
+// Note that the counters are the counters of the running JSV process.
+// For client side JSVs, which run once per submission, a file per
+// process or host is required.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgruber/jsv"
+)
+
+// DefaultInterval is the default interval in which the metrics
+// file is rewritten.
+const DefaultInterval = 15 * time.Second
+
+// DefaultBuckets are the upper bounds (in seconds) of the
+// verification latency histogram.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type resultKey struct {
+	state  string
+	rule   string
+	client string
+}
+
+// Collector counts the RESULT states, protocol errors, and the
+// latency of the verification function of a JSV.
+type Collector struct {
+	// Path is the .prom file the metrics are written to.
+	Path string
+	// Interval is the time between two writes of the metrics file.
+	Interval time.Duration
+	// Buckets are the upper bounds of the latency histogram.
+	Buckets []float64
+
+	mu             sync.Mutex
+	rule           string
+	results        map[resultKey]uint64
+	protocolErrors uint64
+	bucketCounts   []uint64
+	latencyCount   uint64
+	latencySum     float64
+
+	prevOnResult        func(string, string)
+	prevOnProtocolError func(string)
+	stop                chan struct{}
+	done                chan struct{}
+}
+
+// NewCollector creates a new Collector which writes its metrics
+// to the given path.
+func NewCollector(path string) *Collector {
+	return &Collector{
+		Path:     path,
+		Interval: DefaultInterval,
+		Buckets:  DefaultBuckets,
+		results:  make(map[resultKey]uint64),
+	}
+}
+
+// Start registers the collector at the jsv package (jsv.OnResult and
+// jsv.OnProtocolError) and starts writing the metrics file periodically.
+// Start must be called before jsv.Run().
+func (c *Collector) Start() {
+	c.mu.Lock()
+	if c.bucketCounts == nil {
+		c.bucketCounts = make([]uint64, len(c.Buckets))
+	}
+	c.mu.Unlock()
+
+	// chain already registered functions
+	c.prevOnResult = jsv.OnResult
+	c.prevOnProtocolError = jsv.OnProtocolError
+	jsv.OnResult = c.onResult
+	jsv.OnProtocolError = c.onProtocolError
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.writeLoop()
+}
+
+// Stop stops the periodic writer, writes the metrics file a last
+// time, and restores the previous jsv package hooks.
+func (c *Collector) Stop() error {
+	if c.stop == nil {
+		return nil
+	}
+	close(c.stop)
+	<-c.done
+	c.stop = nil
+	jsv.OnResult = c.prevOnResult
+	jsv.OnProtocolError = c.prevOnProtocolError
+	return c.WriteFile()
+}
+
+// Wrap returns a verification function which measures the latency
+// of the given verification function.
+func (c *Collector) Wrap(verificationFunction func()) func() {
+	return func() {
+		start := time.Now()
+		verificationFunction()
+		c.observeLatency(time.Since(start).Seconds())
+	}
+}
+
+// Rule sets the name of the rule which is responsible for the RESULT
+// of the currently verified job. It is used as the "rule" label of
+// the results counter and reset after the RESULT was sent.
+func (c *Collector) Rule(name string) {
+	c.mu.Lock()
+	c.rule = name
+	c.mu.Unlock()
+}
+
+func (c *Collector) onResult(state, message string) {
+	client, _ := jsv.GetParam("CLIENT")
+	c.mu.Lock()
+	c.results[resultKey{state: state, rule: c.rule, client: client}]++
+	c.rule = ""
+	c.mu.Unlock()
+	if c.prevOnResult != nil {
+		c.prevOnResult(state, message)
+	}
+}
+
+func (c *Collector) onProtocolError(message string) {
+	c.mu.Lock()
+	c.protocolErrors++
+	c.mu.Unlock()
+	if c.prevOnProtocolError != nil {
+		c.prevOnProtocolError(message)
+	}
+}
+
+func (c *Collector) observeLatency(seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bucketCounts == nil {
+		c.bucketCounts = make([]uint64, len(c.Buckets))
+	}
+	for i, upper := range c.Buckets {
+		if seconds <= upper {
+			c.bucketCounts[i]++
+		}
+	}
+	c.latencyCount++
+	c.latencySum += seconds
+}
+
+func (c *Collector) writeLoop() {
+	defer close(c.done)
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// errors can't be reported over the JSV protocol
+			// outside of a verification, the next write retries
+			c.WriteFile()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// WriteFile writes the metrics atomically to the metrics file. The
+// content is written to a temporary file in the same directory
+// which is then renamed, so that the textfile collector never reads
+// a partially written file.
+func (c *Collector) WriteFile() error {
+	var buf bytes.Buffer
+	c.Format(&buf)
+
+	dir := filepath.Dir(c.Path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(c.Path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to change permissions of metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.Path); err != nil {
+		return fmt.Errorf("failed to rename metrics file: %w", err)
+	}
+	return nil
+}
+
+// Format writes the metrics in the Prometheus text exposition format
+// to the given writer.
+func (c *Collector) Format(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	io.WriteString(w, "# HELP jsv_results_total Number of job verifications by RESULT state, rule, and client.\n")
+	io.WriteString(w, "# TYPE jsv_results_total counter\n")
+	keys := make([]resultKey, 0, len(c.results))
+	for key := range c.results {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].state != keys[j].state {
+			return keys[i].state < keys[j].state
+		}
+		if keys[i].rule != keys[j].rule {
+			return keys[i].rule < keys[j].rule
+		}
+		return keys[i].client < keys[j].client
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "jsv_results_total{state=\"%s\",rule=\"%s\",client=\"%s\"} %d\n",
+			escapeLabel(key.state), escapeLabel(key.rule), escapeLabel(key.client), c.results[key])
+	}
+
+	io.WriteString(w, "# HELP jsv_protocol_errors_total Number of ERROR commands sent to Grid Engine.\n")
+	io.WriteString(w, "# TYPE jsv_protocol_errors_total counter\n")
+	fmt.Fprintf(w, "jsv_protocol_errors_total %d\n", c.protocolErrors)
+
+	io.WriteString(w, "# HELP jsv_verification_duration_seconds Latency of the JSV verification function.\n")
+	io.WriteString(w, "# TYPE jsv_verification_duration_seconds histogram\n")
+	for i, upper := range c.Buckets {
+		var count uint64
+		if i < len(c.bucketCounts) {
+			count = c.bucketCounts[i]
+		}
+		fmt.Fprintf(w, "jsv_verification_duration_seconds_bucket{le=\"%g\"} %d\n", upper, count)
+	}
+	fmt.Fprintf(w, "jsv_verification_duration_seconds_bucket{le=\"+Inf\"} %d\n", c.latencyCount)
+	fmt.Fprintf(w, "jsv_verification_duration_seconds_sum %g\n", c.latencySum)
+	fmt.Fprintf(w, "jsv_verification_duration_seconds_count %d\n", c.latencyCount)
+}
+
+// escapeLabel escapes a label value as required by the Prometheus
+// text format.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
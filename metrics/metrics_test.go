@@ -0,0 +1,141 @@
+package metrics_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/metrics"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func init() {
+	// labels counts the jobs without project as rejected by the
+	// project rule
+	jsvs["labels"] = func() {
+		var path string
+		readConfig(&path)
+		collector := metrics.NewCollector(path)
+		collector.Start()
+		jsv.Run(false, collector.Wrap(func() {
+			if _, exists := jsv.GetParam("P"); !exists {
+				collector.Rule("project")
+				jsv.Reject("no project")
+				return
+			}
+			jsv.Accept("")
+		}), nil)
+		if err := collector.Stop(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+var _ = Describe("Collector", func() {
+
+	var (
+		path      string
+		collector *metrics.Collector
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "jsv.prom")
+		collector = metrics.NewCollector(path)
+		collector.Interval = time.Hour
+		collector.Buckets = []float64{0.001, 10}
+	})
+
+	format := func() string {
+		var b bytes.Buffer
+		collector.Format(&b)
+		return b.String()
+	}
+
+	It("should write the metrics in the textfile format", func() {
+		collector.Start()
+		Expect(collector.Stop()).To(Succeed())
+
+		content, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal(`# HELP jsv_results_total Number of job verifications by RESULT state, rule, and client.
+# TYPE jsv_results_total counter
+# HELP jsv_protocol_errors_total Number of ERROR commands sent to Grid Engine.
+# TYPE jsv_protocol_errors_total counter
+jsv_protocol_errors_total 0
+# HELP jsv_verification_duration_seconds Latency of the JSV verification function.
+# TYPE jsv_verification_duration_seconds histogram
+jsv_verification_duration_seconds_bucket{le="0.001"} 0
+jsv_verification_duration_seconds_bucket{le="10"} 0
+jsv_verification_duration_seconds_bucket{le="+Inf"} 0
+jsv_verification_duration_seconds_sum 0
+jsv_verification_duration_seconds_count 0
+`))
+		info, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+		// no temporary files are left behind
+		entries, err := os.ReadDir(filepath.Dir(path))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("should count the latency in cumulative buckets", func() {
+		fast := collector.Wrap(func() {})
+		slow := collector.Wrap(func() { time.Sleep(5 * time.Millisecond) })
+		fast()
+		slow()
+		slow()
+
+		Expect(format()).To(ContainSubstring(`jsv_verification_duration_seconds_bucket{le="0.001"} 1
+jsv_verification_duration_seconds_bucket{le="10"} 3
+jsv_verification_duration_seconds_bucket{le="+Inf"} 3
+`))
+		Expect(format()).To(ContainSubstring("jsv_verification_duration_seconds_count 3\n"))
+	})
+
+	It("should label the results with the state, rule, and client", func() {
+		job := func(params map[string]string) *jsvserver.JobSpec {
+			return &jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh", Params: params}
+		}
+		Expect(verify("labels", path, job(nil)).State).To(Equal("REJECT"))
+		content, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring(`jsv_results_total{state="REJECT",rule="project",client="qsub"} 1
+`))
+		Expect(string(content)).To(ContainSubstring("jsv_verification_duration_seconds_count 1\n"))
+
+		Expect(verify("labels", path, job(map[string]string{"P": "physics"})).State).To(Equal("ACCEPT"))
+		content, err = os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring(`jsv_results_total{state="ACCEPT",rule="",client="qsub"} 1
+`))
+	})
+
+	It("should chain and restore the hooks which were set before", func() {
+		var results, errors []string
+		jsv.OnResult = func(state, message string) { results = append(results, state+" "+message) }
+		jsv.OnProtocolError = func(message string) { errors = append(errors, message) }
+		defer func() {
+			jsv.OnResult = nil
+			jsv.OnProtocolError = nil
+		}()
+
+		collector.Start()
+		jsv.OnResult("REJECT", "no project")
+		jsv.OnProtocolError("unknown command")
+		Expect(results).To(Equal([]string{"REJECT no project"}))
+		Expect(errors).To(Equal([]string{"unknown command"}))
+		Expect(format()).To(ContainSubstring(`jsv_results_total{state="REJECT",rule="",client=""} 1`))
+		Expect(format()).To(ContainSubstring("jsv_protocol_errors_total 1\n"))
+
+		Expect(collector.Stop()).To(Succeed())
+		jsv.OnResult("ACCEPT", "")
+		Expect(results).To(Equal([]string{"REJECT no project", "ACCEPT "}))
+		Expect(format()).ToNot(ContainSubstring(`state="ACCEPT"`))
+	})
+})
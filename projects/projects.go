@@ -0,0 +1,180 @@
+// Package projects assigns Grid Engine projects (qsub -P) to jobs
+// based on a user and group to project mapping.
+//
+// The mapping file contains one rule per line:
+//
+//	# <user|group> <name> <project>[,<project>...]
+//	user  alice  chemistry,physics
+//	group bio    biology
+//	user  *      general
+//
+// The rules are evaluated in this order: the rules of the user, the
+// rules of the groups of the user, "user *", and "group *". The first
+// project of the first matching rule is the default project of a user,
+// hence a group rule takes precedence over "user *". Jobs without
+// project get the default project assigned, jobs requesting a project
+// which is not allowed for the user are rejected.
+package projects
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/dgruber/jsv"
+)
+
+// Mapping maps users and groups to the projects they are allowed
+// to use.
+type Mapping struct {
+	users  map[string][]string
+	groups map[string][]string
+	// LookupGroups enables the lookup of the supplementary Unix groups
+	// of the submitting user with os/user.
+	LookupGroups bool
+}
+
+// LoadMapping reads a mapping file.
+func LoadMapping(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open project mapping file: %w", err)
+	}
+	defer f.Close()
+	return ParseMapping(f)
+}
+
+// ParseMapping parses the mapping rules from the given reader.
+func ParseMapping(r io.Reader) (*Mapping, error) {
+	m := &Mapping{
+		users:  make(map[string][]string),
+		groups: make(map[string][]string),
+	}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected <user|group> <name> <projects>", lineNumber)
+		}
+		var projects []string
+		for _, project := range strings.Split(fields[2], ",") {
+			if project != "" {
+				projects = append(projects, project)
+			}
+		}
+		switch fields[0] {
+		case "user":
+			m.users[fields[1]] = append(m.users[fields[1]], projects...)
+		case "group":
+			m.groups[fields[1]] = append(m.groups[fields[1]], projects...)
+		default:
+			return nil, fmt.Errorf("line %d: unknown rule type %q", lineNumber, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read project mapping: %w", err)
+	}
+	return m, nil
+}
+
+// Projects returns the projects the user is allowed to use. The
+// first project is the default project.
+func (m *Mapping) Projects(userName string, groups []string) []string {
+	var projects []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, project := range list {
+			if !seen[project] {
+				seen[project] = true
+				projects = append(projects, project)
+			}
+		}
+	}
+	add(m.users[userName])
+	for _, group := range groups {
+		add(m.groups[group])
+	}
+	add(m.users["*"])
+	add(m.groups["*"])
+	return projects
+}
+
+// Check verifies the project of the currently processed job. When no
+// project is requested the default project is set with jsv.SetParam().
+// When the requested project is not allowed the job is rejected with
+// a message listing the valid projects. The first result is false
+// when the job was rejected, the second result is true when the
+// project was set; the verification function should then finish
+// with jsv.Correct().
+func (m *Mapping) Check() (bool, bool) {
+	userName, _ := jsv.GetParam("USER")
+	var groups []string
+	if group, exists := jsv.GetParam("GROUP"); exists && group != "" {
+		groups = append(groups, group)
+	}
+	if m.LookupGroups {
+		unixGroups, err := UserGroups(userName)
+		if err != nil {
+			jsv.LogWarning("project mapping: " + err.Error())
+		}
+		groups = append(groups, unixGroups...)
+	}
+
+	allowed := m.Projects(userName, groups)
+	if len(allowed) == 0 {
+		// no rule for this user
+		return true, false
+	}
+
+	project, exists := jsv.GetParam("P")
+	if !exists || project == "" {
+		jsv.SetParam("P", allowed[0])
+		return true, true
+	}
+	for _, p := range allowed {
+		if p == project {
+			return true, false
+		}
+	}
+	jsv.Reject(fmt.Sprintf("Project %s is not allowed for user %s, valid projects are: %s",
+		project, userName, strings.Join(allowed, ", ")))
+	return false, false
+}
+
+// UserGroups returns the names of the Unix groups the user is member
+// of, starting with the primary group.
+func UserGroups(userName string) ([]string, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup user %s: %w", userName, err)
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup groups of user %s: %w", userName, err)
+	}
+	// primary group first
+	ordered := []string{u.Gid}
+	for _, gid := range gids {
+		if gid != u.Gid {
+			ordered = append(ordered, gid)
+		}
+	}
+	groups := make([]string, 0, len(ordered))
+	for _, gid := range ordered {
+		group, err := user.LookupGroupId(gid)
+		if err != nil {
+			continue
+		}
+		groups = append(groups, group.Name)
+	}
+	return groups, nil
+}
@@ -0,0 +1,56 @@
+package projects_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func TestProjects(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Projects Suite")
+}
+
+// jsvs are the JSVs which the test binary runs instead of the tests
+// when it is started by verify.
+var jsvs = make(map[string]func())
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv("JSV_TEST_NAME"); name != "" {
+		jsvs[name]()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// verify starts the test binary as the JSV with the name, which reads
+// the configuration with readConfig, and sends the job to it. The JSV
+// exits after the job.
+func verify(name string, config interface{}, job *jsvserver.JobSpec) *jsvserver.JSVResult {
+	data, err := json.Marshal(config)
+	Expect(err).ToNot(HaveOccurred())
+	GinkgoT().Setenv("JSV_TEST_NAME", name)
+	GinkgoT().Setenv("JSV_TEST_CONFIG", string(data))
+	executable, err := os.Executable()
+	Expect(err).ToNot(HaveOccurred())
+
+	server, err := jsvserver.NewJSVTestServer(executable)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(server.Start()).To(Succeed())
+	result, err := server.SendJob(job)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(server.Stop()).To(Succeed())
+	return result
+}
+
+// readConfig reads the configuration of a JSV started by verify.
+func readConfig(config interface{}) {
+	if err := json.Unmarshal([]byte(os.Getenv("JSV_TEST_CONFIG")), config); err != nil {
+		panic(err)
+	}
+}
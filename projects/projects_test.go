@@ -0,0 +1,119 @@
+package projects_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/projects"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func init() {
+	// mapping verifies the jobs with the mapping rules of the
+	// configuration
+	jsvs["mapping"] = func() {
+		var rules string
+		readConfig(&rules)
+		m, err := projects.ParseMapping(strings.NewReader(rules))
+		if err != nil {
+			panic(err)
+		}
+		jsv.Run(false, func() {
+			accepted, corrected := m.Check()
+			switch {
+			case !accepted:
+			case corrected:
+				jsv.Correct("project assigned")
+			default:
+				jsv.Accept("")
+			}
+		}, nil)
+	}
+}
+
+var _ = Describe("Projects", func() {
+
+	mapping := `
+# users
+user  alice  chemistry,physics
+group bio    biology
+user  *      general
+`
+
+	It("should return the projects of a user with the default project first", func() {
+		m, err := projects.ParseMapping(strings.NewReader(mapping))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Projects("alice", []string{"bio"})).To(Equal([]string{"chemistry", "physics", "biology", "general"}))
+		Expect(m.Projects("bob", []string{"bio"})).To(Equal([]string{"biology", "general"}))
+		Expect(m.Projects("carol", nil)).To(Equal([]string{"general"}))
+	})
+
+	It("should prefer group rules over the rules for all users", func() {
+		m, err := projects.ParseMapping(strings.NewReader(`
+group *    shared
+user  *    general
+group bio  biology
+`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Projects("bob", []string{"bio"})).To(Equal([]string{"biology", "general", "shared"}))
+		Expect(m.Projects("carol", []string{"chem"})).To(Equal([]string{"general", "shared"}))
+
+		result := verify("mapping", "user * general\ngroup bio biology", &jsvserver.JobSpec{
+			Client: "qsub", User: "bob", Group: "bio", CmdName: "job.sh", Params: map[string]string{},
+		})
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("P", "biology"))
+	})
+
+	It("should reject invalid mapping files", func() {
+		_, err := projects.ParseMapping(strings.NewReader("host node1 p1"))
+		Expect(err).To(HaveOccurred())
+		_, err = projects.ParseMapping(strings.NewReader("user alice"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should lookup the groups of a user", func() {
+		groups, err := projects.UserGroups("root")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(groups).ToNot(BeEmpty())
+	})
+
+	Context("verification", func() {
+
+		job := func(user, group, project string) *jsvserver.JobSpec {
+			spec := &jsvserver.JobSpec{Client: "qsub", User: user, Group: group, CmdName: "job.sh", Params: map[string]string{}}
+			if project != "" {
+				spec.Params["P"] = project
+			}
+			return spec
+		}
+
+		It("should assign the default project to jobs without project", func() {
+			result := verify("mapping", mapping, job("alice", "bio", ""))
+			Expect(result.State).To(Equal("CORRECT"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("P", "chemistry"))
+
+			result = verify("mapping", mapping, job("bob", "bio", ""))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("P", "biology"))
+		})
+
+		It("should accept allowed projects", func() {
+			result := verify("mapping", mapping, job("alice", "bio", "biology"))
+			Expect(result.State).To(Equal("ACCEPT"))
+			Expect(result.ModifiedParams).To(BeEmpty())
+		})
+
+		It("should reject projects which are not allowed with the valid projects", func() {
+			result := verify("mapping", mapping, job("bob", "bio", "chemistry"))
+			Expect(result.State).To(Equal("REJECT"))
+			Expect(result.Message).To(Equal("Project chemistry is not allowed for user bob, valid projects are: biology, general"))
+		})
+
+		It("should accept jobs of users without rule", func() {
+			result := verify("mapping", "user alice chemistry", job("bob", "", "anything"))
+			Expect(result.State).To(Equal("ACCEPT"))
+		})
+	})
+})
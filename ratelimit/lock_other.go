@@ -0,0 +1,13 @@
+//go:build !unix
+
+package ratelimit
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile is not supported on non unix systems.
+func lockFile(f *os.File) error {
+	return errors.New("file locking is not supported on this platform")
+}
@@ -0,0 +1,237 @@
+// Package ratelimit implements a submission rate limiter for JSVs
+// which persists its state across processes.
+//
+// Client side JSVs are started once per qsub, hence the state of the
+// limiter can't be kept in memory. The token buckets of all users,
+// groups, and projects are stored in a state file which is locked
+// (flock) while it is read and updated.
+//
+// Typical usage in a verification function:
+//
+//	limiter := ratelimit.NewLimiter("/var/tmp/jsv_ratelimit.json")
+//	limiter.PerUser = ratelimit.Limit{Submissions: 100, Window: time.Minute}
+//
+//	func jsvVerificationFunction() {
+//		if !limiter.Check() {
+//			// job was rejected with RejectWait()
+//			return
+//		}
+//		...
+//	}
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv"
+)
+
+// Limit defines how many submissions are allowed within a time
+// window. The bucket is refilled continuously, so a user can submit
+// up to Submissions jobs at once and afterwards one job every
+// Window/Submissions.
+type Limit struct {
+	Submissions int
+	Window      time.Duration
+}
+
+// enabled returns true when the limit is configured.
+func (l Limit) enabled() bool {
+	return l.Submissions > 0 && l.Window > 0
+}
+
+// Limiter limits the submission rate per user, group, and project.
+type Limiter struct {
+	// StateFile is the path of the file which stores the token buckets.
+	StateFile string
+	// PerUser is the limit for each user (USER parameter).
+	PerUser Limit
+	// PerGroup is the limit for each group (GROUP parameter).
+	PerGroup Limit
+	// PerProject is the limit for each project (P parameter).
+	PerProject Limit
+}
+
+// NewLimiter creates a new Limiter which stores its state in the
+// given file. All limits are disabled by default.
+func NewLimiter(stateFile string) *Limiter {
+	return &Limiter{StateFile: stateFile}
+}
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	// Allowed is true when the submission is within all limits.
+	Allowed bool
+	// Key is the bucket which exceeded its limit, like "user:alice".
+	Key string
+	// Limit is the limit which was exceeded.
+	Limit Limit
+	// RetryAfter is the time until a token is available again.
+	RetryAfter time.Duration
+}
+
+// Request is a bucket key together with the limit which applies to it.
+type Request struct {
+	Key   string
+	Limit Limit
+}
+
+// bucket is the persisted state of a token bucket.
+type bucket struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+	// Full is the time when the bucket is refilled to its capacity.
+	Full time.Time `json:"full"`
+}
+
+// Check verifies the currently processed job against the configured
+// limits. When a limit is exceeded the job is rejected with
+// jsv.RejectWait() and false is returned. When the state file can't
+// be accessed a warning is logged and the job is not limited.
+func (l *Limiter) Check() bool {
+	return l.CheckAt(time.Now())
+}
+
+// CheckAt is Check at the given time.
+func (l *Limiter) CheckAt(now time.Time) bool {
+	var requests []Request
+	if user, exists := jsv.GetParam("USER"); exists && l.PerUser.enabled() {
+		requests = append(requests, Request{Key: "user:" + user, Limit: l.PerUser})
+	}
+	if group, exists := jsv.GetParam("GROUP"); exists && l.PerGroup.enabled() {
+		requests = append(requests, Request{Key: "group:" + group, Limit: l.PerGroup})
+	}
+	if project, exists := jsv.GetParam("P"); exists && l.PerProject.enabled() {
+		requests = append(requests, Request{Key: "project:" + project, Limit: l.PerProject})
+	}
+	if len(requests) == 0 {
+		return true
+	}
+
+	decision, err := l.Take(now, requests)
+	if err != nil {
+		jsv.LogWarning("rate limit not checked: " + err.Error())
+		return true
+	}
+	if decision.Allowed {
+		return true
+	}
+	kind, name, _ := strings.Cut(decision.Key, ":")
+	jsv.RejectWait(fmt.Sprintf("Submission rate limit of %d jobs per %s exceeded for %s %s, retry in %s",
+		decision.Limit.Submissions, decision.Limit.Window, kind, name,
+		decision.RetryAfter.Round(time.Second)))
+	return false
+}
+
+// Take tries to take one token from each of the buckets of the
+// requests. Tokens are only taken when all buckets have a token
+// available. The state file is locked during the whole operation.
+func (l *Limiter) Take(now time.Time, requests []Request) (Decision, error) {
+	f, err := os.OpenFile(l.StateFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to open state file: %w", err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return Decision{}, fmt.Errorf("failed to lock state file: %w", err)
+	}
+
+	buckets, err := readBuckets(f)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	// refill all requested buckets before deciding
+	for _, request := range requests {
+		buckets[request.Key] = refill(buckets[request.Key], request.Limit, now)
+	}
+
+	for _, request := range requests {
+		b := buckets[request.Key]
+		if b.Tokens < 1 {
+			rate := float64(request.Limit.Submissions) / request.Limit.Window.Seconds()
+			retry := time.Duration((1 - b.Tokens) / rate * float64(time.Second))
+			return Decision{
+				Key:        request.Key,
+				Limit:      request.Limit,
+				RetryAfter: retry,
+			}, nil
+		}
+	}
+
+	requested := make(map[string]bool, len(requests))
+	for _, request := range requests {
+		b := buckets[request.Key]
+		b.Tokens--
+		rate := float64(request.Limit.Submissions) / request.Limit.Window.Seconds()
+		missing := float64(request.Limit.Submissions) - b.Tokens
+		b.Full = b.Updated.Add(time.Duration(missing / rate * float64(time.Second)))
+		buckets[request.Key] = b
+		requested[request.Key] = true
+	}
+
+	// full buckets are equal to new buckets and don't need to be stored
+	for key, b := range buckets {
+		if !requested[key] && !now.Before(b.Full) {
+			delete(buckets, key)
+		}
+	}
+
+	if err := writeBuckets(f, buckets); err != nil {
+		return Decision{}, err
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// refill adds the tokens which were generated since the last update
+// of the bucket. A new bucket starts full.
+func refill(b bucket, limit Limit, now time.Time) bucket {
+	capacity := float64(limit.Submissions)
+	if b.Updated.IsZero() {
+		return bucket{Tokens: capacity, Updated: now}
+	}
+	elapsed := now.Sub(b.Updated).Seconds()
+	if elapsed > 0 {
+		rate := capacity / limit.Window.Seconds()
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed*rate)
+		b.Updated = now
+	}
+	return b
+}
+
+func readBuckets(f *os.File) (map[string]bucket, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	buckets := make(map[string]bucket)
+	if len(data) == 0 {
+		return buckets, nil
+	}
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		// a corrupt state file must not block submissions forever
+		return make(map[string]bucket), nil
+	}
+	return buckets, nil
+}
+
+func writeBuckets(f *os.File, buckets map[string]bucket) error {
+	data, err := json.Marshal(buckets)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate state file: %w", err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package ratelimit_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/ratelimit"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func init() {
+	// limiter verifies the jobs with the limiter of the configuration
+	// at the time of the first test
+	jsvs["limiter"] = func() {
+		var limiter ratelimit.Limiter
+		readConfig(&limiter)
+		now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		jsv.Run(false, func() {
+			if limiter.CheckAt(now) {
+				jsv.Accept("")
+			}
+		}, nil)
+	}
+}
+
+var _ = Describe("Ratelimit", func() {
+	var limiter *ratelimit.Limiter
+	var now time.Time
+
+	perMinute := ratelimit.Limit{Submissions: 2, Window: time.Minute}
+
+	BeforeEach(func() {
+		limiter = ratelimit.NewLimiter(filepath.Join(GinkgoT().TempDir(), "state.json"))
+		now = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	It("should allow submissions up to the limit", func() {
+		requests := []ratelimit.Request{{Key: "user:alice", Limit: perMinute}}
+		for i := 0; i < 2; i++ {
+			decision, err := limiter.Take(now, requests)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decision.Allowed).To(BeTrue())
+		}
+		decision, err := limiter.Take(now, requests)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decision.Allowed).To(BeFalse())
+		Expect(decision.Key).To(Equal("user:alice"))
+		Expect(decision.RetryAfter).To(Equal(30 * time.Second))
+	})
+
+	It("should refill the bucket over time", func() {
+		requests := []ratelimit.Request{{Key: "user:alice", Limit: perMinute}}
+		limiter.Take(now, requests)
+		limiter.Take(now, requests)
+		decision, err := limiter.Take(now.Add(30*time.Second), requests)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decision.Allowed).To(BeTrue())
+	})
+
+	It("should not take tokens when one bucket is empty", func() {
+		alice := ratelimit.Request{Key: "user:alice", Limit: perMinute}
+		project := ratelimit.Request{Key: "project:p1", Limit: ratelimit.Limit{Submissions: 1, Window: time.Minute}}
+		decision, _ := limiter.Take(now, []ratelimit.Request{alice, project})
+		Expect(decision.Allowed).To(BeTrue())
+		decision, _ = limiter.Take(now, []ratelimit.Request{alice, project})
+		Expect(decision.Allowed).To(BeFalse())
+		Expect(decision.Key).To(Equal("project:p1"))
+		// alice still has one token left
+		decision, _ = limiter.Take(now, []ratelimit.Request{alice})
+		Expect(decision.Allowed).To(BeTrue())
+	})
+
+	It("should keep the buckets of different users separate", func() {
+		limit := ratelimit.Limit{Submissions: 1, Window: time.Hour}
+		decision, _ := limiter.Take(now, []ratelimit.Request{{Key: "user:alice", Limit: limit}})
+		Expect(decision.Allowed).To(BeTrue())
+		decision, _ = limiter.Take(now, []ratelimit.Request{{Key: "user:bob", Limit: limit}})
+		Expect(decision.Allowed).To(BeTrue())
+	})
+
+	It("should keep partly refilled buckets of long windows", func() {
+		limit := ratelimit.Limit{Submissions: 2, Window: 72 * time.Hour}
+		alice := []ratelimit.Request{{Key: "user:alice", Limit: limit}}
+		limiter.Take(now, alice)
+		limiter.Take(now, alice)
+
+		// the submission of bob removes the buckets which are full
+		later := now.Add(25 * time.Hour)
+		decision, _ := limiter.Take(later, []ratelimit.Request{{Key: "user:bob", Limit: limit}})
+		Expect(decision.Allowed).To(BeTrue())
+		decision, err := limiter.Take(later, alice)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decision.Allowed).To(BeFalse())
+		Expect(decision.RetryAfter).To(Equal(11 * time.Hour))
+	})
+
+	It("should remove refilled buckets from the state file", func() {
+		limiter.Take(now, []ratelimit.Request{{Key: "user:alice", Limit: perMinute}})
+		limiter.Take(now.Add(29*time.Second), []ratelimit.Request{{Key: "user:bob", Limit: perMinute}})
+		data, err := os.ReadFile(limiter.StateFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("user:alice"))
+
+		limiter.Take(now.Add(30*time.Second), []ratelimit.Request{{Key: "user:bob", Limit: perMinute}})
+		data, err = os.ReadFile(limiter.StateFile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).ToNot(ContainSubstring("user:alice"))
+		Expect(string(data)).To(ContainSubstring("user:bob"))
+	})
+
+	Context("verification", func() {
+
+		send := func(user, project string) *jsvserver.JSVResult {
+			job := &jsvserver.JobSpec{Client: "qsub", User: user, CmdName: "job.sh", Params: map[string]string{}}
+			if project != "" {
+				job.Params["P"] = project
+			}
+			return verify("limiter", limiter, job)
+		}
+
+		It("should reject submissions above the limit with RejectWait", func() {
+			limiter.PerUser = ratelimit.Limit{Submissions: 1, Window: time.Hour}
+			limiter.PerProject = perMinute
+
+			Expect(send("alice", "").State).To(Equal("ACCEPT"))
+			result := send("alice", "")
+			Expect(result.State).To(Equal("REJECT_WAIT"))
+			Expect(result.Message).To(Equal("Submission rate limit of 1 jobs per 1h0m0s exceeded for user alice, retry in 1h0m0s"))
+
+			Expect(send("bob", "p1").State).To(Equal("ACCEPT"))
+			Expect(send("carol", "p1").State).To(Equal("ACCEPT"))
+			result = send("dave", "p1")
+			Expect(result.State).To(Equal("REJECT_WAIT"))
+			Expect(result.Message).To(Equal("Submission rate limit of 2 jobs per 1m0s exceeded for project p1, retry in 30s"))
+		})
+
+		It("should not limit jobs when the state file can't be accessed", func() {
+			limiter.StateFile = GinkgoT().TempDir()
+			limiter.PerUser = ratelimit.Limit{Submissions: 1, Window: time.Hour}
+			Expect(send("alice", "").State).To(Equal("ACCEPT"))
+			Expect(send("alice", "").State).To(Equal("ACCEPT"))
+		})
+	})
+})
@@ -0,0 +1,299 @@
+// Package bench measures the latency and throughput of a JSV with a
+// pool of JSVTestServer instances which verify jobs in parallel.
+package bench
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Options configure a benchmark.
+type Options struct {
+	// Workers is the number of JSV processes which verify jobs in
+	// parallel. The default is 1.
+	Workers int
+	// Jobs is the number of jobs to verify. The jobs are repeated
+	// when there are more jobs than job specifications.
+	Jobs int
+	// Duration is the time to verify jobs. Without Jobs and Duration
+	// each job specification is verified once.
+	Duration time.Duration
+	// ClientSide starts a JSV process per job, like qsub does for a
+	// client-side JSV. Otherwise the processes are reused like the
+	// server-side JSV of qmaster.
+	ClientSide bool
+	// ServerOptions are passed to the test servers. The stderr grace
+	// period is disabled unless set here, as it adds to the latency.
+	ServerOptions []jsvserver.Option
+}
+
+// Percentiles of durations.
+type Percentiles struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// Result is the result of a benchmark.
+type Result struct {
+	// JSV is the path of the benchmarked JSV.
+	JSV     string `json:"jsv"`
+	Workers int    `json:"workers"`
+	// Jobs is the number of verified jobs, including the failed ones.
+	Jobs int `json:"jobs"`
+	// Errors is the number of jobs the JSV failed to verify.
+	Errors   int           `json:"errors"`
+	Duration time.Duration `json:"duration"`
+	// Throughput are the verified jobs per second.
+	Throughput float64 `json:"throughput"`
+	// Latency is the time the test server takes to send a job and
+	// read its RESULT. It includes the START handshake of profiles
+	// which send START per job, and the restart of the JSV when the
+	// previous job failed.
+	Latency Percentiles `json:"latency"`
+	// Startup is the time to start a JSV process until STARTED. The
+	// restarts after failures are part of the latency of the next job
+	// instead.
+	Startup Percentiles `json:"startup"`
+	// Starts is the number of started JSV processes, including
+	// restarts after failures.
+	Starts int `json:"starts"`
+	// States are the number of jobs per RESULT state.
+	States map[string]int `json:"states"`
+}
+
+// worker is the measurements of a worker.
+type worker struct {
+	latencies []time.Duration
+	startups  []time.Duration
+	restarts  int
+	errors    int
+	states    map[string]int
+	err       error
+}
+
+// Run runs the benchmark of a JSV with the job specifications.
+func Run(jsvPath string, jobs []*jsvserver.JobSpec, options Options) (*Result, error) {
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no job specifications")
+	}
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	total := options.Jobs
+	if total == 0 && options.Duration == 0 {
+		total = len(jobs)
+	}
+
+	var next int64
+	// nextJob returns the next job or nil when the benchmark is done
+	start := time.Now()
+	nextJob := func() *jsvserver.JobSpec {
+		n := int(atomic.AddInt64(&next, 1) - 1)
+		if total > 0 && n >= total {
+			return nil
+		}
+		if options.Duration > 0 && time.Since(start) >= options.Duration {
+			return nil
+		}
+		return jobs[n%len(jobs)]
+	}
+
+	workers := make([]*worker, options.Workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		workers[i] = &worker{states: make(map[string]int)}
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			if options.ClientSide {
+				w.err = w.runClientSide(jsvPath, options, nextJob)
+			} else {
+				w.err = w.runServerSide(jsvPath, options, nextJob)
+			}
+		}(workers[i])
+	}
+	wg.Wait()
+
+	result := &Result{
+		JSV:      jsvPath,
+		Workers:  options.Workers,
+		Duration: time.Since(start),
+		States:   make(map[string]int),
+	}
+	var latencies, startups []time.Duration
+	for _, w := range workers {
+		if w.err != nil {
+			return nil, w.err
+		}
+		latencies = append(latencies, w.latencies...)
+		startups = append(startups, w.startups...)
+		result.Starts += len(w.startups) + w.restarts
+		result.Errors += w.errors
+		for state, count := range w.states {
+			result.States[state] += count
+		}
+	}
+	result.Jobs = len(latencies)
+	if result.Duration > 0 {
+		result.Throughput = float64(result.Jobs) / result.Duration.Seconds()
+	}
+	result.Latency = PercentilesOf(latencies)
+	result.Startup = PercentilesOf(startups)
+	return result, nil
+}
+
+// newServer creates and starts a test server and measures the start.
+func (w *worker) newServer(jsvPath string, options Options) (*jsvserver.JSVTestServer, error) {
+	serverOptions := append([]jsvserver.Option{
+		jsvserver.WithStderrGrace(0),
+		jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()),
+	}, options.ServerOptions...)
+	server, err := jsvserver.NewJSVTestServer(jsvPath, serverOptions...)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := server.Start(); err != nil {
+		server.Stop()
+		return nil, fmt.Errorf("failed to start JSV: %w", err)
+	}
+	w.startups = append(w.startups, time.Since(start))
+	return server, nil
+}
+
+// send verifies a job and records the latency and the result. The
+// latency includes the restart of the JSV after a failure.
+func (w *worker) send(server *jsvserver.JSVTestServer, job *jsvserver.JobSpec) {
+	start := time.Now()
+	result, err := server.SendJob(job)
+	w.latencies = append(w.latencies, time.Since(start))
+	if err != nil {
+		w.errors++
+		return
+	}
+	w.states[result.State]++
+}
+
+// runServerSide verifies the jobs with one JSV process.
+func (w *worker) runServerSide(jsvPath string, options Options, nextJob func() *jsvserver.JobSpec) error {
+	server, err := w.newServer(jsvPath, options)
+	if err != nil {
+		return err
+	}
+	for job := nextJob(); job != nil; job = nextJob() {
+		w.send(server, job)
+	}
+	w.restarts = server.RestartCount("")
+	server.Stop()
+	return nil
+}
+
+// runClientSide starts a JSV process per job.
+func (w *worker) runClientSide(jsvPath string, options Options, nextJob func() *jsvserver.JobSpec) error {
+	for job := nextJob(); job != nil; job = nextJob() {
+		server, err := w.newServer(jsvPath, options)
+		if err != nil {
+			return err
+		}
+		w.send(server, job)
+		server.Stop()
+	}
+	return nil
+}
+
+// PercentilesOf returns the percentiles of the durations with the
+// nearest-rank method.
+func PercentilesOf(durations []time.Duration) Percentiles {
+	if len(durations) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	rank := func(p float64) time.Duration {
+		n := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(n, 0)]
+	}
+	return Percentiles{
+		Min:  sorted[0],
+		Mean: sum / time.Duration(len(sorted)),
+		P50:  rank(0.50),
+		P95:  rank(0.95),
+		P99:  rank(0.99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// String returns the result as a table.
+func (r *Result) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "JSV:        %s\n", r.JSV)
+	fmt.Fprintf(&b, "Jobs:       %d (%d errors) with %d workers in %v\n", r.Jobs, r.Errors, r.Workers, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Throughput: %.1f jobs/s\n", r.Throughput)
+	fmt.Fprintf(&b, "Latency:    %s\n", r.Latency)
+	fmt.Fprintf(&b, "Startup:    %s (%d starts)\n", r.Startup, r.Starts)
+	states := make([]string, 0, len(r.States))
+	for state, count := range r.States {
+		states = append(states, fmt.Sprintf("%s %d", state, count))
+	}
+	sort.Strings(states)
+	fmt.Fprintf(&b, "States:     %s\n", strings.Join(states, ", "))
+	return b.String()
+}
+
+// String returns the percentiles in one line.
+func (p Percentiles) String() string {
+	return fmt.Sprintf("min %v, mean %v, p50 %v, p95 %v, p99 %v, max %v",
+		p.Min, p.Mean, p.P50, p.P95, p.P99, p.Max)
+}
+
+// Compare returns a table which compares the result of another JSV
+// with a base result. The change is relative to the base.
+func Compare(base, other *Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %14s %14s %9s\n", "", "base", "other", "change")
+	row := func(name string, a, o float64, format func(float64) string) {
+		change := "n/a"
+		if a != 0 {
+			change = fmt.Sprintf("%+.1f%%", (o-a)/a*100)
+		}
+		fmt.Fprintf(&b, "%-16s %14s %14s %9s\n", name, format(a), format(o), change)
+	}
+	duration := func(v float64) string {
+		return time.Duration(v).Round(time.Microsecond).String()
+	}
+	rows := []struct {
+		name string
+		a, o time.Duration
+	}{
+		{"latency p50", base.Latency.P50, other.Latency.P50},
+		{"latency p95", base.Latency.P95, other.Latency.P95},
+		{"latency p99", base.Latency.P99, other.Latency.P99},
+		{"startup p50", base.Startup.P50, other.Startup.P50},
+		{"startup p99", base.Startup.P99, other.Startup.P99},
+	}
+	for _, r := range rows {
+		row(r.name, float64(r.a), float64(r.o), duration)
+	}
+	row("throughput", base.Throughput, other.Throughput, func(v float64) string {
+		return fmt.Sprintf("%.1f/s", v)
+	})
+	row("errors", float64(base.Errors), float64(other.Errors), func(v float64) string {
+		return fmt.Sprintf("%.0f", v)
+	})
+	return b.String()
+}
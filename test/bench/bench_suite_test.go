@@ -0,0 +1,16 @@
+package bench_test
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBench(t *testing.T) {
+	RegisterFailHandler(Fail)
+	log.SetOutput(io.Discard)
+	RunSpecs(t, "Bench Suite")
+}
@@ -0,0 +1,113 @@
+package bench_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/bench"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("Bench", func() {
+
+	var jsv string
+	jobs := []*jsvserver.JobSpec{
+		{Client: "qsub", CmdName: "job.sh", Params: map[string]string{"N": "accept"}},
+		{Client: "qsub", CmdName: "job.sh", Params: map[string]string{"N": "reject"}},
+	}
+
+	BeforeEach(func() {
+		jsv = filepath.Join(GinkgoT().TempDir(), "jsv.sh")
+		Expect(os.WriteFile(jsv, []byte(`#!/bin/sh
+state=ACCEPT
+while read line; do
+  case "$line" in
+    START) echo STARTED; state=ACCEPT ;;
+    "PARAM N reject") state=REJECT ;;
+    BEGIN) echo "RESULT STATE $state" ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`), 0755)).To(Succeed())
+	})
+
+	It("should compute percentiles", func() {
+		var durations []time.Duration
+		for i := 100; i >= 1; i-- {
+			durations = append(durations, time.Duration(i)*time.Millisecond)
+		}
+		Expect(bench.PercentilesOf(durations)).To(Equal(bench.Percentiles{
+			Min:  time.Millisecond,
+			Mean: 50500 * time.Microsecond,
+			P50:  50 * time.Millisecond,
+			P95:  95 * time.Millisecond,
+			P99:  99 * time.Millisecond,
+			Max:  100 * time.Millisecond,
+		}))
+		Expect(bench.PercentilesOf(nil)).To(Equal(bench.Percentiles{}))
+	})
+
+	It("should verify the jobs with a pool of server-side JSVs", func() {
+		result, err := bench.Run(jsv, jobs, bench.Options{Workers: 3, Jobs: 20})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Jobs).To(Equal(20))
+		Expect(result.Errors).To(BeZero())
+		Expect(result.Starts).To(Equal(3))
+		Expect(result.States).To(Equal(map[string]int{"ACCEPT": 10, "REJECT": 10}))
+		Expect(result.Throughput).To(BeNumerically(">", 0))
+		Expect(result.Latency.P99).To(BeNumerically(">=", result.Latency.P50))
+		Expect(result.String()).To(ContainSubstring("States:     ACCEPT 10, REJECT 10"))
+	})
+
+	It("should start a client-side JSV per job", func() {
+		result, err := bench.Run(jsv, jobs, bench.Options{Workers: 2, ClientSide: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Jobs).To(Equal(2))
+		Expect(result.Starts).To(Equal(2))
+	})
+
+	It("should count the restarts of the JSV after failures", func() {
+		crashing := filepath.Join(GinkgoT().TempDir(), "crash.sh")
+		Expect(os.WriteFile(crashing, []byte(`#!/bin/sh
+while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    "PARAM N crash") exit 1 ;;
+    BEGIN) echo "RESULT STATE ACCEPT" ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`), 0755)).To(Succeed())
+		jobs := []*jsvserver.JobSpec{
+			{Client: "qsub", CmdName: "job.sh", Params: map[string]string{"N": "accept"}},
+			{Client: "qsub", CmdName: "job.sh", Params: map[string]string{"N": "crash"}},
+		}
+		result, err := bench.Run(crashing, jobs, bench.Options{Jobs: 4})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Jobs).To(Equal(4))
+		Expect(result.Errors).To(Equal(2))
+		// the JSV is restarted before the third job only
+		Expect(result.Starts).To(Equal(2))
+		Expect(result.States).To(Equal(map[string]int{"ACCEPT": 2}))
+	})
+
+	It("should verify jobs for a duration", func() {
+		result, err := bench.Run(jsv, jobs, bench.Options{Duration: 100 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Jobs).To(BeNumerically(">", 0))
+		Expect(result.Duration).To(BeNumerically(">=", 100*time.Millisecond))
+	})
+
+	It("should compare two results", func() {
+		base := &bench.Result{Throughput: 100, Latency: bench.Percentiles{P50: 10 * time.Millisecond}}
+		other := &bench.Result{Throughput: 150, Latency: bench.Percentiles{P50: 5 * time.Millisecond}}
+		comparison := bench.Compare(base, other)
+		Expect(comparison).To(MatchRegexp(`latency p50 +10ms +5ms +-50.0%`))
+		Expect(comparison).To(MatchRegexp(`throughput +100.0/s +150.0/s +\+50.0%`))
+		Expect(comparison).To(MatchRegexp(`errors +0 +0 +n/a`))
+	})
+})
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/dgruber/jsv/test/conformance"
+	"github.com/dgruber/jsv/test/golden"
+	"github.com/dgruber/jsv/test/jobimport"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func main() {
+	profile := flag.String("profile", "legacy", "qmaster profile which sends the jobs (legacy, sge62, uge8, ocs9)")
+	timeout := flag.Duration("timeout", jsvserver.DefaultTimeout, "time the JSV has to respond")
+	jsonOutput := flag.Bool("json", false, "print the checklist as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <jsv> [job-spec-dir]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Checks that the JSV follows the JSV protocol with the job specifications\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "of the directory, or with built-in jobs. The exit code is 1 when a check fails.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, exists := jsvserver.Profiles()[*profile]
+	if !exists {
+		log.Fatalf("Unknown profile %q, known are %v", *profile, jsvserver.ProfileNames())
+	}
+	var jobs []*jsvserver.JobSpec
+	if flag.NArg() == 2 {
+		imported, err := jobimport.ReadJobSpecs(flag.Arg(1), golden.IsExpected)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, job := range imported {
+			jobs = append(jobs, job.Spec)
+		}
+	}
+
+	report, err := conformance.Run(flag.Arg(0), jobs, conformance.Options{Profile: &p, Timeout: *timeout})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fmt.Print(report)
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
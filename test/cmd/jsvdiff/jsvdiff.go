@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/dgruber/jsv/test/golden"
+	"github.com/dgruber/jsv/test/jobimport"
+	"github.com/dgruber/jsv/test/jsvdiff"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func main() {
+	profile := flag.String("profile", "legacy", "qmaster profile which sends the jobs (legacy, sge62, uge8, ocs9)")
+	timeout := flag.Duration("timeout", jsvserver.DefaultTimeout, "time the JSVs have to respond")
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	verbose := flag.Bool("v", false, "log the protocol of the JSVs")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <jsv> <other-jsv> <job-spec-dir>\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Sends the job specifications to both JSVs and reports the jobs where the\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "RESULT state, the message, or the effective job differ. The exit code is 1\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "when a job differs.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, exists := jsvserver.Profiles()[*profile]
+	if !exists {
+		log.Fatalf("Unknown profile %q, known are %v", *profile, jsvserver.ProfileNames())
+	}
+	jobs, err := jobimport.ReadJobSpecs(flag.Arg(2), golden.IsExpected)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(jobs) == 0 {
+		log.Fatalf("No job specifications found in directory: %s", flag.Arg(2))
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	report, err := jsvdiff.Run(flag.Arg(0), flag.Arg(1), jobs,
+		jsvserver.WithProfile(p), jsvserver.WithTimeout(*timeout))
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fmt.Print(report)
+	}
+	if len(report.Different) > 0 {
+		os.Exit(1)
+	}
+}
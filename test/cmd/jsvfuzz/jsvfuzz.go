@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dgruber/jsv/test/fuzz"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+func main() {
+	runs := flag.Int("runs", 100, "number of generated streams")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the generator, for reproducible runs")
+	timeout := flag.Duration("timeout", 2*time.Second, "time the JSV has to read a stream and to exit")
+	profile := flag.String("profile", "legacy", "qmaster profile which sends the valid parts (legacy, sge62, uge8, ocs9)")
+	maxLine := flag.Int("max-line", 1<<20, "size of huge lines in bytes")
+	minimize := flag.Int("minimize", 100, "maximum number of runs to minimize a failing stream, 0 disables it")
+	jsonOutput := flag.Bool("json", false, "print the failures as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <jsv>\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Sends randomized and malformed streams to the JSV and reports crashes,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "hangs, and responses which are not part of the protocol, with minimized\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "reproducers. The exit code is 1 when the JSV failed.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	p, exists := jsvserver.Profiles()[*profile]
+	if !exists {
+		log.Fatalf("Unknown profile %q, known are %v", *profile, jsvserver.ProfileNames())
+	}
+	report, err := fuzz.Run(flag.Arg(0), fuzz.Options{
+		Runs:         *runs,
+		Seed:         *seed,
+		Timeout:      *timeout,
+		Profile:      &p,
+		MaxLineSize:  *maxLine,
+		MinimizeRuns: *minimize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fmt.Print(report)
+		fmt.Printf("seed %d\n", *seed)
+	}
+	if len(report.Failures) > 0 {
+		os.Exit(1)
+	}
+}
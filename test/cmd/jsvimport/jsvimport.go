@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/dgruber/jsv/test/jobimport"
+)
+
+func main() {
+	outputDir := flag.String("o", "jobspecs", "directory for the job specifications")
+	prefix := flag.String("prefix", "job_", "file name prefix of the job specifications")
+	accounting := flag.Bool("accounting", false, "read Grid Engine accounting files instead of qstat output")
+	since := flag.String("since", "", "import jobs submitted since a date (2006-01-02) or a duration ago (720h)")
+	until := flag.String("until", "", "import jobs submitted before a date (2006-01-02) or a duration ago (24h)")
+	dedup := flag.Bool("dedup", false, "drop jobs with the same job specification")
+	sample := flag.Float64("sample", 0, "fraction of jobs to import (0 imports all)")
+	seed := flag.Int64("seed", 1, "seed of the random sampling")
+	limit := flag.Int("limit", 0, "maximum number of imported jobs per file (0 is unlimited)")
+	grantedQueue := flag.Bool("granted-queue", false, "request the granted queue for jobs without queue request")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <file>...\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Converts saved \"qstat -xml -j\" or \"qstat -j\" output, or accounting files\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "(-accounting), into job specifications for jsvtest.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := jobimport.AccountingOptions{
+		Deduplicate:  *dedup,
+		Sample:       *sample,
+		Seed:         *seed,
+		Limit:        *limit,
+		GrantedQueue: *grantedQueue,
+	}
+	var err error
+	if options.Since, err = parseTime(*since); err != nil {
+		log.Fatalf("Invalid -since: %v", err)
+	}
+	if options.Until, err = parseTime(*until); err != nil {
+		log.Fatalf("Invalid -until: %v", err)
+	}
+
+	var jobs []jobimport.Job
+	for _, file := range flag.Args() {
+		var imported []jobimport.Job
+		if *accounting {
+			var stats jobimport.AccountingStats
+			imported, stats, err = jobimport.ReadAccountingFile(file, options)
+			if err == nil {
+				log.Printf("%s: %d records, %d tasks, %d filtered, %d invalid, %d duplicates, %d dropped",
+					file, stats.Records, stats.Tasks, stats.Filtered, stats.Invalid, stats.Duplicates, stats.Dropped)
+			}
+		} else {
+			imported, err = jobimport.ReadQstatFile(file)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Imported %d jobs from %s", len(imported), file)
+		jobs = append(jobs, imported...)
+	}
+
+	files, err := jobimport.WriteJobSpecs(*outputDir, *prefix, jobs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %d job specifications to %s", len(files), *outputDir)
+}
+
+// parseTime parses a date or a duration before now.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
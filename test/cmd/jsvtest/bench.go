@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/dgruber/jsv/test/bench"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// runBench benchmarks the JSV, and the second JSV when set, with the
+// job specifications of the directory. It returns the exit code.
+func runBench(jsvScript, compareScript, jobSpecDir string, options bench.Options) int {
+	jobs := []*jsvserver.JobSpec{defaultJob()}
+	if jobSpecDir != "" {
+		jobSpecs, err := loadJobSpecs(jobSpecDir)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		jobs = jobs[:0]
+		for i := range jobSpecs {
+			jobs = append(jobs, &jobSpecs[i].Spec)
+		}
+	}
+
+	// the protocol logs of the test servers would dominate the output
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	base, err := bench.Run(jsvScript, jobs, options)
+	if err != nil {
+		fmt.Printf("Benchmark of %s failed: %v\n", jsvScript, err)
+		return 1
+	}
+	fmt.Print(base)
+	if compareScript == "" {
+		return 0
+	}
+
+	other, err := bench.Run(compareScript, jobs, options)
+	if err != nil {
+		fmt.Printf("Benchmark of %s failed: %v\n", compareScript, err)
+		return 1
+	}
+	fmt.Println()
+	fmt.Print(other)
+	fmt.Println()
+	fmt.Print(bench.Compare(base, other))
+	return 0
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/dgruber/jsv/test/convergence"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// checkConvergence submits the corrected jobs again until the JSV
+// makes no changes and reports the jobs for which the JSV is not
+// idempotent. It returns the exit code.
+func checkConvergence(server *jsvserver.JSVTestServer, jobSpecs []jobSpecFile, maxIterations int) int {
+	report := convergence.NewReport()
+	for i := range jobSpecs {
+		name := filepath.Base(jobSpecs[i].Path)
+		report.Add(convergence.Check(server, name, &jobSpecs[i].Spec, maxIterations))
+	}
+	fmt.Print(report)
+	if len(report.Failed()) > 0 {
+		return 1
+	}
+	return 0
+}
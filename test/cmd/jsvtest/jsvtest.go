@@ -1,29 +1,79 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/dgruber/jsv/test/bench"
+	"github.com/dgruber/jsv/test/convergence"
+	"github.com/dgruber/jsv/test/golden"
+	"github.com/dgruber/jsv/test/jobimport"
 	"github.com/dgruber/jsv/test/jsvserver"
+	"github.com/dgruber/jsv/test/report"
 )
 
+// jobSpecFile is a job specification loaded from a file.
+type jobSpecFile struct {
+	Path string
+	Spec jsvserver.JobSpec
+}
+
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	update := flag.Bool("update", false, "write the results of the JSV as expected results")
+	junitFile := flag.String("junit", "", "write a JUnit XML report into the file")
+	jsonFile := flag.String("json", "", "write a JSON report into the file")
+	benchmark := flag.Bool("bench", false, "measure the latency and throughput of the JSV")
+	workers := flag.Int("workers", 1, "number of JSV processes verifying jobs in parallel (-bench)")
+	jobs := flag.Int("jobs", 0, "number of jobs to verify (-bench)")
+	duration := flag.Duration("duration", 0, "time to verify jobs (-bench)")
+	clientSide := flag.Bool("client", false, "start a JSV process per job like qsub (-bench)")
+	compare := flag.String("compare", "", "benchmark a second JSV and compare it with the first (-bench)")
+	converge := flag.Bool("converge", false, "submit corrected jobs again until the JSV makes no changes")
+	maxIterations := flag.Int("max-iterations", convergence.DefaultMaxIterations, "maximum submissions of a job (-converge)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <path-to-jsv-script> [job-spec-dir]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Sends the job specifications (*.json) to the JSV. When a job specification\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "has an expected result (*%s), the result of the JSV is compared with it\n", golden.Suffix)
+		fmt.Fprintf(flag.CommandLine.Output(), "and the exit code is 1 on mismatches.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	// Check for required arguments.
 	// The first argument: path to the JSV script.
 	// The second optional argument: directory with simulated job specifications.
-	if len(os.Args) < 2 {
-		log.Fatalf("Usage: %s <path-to-jsv-script> [job-spec-dir]", os.Args[0])
+	if flag.NArg() < 1 {
+		flag.Usage()
+		return 2
+	}
+
+	jsvScript := flag.Arg(0)
+	if *benchmark {
+		options := bench.Options{
+			Workers:    *workers,
+			Jobs:       *jobs,
+			Duration:   *duration,
+			ClientSide: *clientSide,
+		}
+		return runBench(jsvScript, *compare, flag.Arg(1), options)
 	}
 
-	jsvScript := os.Args[1]
 	server, err := jsvserver.NewJSVTestServer(jsvScript)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		return 1
 	}
-	// Ensure the server is stopped when main exits.
+	// Ensure the server is stopped when run returns.
 	defer func() {
 		if err := server.Stop(); err != nil {
 			log.Println("Error stopping server:", err)
@@ -31,83 +81,150 @@ func main() {
 	}()
 
 	if err := server.Start(); err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		return 1
 	}
 
-	var job *jsvserver.JobSpec
-
 	// If a job specification directory is provided, loading a job
 	// specification from it.
-	if len(os.Args) >= 3 {
-		jobSpecDir := os.Args[2]
-		files, err := os.ReadDir(jobSpecDir)
+	if flag.NArg() >= 2 {
+		jobSpecs, err := loadJobSpecs(flag.Arg(1))
 		if err != nil {
-			log.Fatalf("Failed to read job spec directory %q: %v", jobSpecDir, err)
+			log.Print(err)
+			return 1
 		}
-		if len(files) == 0 {
-			log.Fatalf("No job specifications found in directory: %s", jobSpecDir)
+		if *converge {
+			return checkConvergence(server, jobSpecs, *maxIterations)
 		}
-
-		jobSpecs := make([]jsvserver.JobSpec, 0, len(files))
-
-		// for all json files in the directory, load the job specification
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-			if filepath.Ext(file.Name()) != ".json" {
-				continue
-			}
-			simulatedJobSpecFile := filepath.Join(jobSpecDir, file.Name())
-			log.Printf("Using simulated job specification from file: %s", simulatedJobSpecFile)
-			// Read the job specification file content.
-			data, err := os.ReadFile(simulatedJobSpecFile)
-			if err != nil {
-				log.Fatalf("Failed to read job specification file %q: %v", simulatedJobSpecFile, err)
-			}
-			// Parse the job specification from the file into a JobSpec struct.
-			var jobSpec jsvserver.JobSpec
-			if err := json.Unmarshal(data, &jobSpec); err != nil {
-				log.Fatalf("Failed to parse job specification from file %q: %v", simulatedJobSpecFile, err)
-			}
-			jobSpecs = append(jobSpecs, jobSpec)
+		r := report.New(filepath.Base(filepath.Clean(flag.Arg(1))), jsvScript)
+		code := verify(server, jobSpecs, *update, r)
+		if *update {
+			return code
 		}
-		start := time.Now()
-		for _, jobSpec := range jobSpecs {
-			_, err := server.SendJob(&jobSpec)
-			if err != nil {
-				log.Printf("Job verification failed: %v", err)
+		fmt.Println(r.Summary)
+		if *junitFile != "" {
+			if err := r.WriteFile(*junitFile, (*report.Report).WriteJUnit); err != nil {
+				log.Print(err)
+				return 1
 			}
 		}
-		end := time.Now()
-		log.Printf("Time taken: %v", end.Sub(start))
-	} else {
-		// No job specification directory provided; use the hardcoded job specification.
-		log.Println("No job specification directory provided; using hardcoded job specification")
-		job = &jsvserver.JobSpec{
-			Context: "client",
-			Client:  "qsub",
-			User:    "testuser",
-			Group:   "testgroup",
-			CmdName: "/path/to/script.sh",
-			CmdArgs: 1,
-			Params: map[string]string{
-				"l_hard":  "h_rt=99",
-				"pe_name": "mpi",
-				"pe_min":  "3",
-				"pe_max":  "3",
-				"q_hard":  "long.q",
-			},
-			Environment: map[string]string{
-				"PATH": "/usr/bin:/bin",
-				"USER": "testuser",
-			},
+		if *jsonFile != "" {
+			if err := r.WriteFile(*jsonFile, (*report.Report).WriteJSON); err != nil {
+				log.Print(err)
+				return 1
+			}
 		}
+		return code
+	}
 
-		_, err := server.SendJob(job)
+	// No job specification directory provided; use the hardcoded job specification.
+	log.Println("No job specification directory provided; using hardcoded job specification")
+	job := defaultJob()
+	if *converge {
+		return checkConvergence(server, []jobSpecFile{{Path: "default", Spec: *job}}, *maxIterations)
+	}
+
+	if _, err := server.SendJob(job); err != nil {
+		log.Printf("Job verification failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// defaultJob returns the job specification which is verified when no
+// job specification directory is provided.
+func defaultJob() *jsvserver.JobSpec {
+	return &jsvserver.JobSpec{
+		Context: "client",
+		Client:  "qsub",
+		User:    "testuser",
+		Group:   "testgroup",
+		CmdName: "/path/to/script.sh",
+		CmdArgs: 1,
+		Params: map[string]string{
+			"l_hard":  "h_rt=99",
+			"pe_name": "mpi",
+			"pe_min":  "3",
+			"pe_max":  "3",
+			"q_hard":  "long.q",
+		},
+		Environment: map[string]string{
+			"PATH": "/usr/bin:/bin",
+			"USER": "testuser",
+		},
+	}
+}
+
+// loadJobSpecs loads all job specifications of a directory. Expected
+// results are skipped.
+func loadJobSpecs(jobSpecDir string) ([]jobSpecFile, error) {
+	jobs, err := jobimport.ReadJobSpecs(jobSpecDir, golden.IsExpected)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no job specifications found in directory: %s", jobSpecDir)
+	}
+	jobSpecs := make([]jobSpecFile, 0, len(jobs))
+	for _, job := range jobs {
+		path := filepath.Join(jobSpecDir, job.ID+".json")
+		log.Printf("Using simulated job specification from file: %s", path)
+		jobSpecs = append(jobSpecs, jobSpecFile{Path: path, Spec: *job.Spec})
+	}
+	return jobSpecs, nil
+}
+
+// verify sends the job specifications to the JSV and compares the
+// results with the expected results, which are added to the report.
+// It returns the exit code.
+func verify(server *jsvserver.JSVTestServer, jobSpecs []jobSpecFile, update bool, r *report.Report) int {
+	code := 0
+	start := time.Now()
+	for _, jobSpec := range jobSpecs {
+		name := filepath.Base(jobSpec.Path)
+		jobStart := time.Now()
+		result, err := server.SendJob(&jobSpec.Spec)
+		duration := time.Since(jobStart)
 		if err != nil {
 			log.Printf("Job verification failed: %v", err)
+			fmt.Printf("ERROR %s\n    %v\n", name, err)
+			r.Add(report.NewCase(name, nil, err, duration, false, nil))
+			code = 1
+			continue
 		}
-	}
 
+		expectedPath := golden.ExpectedPath(jobSpec.Path)
+		if update {
+			if err := golden.WriteExpected(expectedPath, golden.FromResult(result)); err != nil {
+				log.Print(err)
+				return 1
+			}
+			fmt.Printf("UPDATED %s\n", name)
+			continue
+		}
+		expected, err := golden.ReadExpected(expectedPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("NOEXPECTED %s (%s %s)\n", name, result.State, result.Message)
+			r.Add(report.NewCase(name, result, nil, duration, false, nil))
+			continue
+		}
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		mismatches := expected.Compare(result)
+		r.Add(report.NewCase(name, result, nil, duration, true, mismatches))
+		if len(mismatches) > 0 {
+			fmt.Printf("FAIL %s\n", name)
+			for _, mismatch := range mismatches {
+				fmt.Printf("    %s\n", mismatch)
+			}
+			code = 1
+			continue
+		}
+		fmt.Printf("PASS %s\n", name)
+	}
+	r.Duration = time.Since(start)
+	log.Printf("Time taken: %v", r.Duration)
+	return code
 }
@@ -0,0 +1,346 @@
+// Package conformance checks that a JSV executable follows the JSV
+// protocol. It drives the JSV line by line, hence it works with any
+// JSV, including the ones not written with the jsv package.
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Checks of the protocol.
+const (
+	Handshake     = "START is answered with STARTED"
+	SendEnv       = "SEND ENV only during START"
+	OneResult     = "exactly one RESULT per BEGIN"
+	ResultState   = "valid RESULT states"
+	ReadOnly      = "no modifications of read-only parameters"
+	EnvExists     = "ENV MOD and DEL only of existing variables"
+	KnownCommands = "only known commands"
+	Quit          = "QUIT terminates the JSV"
+)
+
+// Checks returns the checks in the order they are reported.
+func Checks() []string {
+	return []string{Handshake, SendEnv, OneResult, ResultState, ReadOnly, EnvExists, KnownCommands, Quit}
+}
+
+// Status of a check.
+const (
+	Pass = "PASS"
+	Fail = "FAIL"
+	// Skip is a check which could not run, because an earlier check
+	// failed.
+	Skip = "SKIP"
+)
+
+// validStates are the states of a RESULT.
+var validStates = map[string]bool{
+	"ACCEPT": true, "CORRECT": true, "REJECT": true, "REJECT_WAIT": true,
+}
+
+// Options configure the conformance checks.
+type Options struct {
+	// Profile is the qmaster which sends the jobs. The default is
+	// jsvserver.LegacyProfile.
+	Profile *jsvserver.Profile
+	// Timeout is the time the JSV has to answer START and BEGIN, and
+	// to exit after QUIT. The default is jsvserver.DefaultTimeout.
+	Timeout time.Duration
+	// Quiet is the time to wait for unexpected output after a RESULT.
+	// The default is 100ms.
+	Quiet time.Duration
+}
+
+// Check is the result of a check.
+type Check struct {
+	Name     string   `json:"name"`
+	Status   string   `json:"status"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Report is the checklist of a JSV.
+type Report struct {
+	JSV    string  `json:"jsv"`
+	Checks []Check `json:"checks"`
+}
+
+// Passed returns true when no check failed.
+func (r *Report) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the checklist with the failures of each check.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, check := range r.Checks {
+		fmt.Fprintf(&b, "[%s] %s\n", check.Status, check.Name)
+		for _, failure := range check.Failures {
+			fmt.Fprintf(&b, "       %s\n", failure)
+		}
+	}
+	return b.String()
+}
+
+// DefaultJobs returns jobs which cover the client and the master
+// context, parallel jobs, and the job environment.
+func DefaultJobs() []*jsvserver.JobSpec {
+	return []*jsvserver.JobSpec{
+		{
+			Context: "client", Client: "qsub", User: "testuser", Group: "testgroup",
+			CmdName: "/home/testuser/job.sh", CmdArgs: 1,
+			Params:      map[string]string{"CMDARG0": "input.txt", "N": "job", "l_hard": "h_rt=3600"},
+			Environment: map[string]string{"PATH": "/usr/bin:/bin", "HOME": "/home/testuser"},
+		},
+		{
+			Context: "client", Client: "qsub", User: "testuser", Group: "testgroup",
+			CmdName: "/home/testuser/mpi.sh",
+			Params: map[string]string{
+				"pe_name": "mpi", "pe_min": "4", "pe_max": "8", "q_hard": "all.q",
+				"l_hard": "h_vmem=2G,h_rt=600",
+			},
+			Environment: map[string]string{"PATH": "/usr/bin:/bin"},
+		},
+		{
+			Context: "master", Client: "qrsh", User: "other", Group: "users",
+			CmdName:     "/bin/hostname",
+			Params:      map[string]string{"b": "y", "P": "project"},
+			Environment: map[string]string{"PATH": "/usr/bin:/bin", "DISPLAY": ":0"},
+		},
+	}
+}
+
+// checker runs the checks and collects the failures.
+type checker struct {
+	jsv      *jsvserver.RawJSV
+	options  Options
+	profile  jsvserver.Profile
+	failures map[string][]string
+	ran      map[string]bool
+	// envRequested is set when the JSV sent SEND ENV during START
+	envRequested bool
+}
+
+// Run checks the protocol of the JSV with the jobs, DefaultJobs when
+// there are none.
+func Run(jsvPath string, jobs []*jsvserver.JobSpec, options Options) (*Report, error) {
+	if options.Timeout == 0 {
+		options.Timeout = jsvserver.DefaultTimeout
+	}
+	if options.Quiet == 0 {
+		options.Quiet = 100 * time.Millisecond
+	}
+	if len(jobs) == 0 {
+		jobs = DefaultJobs()
+	}
+	c := &checker{
+		options:  options,
+		profile:  jsvserver.LegacyProfile(),
+		failures: make(map[string][]string),
+		ran:      make(map[string]bool),
+	}
+	if options.Profile != nil {
+		c.profile = *options.Profile
+	}
+
+	jsv, err := jsvserver.StartRaw(jsvPath)
+	if err != nil {
+		return nil, err
+	}
+	c.jsv = jsv
+	defer jsv.Kill()
+
+	c.run(jobs)
+
+	report := &Report{JSV: jsvPath}
+	for _, name := range Checks() {
+		check := Check{Name: name, Status: Skip, Failures: c.failures[name]}
+		switch {
+		case len(check.Failures) > 0:
+			check.Status = Fail
+		case c.ran[name]:
+			check.Status = Pass
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report, nil
+}
+
+func (c *checker) fail(check, format string, args ...interface{}) {
+	c.failures[check] = append(c.failures[check], fmt.Sprintf(format, args...))
+}
+
+// run runs the checks until the JSV can't be used anymore.
+func (c *checker) run(jobs []*jsvserver.JobSpec) {
+	for i, job := range jobs {
+		if !c.start(i + 1) {
+			return
+		}
+		if !c.verify(i+1, job) {
+			return
+		}
+	}
+	c.quit()
+}
+
+// start sends START and reads the lines until STARTED.
+func (c *checker) start(job int) bool {
+	if err := c.jsv.Send("START"); err != nil {
+		c.fail(Handshake, "job %d: failed to send START: %v", job, err)
+		return false
+	}
+	c.envRequested = false
+	deadline := time.Now().Add(c.options.Timeout)
+	for {
+		line, err := c.jsv.Read(time.Until(deadline))
+		if err != nil {
+			c.fail(Handshake, "job %d: no STARTED after START: %v", job, readError(err, c.options.Timeout))
+			return false
+		}
+		command, _, _ := strings.Cut(line, " ")
+		switch {
+		case line == "STARTED":
+			c.ran[Handshake] = true
+			return true
+		case line == "SEND ENV":
+			c.envRequested = true
+		case command == "LOG" || command == "ERROR":
+		default:
+			c.fail(Handshake, "job %d: unexpected %q before STARTED", job, line)
+		}
+	}
+}
+
+// verify sends the job and checks the lines until the RESULT and the
+// lines after it.
+func (c *checker) verify(job int, spec *jsvserver.JobSpec) bool {
+	// the variables the JSV can modify and delete
+	env := make(map[string]bool)
+	if c.envRequested {
+		for name := range c.profile.Job(spec).Environment {
+			env[name] = true
+		}
+	}
+	for _, command := range c.profile.Commands(spec, job, c.envRequested) {
+		if err := c.jsv.Send(command); err != nil {
+			c.fail(OneResult, "job %d: failed to send %q: %v", job, command, err)
+			return false
+		}
+	}
+	if err := c.jsv.Send("BEGIN"); err != nil {
+		c.fail(OneResult, "job %d: failed to send BEGIN: %v", job, err)
+		return false
+	}
+
+	deadline := time.Now().Add(c.options.Timeout)
+	for {
+		line, err := c.jsv.Read(time.Until(deadline))
+		if err != nil {
+			c.fail(OneResult, "job %d: no RESULT after BEGIN: %v", job, readError(err, c.options.Timeout))
+			return false
+		}
+		if c.checkLine(job, line, env) {
+			break
+		}
+	}
+	for _, check := range []string{SendEnv, OneResult, ResultState, ReadOnly, EnvExists, KnownCommands} {
+		c.ran[check] = true
+	}
+
+	// the JSV must wait for the next START
+	for {
+		line, err := c.jsv.Read(c.options.Quiet)
+		if errors.Is(err, jsvserver.ErrNoOutput) {
+			return true
+		}
+		if err != nil {
+			c.fail(OneResult, "job %d: JSV exited after RESULT", job)
+			return false
+		}
+		if strings.HasPrefix(line, "RESULT") {
+			c.fail(OneResult, "job %d: another RESULT after the first: %q", job, line)
+		} else {
+			c.fail(OneResult, "job %d: output after RESULT: %q", job, line)
+		}
+	}
+}
+
+// checkLine checks a line the JSV sent after BEGIN. It returns true
+// for the RESULT.
+func (c *checker) checkLine(job int, line string, env map[string]bool) bool {
+	fields := strings.SplitN(line, " ", 4)
+	switch fields[0] {
+	case "RESULT":
+		if len(fields) < 3 || fields[1] != "STATE" {
+			c.fail(ResultState, "job %d: invalid RESULT: %q", job, line)
+		} else if !validStates[fields[2]] {
+			c.fail(ResultState, "job %d: invalid state %q", job, fields[2])
+		}
+		return true
+	case "PARAM":
+		if len(fields) > 1 && jsvserver.IsReadOnly(fields[1]) {
+			c.fail(ReadOnly, "job %d: %q", job, line)
+		}
+	case "ENV":
+		if len(fields) < 3 {
+			c.fail(KnownCommands, "job %d: invalid ENV: %q", job, line)
+			return false
+		}
+		switch fields[1] {
+		case "ADD":
+			env[fields[2]] = true
+		case "MOD", "DEL":
+			if !env[fields[2]] {
+				c.fail(EnvExists, "job %d: %q of a variable the job does not have", job, line)
+			}
+			if fields[1] == "DEL" {
+				delete(env, fields[2])
+			}
+		default:
+			c.fail(KnownCommands, "job %d: invalid ENV: %q", job, line)
+		}
+	case "SEND":
+		c.fail(SendEnv, "job %d: %q after BEGIN", job, line)
+	case "LOG", "ERROR":
+	default:
+		c.fail(KnownCommands, "job %d: unknown command %q", job, line)
+	}
+	return false
+}
+
+// quit sends QUIT and waits until the JSV exits.
+func (c *checker) quit() {
+	c.ran[Quit] = true
+	if err := c.jsv.Send("QUIT"); err != nil {
+		c.fail(Quit, "failed to send QUIT: %v", err)
+		return
+	}
+	exited, err := c.jsv.Wait(c.options.Timeout)
+	switch {
+	case !exited:
+		c.fail(Quit, "JSV did not exit within %v", c.options.Timeout)
+	case err != nil:
+		c.fail(Quit, "JSV exited with an error: %v", err)
+	}
+}
+
+func readError(err error, timeout time.Duration) string {
+	switch {
+	case errors.Is(err, jsvserver.ErrNoOutput):
+		return fmt.Sprintf("timeout after %v", timeout)
+	case errors.Is(err, io.EOF):
+		return "JSV exited"
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,97 @@
+package conformance_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/conformance"
+)
+
+// script writes a JSV which handles START, BEGIN, and QUIT with the
+// shell commands.
+func script(onStart, onBegin, onQuit string) string {
+	path := filepath.Join(GinkgoT().TempDir(), "jsv.sh")
+	Expect(os.WriteFile(path, []byte(`#!/bin/sh
+while read line; do
+  case "$line" in
+    START) `+onStart+` ;;
+    BEGIN) `+onBegin+` ;;
+    QUIT) `+onQuit+` ;;
+  esac
+done
+`), 0755)).To(Succeed())
+	return path
+}
+
+// statuses returns the status of each check.
+func statuses(report *conformance.Report) map[string]string {
+	s := make(map[string]string)
+	for _, check := range report.Checks {
+		s[check.Name] = check.Status
+	}
+	return s
+}
+
+var _ = Describe("Conformance", func() {
+
+	options := conformance.Options{Timeout: time.Second, Quiet: 50 * time.Millisecond}
+
+	It("should pass a conforming JSV", func() {
+		jsv := script(`echo "SEND ENV"; echo STARTED`,
+			`echo "LOG INFO ok"; echo "ENV MOD PATH /bin"; echo "PARAM P project"; echo "RESULT STATE CORRECT"`,
+			`exit 0`)
+		report, err := conformance.Run(jsv, nil, options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Passed()).To(BeTrue(), report.String())
+		Expect(report.Checks).To(HaveLen(len(conformance.Checks())))
+		for _, check := range report.Checks {
+			Expect(check.Status).To(Equal(conformance.Pass))
+		}
+	})
+
+	It("should report protocol violations", func() {
+		jsv := script(`echo STARTED`,
+			`echo "SEND ENV"; echo "PARAM USER root"; echo "ENV DEL DISPLAY"; echo "HELLO"; echo "RESULT STATE OK"; echo "RESULT STATE ACCEPT"`,
+			`exit 0`)
+		report, err := conformance.Run(jsv, nil, options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Passed()).To(BeFalse())
+		Expect(statuses(report)).To(Equal(map[string]string{
+			conformance.Handshake:     conformance.Pass,
+			conformance.SendEnv:       conformance.Fail,
+			conformance.OneResult:     conformance.Fail,
+			conformance.ResultState:   conformance.Fail,
+			conformance.ReadOnly:      conformance.Fail,
+			conformance.EnvExists:     conformance.Fail,
+			conformance.KnownCommands: conformance.Fail,
+			conformance.Quit:          conformance.Pass,
+		}))
+		Expect(report.String()).To(ContainSubstring(`[FAIL] valid RESULT states
+       job 1: invalid state "OK"
+`))
+		Expect(report.String()).To(ContainSubstring(`job 1: another RESULT after the first: "RESULT STATE ACCEPT"`))
+	})
+
+	It("should skip the checks after a failed handshake", func() {
+		jsv := script(`echo READY`, `echo "RESULT STATE ACCEPT"`, `exit 0`)
+		report, err := conformance.Run(jsv, nil, conformance.Options{Timeout: 200 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(statuses(report)[conformance.Handshake]).To(Equal(conformance.Fail))
+		Expect(statuses(report)[conformance.Quit]).To(Equal(conformance.Skip))
+		Expect(report.Checks[0].Failures).To(Equal([]string{
+			`job 1: unexpected "READY" before STARTED`,
+			"job 1: no STARTED after START: timeout after 200ms",
+		}))
+	})
+
+	It("should detect a JSV which ignores QUIT", func() {
+		jsv := script(`echo STARTED`, `echo "RESULT STATE ACCEPT"`, `true`)
+		report, err := conformance.Run(jsv, nil, conformance.Options{Timeout: 200 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(statuses(report)[conformance.Quit]).To(Equal(conformance.Fail))
+	})
+})
@@ -0,0 +1,256 @@
+// Package convergence checks that a JSV is idempotent: a job which the
+// JSV corrected is submitted again, until the JSV makes no further
+// changes. A JSV which changes its own output has rules which fight
+// each other.
+package convergence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// DefaultMaxIterations is the default number of times a job is
+// submitted.
+const DefaultMaxIterations = 10
+
+// Status of a checked job.
+const (
+	// Idempotent is a job the JSV does not change when it is submitted
+	// a second time.
+	Idempotent = "idempotent"
+	// Converged is a job the JSV changed more than once before it
+	// stopped changing it.
+	Converged = "converged"
+	// Oscillating is a job which the JSV changes back into an earlier
+	// version, which would never converge.
+	Oscillating = "oscillating"
+	// Diverging is a job the JSV still changed after the maximum
+	// number of iterations.
+	Diverging = "diverging"
+	// Rejected is a job the JSV rejected after it corrected it.
+	Rejected = "rejected"
+	// Error is a job the JSV failed to verify.
+	Error = "error"
+)
+
+// Iteration is a submission of the job.
+type Iteration struct {
+	State   string                 `json:"state"`
+	Message string                 `json:"message,omitempty"`
+	Diff    jsvserver.Diff         `json:"diff"`
+	Logs    []jsvserver.LogMessage `json:"logs,omitempty"`
+}
+
+// Result is the result of the check of a job.
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Iterations are the submissions of the job in order.
+	Iterations []Iteration `json:"iterations"`
+	// Oscillating are the parameters and environment variables (as
+	// "ENV name") which were changed back to an earlier value.
+	Oscillating []string `json:"oscillating,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// OK returns true when the JSV is idempotent for the job.
+func (r *Result) OK() bool {
+	return r.Status == Idempotent
+}
+
+// Trace returns the iterations with the modifications and the LOG
+// messages of the JSV, which show the rules that changed the job.
+func (r *Result) Trace() string {
+	var b strings.Builder
+	for i, iteration := range r.Iterations {
+		fmt.Fprintf(&b, "#%d %s", i+1, iteration.State)
+		if iteration.Message != "" {
+			fmt.Fprintf(&b, " %s", iteration.Message)
+		}
+		b.WriteString("\n")
+		if diff := iteration.Diff.String(); diff != "" {
+			for _, line := range strings.Split(diff, "\n") {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+		for _, log := range iteration.Logs {
+			fmt.Fprintf(&b, "    LOG %s %s\n", log.Level, log.Message)
+		}
+	}
+	return b.String()
+}
+
+// Check submits the job to the JSV of the started server, and the
+// corrected job again, until the JSV makes no changes, changes the job
+// back into an earlier version, or maxIterations is reached.
+func Check(server *jsvserver.JSVTestServer, name string, job *jsvserver.JobSpec, maxIterations int) *Result {
+	if maxIterations < 2 {
+		maxIterations = DefaultMaxIterations
+	}
+	result := &Result{Name: name, Status: Diverging}
+	versions := []*jsvserver.JobSpec{job}
+	for i := 0; i < maxIterations; i++ {
+		verified, err := server.SendJob(versions[len(versions)-1])
+		if err != nil {
+			result.Status = Error
+			result.Error = err.Error()
+			return result
+		}
+		result.Iterations = append(result.Iterations, Iteration{
+			State:   verified.State,
+			Message: verified.Message,
+			Diff:    verified.Diff,
+			Logs:    verified.Logs,
+		})
+
+		switch {
+		case verified.Job == nil && i > 0:
+			result.Status = Rejected
+			return result
+		case verified.Job == nil, verified.Diff.IsEmpty():
+			result.Status = Converged
+			if i <= 1 {
+				result.Status = Idempotent
+			}
+			return result
+		}
+
+		// the first version lacks the defaults the profile adds, hence
+		// only the versions of the JSV are compared
+		for _, earlier := range versions[1:] {
+			if jsvserver.DiffJobs(earlier, verified.Job).IsEmpty() {
+				result.Status = Oscillating
+				result.Oscillating = oscillating(append(versions, verified.Job))
+				return result
+			}
+		}
+		versions = append(versions, verified.Job)
+	}
+	return result
+}
+
+// oscillating returns the parameters and environment variables which
+// changed back to an earlier value in the versions of a job.
+func oscillating(versions []*jsvserver.JobSpec) []string {
+	var names []string
+	seen := make(map[string]bool)
+	check := func(name string, value func(*jsvserver.JobSpec) (string, bool)) {
+		type version struct {
+			value  string
+			exists bool
+		}
+		var history []version
+		for _, job := range versions {
+			v, exists := value(job)
+			history = append(history, version{v, exists})
+		}
+		for i := 2; i < len(history); i++ {
+			if history[i] == history[i-1] {
+				continue
+			}
+			for _, earlier := range history[:i-1] {
+				if earlier == history[i] && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	params := make(map[string]bool)
+	env := make(map[string]bool)
+	for _, job := range versions {
+		for name := range job.Params {
+			params[name] = true
+		}
+		for name := range job.Environment {
+			env[name] = true
+		}
+	}
+	for _, name := range sortedKeys(params) {
+		check(name, func(job *jsvserver.JobSpec) (string, bool) {
+			value, exists := job.Params[name]
+			return value, exists
+		})
+	}
+	for _, name := range sortedKeys(env) {
+		check("ENV "+name, func(job *jsvserver.JobSpec) (string, bool) {
+			value, exists := job.Environment[name]
+			return value, exists
+		})
+	}
+	return names
+}
+
+// Report is the result of the check of many jobs.
+type Report struct {
+	Results []*Result `json:"results"`
+	// Counts are the number of jobs per status.
+	Counts map[string]int `json:"counts"`
+}
+
+// NewReport returns an empty report.
+func NewReport() *Report {
+	return &Report{Counts: make(map[string]int)}
+}
+
+// Add adds the result of a job.
+func (r *Report) Add(result *Result) {
+	r.Results = append(r.Results, result)
+	r.Counts[result.Status]++
+}
+
+// Failed returns the results of the jobs for which the JSV is not
+// idempotent.
+func (r *Report) Failed() []*Result {
+	var failed []*Result
+	for _, result := range r.Results {
+		if !result.OK() {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// String returns the trace of each failed job and the counts.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Failed() {
+		fmt.Fprintf(&b, "%s: %s", result.Name, result.Status)
+		if len(result.Oscillating) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(result.Oscillating, ", "))
+		}
+		if result.Error != "" {
+			fmt.Fprintf(&b, ": %s", result.Error)
+		}
+		b.WriteString("\n")
+		for _, line := range strings.Split(strings.TrimSuffix(result.Trace(), "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+	var counts []string
+	for _, status := range []string{Idempotent, Converged, Oscillating, Diverging, Rejected, Error} {
+		if count := r.Counts[status]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", status, count))
+		}
+	}
+	fmt.Fprintf(&b, "%d of %d jobs are not idempotent", len(r.Failed()), len(r.Results))
+	if len(counts) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(counts, ", "))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
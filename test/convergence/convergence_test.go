@@ -0,0 +1,114 @@
+package convergence_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/convergence"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("Convergence", func() {
+
+	var server *jsvserver.JSVTestServer
+
+	// start starts a JSV which knows the q_hard, A, P, and N
+	// parameters of the job and verifies it with the shell commands.
+	start := func(onBegin string) {
+		path := filepath.Join(GinkgoT().TempDir(), "jsv.sh")
+		Expect(os.WriteFile(path, []byte(`#!/bin/sh
+while read line; do
+  case "$line" in
+    START) q=""; a=""; p=""; n=""; echo STARTED ;;
+    "PARAM q_hard "*) q=${line#PARAM q_hard } ;;
+    "PARAM A "*) a=${line#PARAM A } ;;
+    "PARAM P "*) p=${line#PARAM P } ;;
+    "PARAM N "*) n=${line#PARAM N } ;;
+    BEGIN)
+`+onBegin+`
+      ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`), 0755)).To(Succeed())
+		var err error
+		server, err = jsvserver.NewJSVTestServer(path, jsvserver.WithStderrGrace(0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Stop)
+	}
+	job := func() *jsvserver.JobSpec {
+		return &jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh", Params: map[string]string{"N": "x", "q_hard": "all.q"}}
+	}
+
+	It("should accept an idempotent JSV", func() {
+		start(`      if [ -z "$p" ]; then echo "PARAM P default"; echo "RESULT STATE CORRECT"; else echo "RESULT STATE ACCEPT"; fi`)
+		result := convergence.Check(server, "job", job(), 5)
+		Expect(result.Status).To(Equal(convergence.Idempotent))
+		Expect(result.OK()).To(BeTrue())
+		Expect(result.Iterations).To(HaveLen(2))
+	})
+
+	It("should detect a JSV which converges after more than one correction", func() {
+		start(`      if [ -z "$a" ]; then echo "PARAM A account"; echo "RESULT STATE CORRECT"
+      elif [ -z "$p" ]; then echo "PARAM P default"; echo "RESULT STATE CORRECT"
+      else echo "RESULT STATE ACCEPT"; fi`)
+		result := convergence.Check(server, "job", job(), 5)
+		Expect(result.Status).To(Equal(convergence.Converged))
+		Expect(result.Iterations).To(HaveLen(3))
+	})
+
+	It("should submit accepted jobs with modifications again", func() {
+		start(`      if [ -z "$a" ]; then echo "PARAM A account"
+      elif [ -z "$p" ]; then echo "PARAM P default"; fi
+      echo "RESULT STATE ACCEPT"`)
+		result := convergence.Check(server, "job", job(), 5)
+		Expect(result.Status).To(Equal(convergence.Converged))
+		Expect(result.Iterations).To(HaveLen(3))
+	})
+
+	It("should detect oscillating parameters with the rule trace", func() {
+		start(`      if [ "$q" = all.q ]; then echo "LOG INFO rule 1: long.q"; echo "PARAM q_hard long.q"
+      else echo "LOG INFO rule 2: all.q"; echo "PARAM q_hard all.q"; fi
+      echo "RESULT STATE CORRECT"`)
+		result := convergence.Check(server, "job", job(), 10)
+		Expect(result.Status).To(Equal(convergence.Oscillating))
+		Expect(result.Oscillating).To(Equal([]string{"q_hard"}))
+		Expect(result.Iterations).To(HaveLen(3))
+		Expect(result.Trace()).To(Equal(`#1 CORRECT
+    ~PARAM q_hard all.q -> long.q
+    LOG INFO rule 1: long.q
+#2 CORRECT
+    ~PARAM q_hard long.q -> all.q
+    LOG INFO rule 2: all.q
+#3 CORRECT
+    ~PARAM q_hard all.q -> long.q
+    LOG INFO rule 1: long.q
+`))
+
+		report := convergence.NewReport()
+		report.Add(result)
+		report.Add(&convergence.Result{Name: "other", Status: convergence.Idempotent})
+		Expect(report.Failed()).To(HaveLen(1))
+		Expect(report.String()).To(HavePrefix("job: oscillating (q_hard)\n    #1 CORRECT\n"))
+		Expect(report.String()).To(HaveSuffix("1 of 2 jobs are not idempotent (idempotent 1, oscillating 1)\n"))
+	})
+
+	It("should stop a diverging JSV after the maximum iterations", func() {
+		start(`      echo "PARAM N ${n}x"; echo "RESULT STATE CORRECT"`)
+		result := convergence.Check(server, "job", job(), 4)
+		Expect(result.Status).To(Equal(convergence.Diverging))
+		Expect(result.Iterations).To(HaveLen(4))
+	})
+
+	It("should detect a JSV which rejects its own correction", func() {
+		start(`      if [ -z "$p" ]; then echo "PARAM P default"; echo "RESULT STATE CORRECT"
+      else echo "RESULT STATE REJECT project not allowed"; fi`)
+		result := convergence.Check(server, "job", job(), 4)
+		Expect(result.Status).To(Equal(convergence.Rejected))
+		Expect(result.Iterations[1].Message).To(Equal("project not allowed"))
+	})
+})
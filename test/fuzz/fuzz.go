@@ -0,0 +1,467 @@
+// Package fuzz sends randomized and malformed qmaster streams to a JSV
+// executable and reports crashes, hangs, and responses which don't
+// follow the JSV protocol. Failing streams are minimized into small
+// reproducers.
+package fuzz
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Kinds of failures.
+const (
+	// Crash is a JSV which panicked or was killed by a signal.
+	Crash = "crash"
+	// Hang is a JSV which stopped reading its input or did not exit
+	// after its input was closed.
+	Hang = "hang"
+	// NonConforming is a JSV which sent a response the protocol does
+	// not know, or a response without request.
+	NonConforming = "nonconforming"
+)
+
+// Options configure the fuzzing.
+type Options struct {
+	// Runs is the number of generated streams. The default is 100.
+	Runs int
+	// Seed of the generator, the same seed generates the same streams.
+	Seed int64
+	// Timeout is the time the JSV has to read the stream and to exit
+	// after its input was closed. The default is 2s.
+	Timeout time.Duration
+	// Profile is the qmaster which sends the valid parts of the
+	// streams. The default is jsvserver.LegacyProfile.
+	Profile *jsvserver.Profile
+	// MaxLineSize is the size of huge lines. The default is 1MB.
+	MaxLineSize int
+	// MinimizeRuns is the maximum number of runs to minimize a failing
+	// stream. 0 disables the minimization.
+	MinimizeRuns int
+}
+
+// Failure is a stream which made the JSV fail.
+type Failure struct {
+	Kind string `json:"kind"`
+	// Reason is the kind of the failure in more detail, like "panic"
+	// or "unknown response". Failures with the same kind and reason
+	// are reported once.
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+	// Input is the minimized stream which reproduces the failure. The
+	// elements are written as they are; lines end with a newline.
+	Input []string `json:"input"`
+	// Original is the generated stream.
+	Original []string `json:"original"`
+	Output   []string `json:"output,omitempty"`
+	Stderr   []string `json:"stderr,omitempty"`
+}
+
+// same returns true when the failures have the same kind and reason.
+func (f *Failure) same(other *Failure) bool {
+	return other != nil && f.Kind == other.Kind && f.Reason == other.Reason
+}
+
+// Trace returns the reproducer of the failure with the output of the
+// JSV.
+func (f *Failure) Trace() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s): %s\n", f.Kind, f.Reason, f.Detail)
+	fmt.Fprintf(&b, "  input (%d of %d writes):\n", len(f.Input), len(f.Original))
+	for _, chunk := range f.Input {
+		fmt.Fprintf(&b, "    > %s\n", abbreviate(fmt.Sprintf("%q", chunk)))
+	}
+	for _, line := range f.Output {
+		fmt.Fprintf(&b, "    < %s\n", abbreviate(line))
+	}
+	for _, line := range f.Stderr {
+		fmt.Fprintf(&b, "    ! %s\n", abbreviate(line))
+	}
+	return b.String()
+}
+
+func abbreviate(s string) string {
+	if len(s) > 120 {
+		return fmt.Sprintf("%s... (%d bytes)", s[:100], len(s))
+	}
+	return s
+}
+
+// Report is the result of the fuzzing.
+type Report struct {
+	Runs     int        `json:"runs"`
+	Failures []*Failure `json:"failures"`
+	// Counts are the number of failed runs per kind.
+	Counts map[string]int `json:"counts"`
+}
+
+// String returns the reproducer of each failure and the counts.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, failure := range r.Failures {
+		b.WriteString(failure.Trace())
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d runs: %d crashes, %d hangs, %d nonconforming\n",
+		r.Runs, r.Counts[Crash], r.Counts[Hang], r.Counts[NonConforming])
+	return b.String()
+}
+
+// Run sends generated streams to the JSV.
+func Run(jsvPath string, options Options) (*Report, error) {
+	if options.Runs == 0 {
+		options.Runs = 100
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 2 * time.Second
+	}
+	if options.MaxLineSize == 0 {
+		options.MaxLineSize = 1 << 20
+	}
+	profile := jsvserver.LegacyProfile()
+	if options.Profile != nil {
+		profile = *options.Profile
+	}
+
+	random := rand.New(rand.NewSource(options.Seed))
+	report := &Report{Counts: make(map[string]int)}
+	for i := 0; i < options.Runs; i++ {
+		input := Generate(random, profile, options.MaxLineSize)
+		failure, err := Execute(jsvPath, input, options.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		report.Runs++
+		if failure == nil {
+			continue
+		}
+		report.Counts[failure.Kind]++
+
+		known := false
+		for _, f := range report.Failures {
+			known = known || f.same(failure)
+		}
+		if known {
+			continue
+		}
+		failure.Original = input
+		if options.MinimizeRuns > 0 {
+			minimized, err := Minimize(jsvPath, input, failure, options.Timeout, options.MinimizeRuns)
+			if err != nil {
+				return nil, err
+			}
+			failure = minimized
+			failure.Original = input
+		}
+		report.Failures = append(report.Failures, failure)
+	}
+	return report, nil
+}
+
+// Execute sends the stream to a new JSV process, closes the input,
+// and returns the failure, or nil when the JSV handled the stream.
+func Execute(jsvPath string, input []string, timeout time.Duration) (*Failure, error) {
+	jsv, err := jsvserver.StartRaw(jsvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer jsv.Kill()
+
+	// the output is read while the stream is sent, a JSV blocks when
+	// nobody reads its output
+	var mu sync.Mutex
+	var output []string
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		for {
+			line, err := jsv.Read(time.Minute)
+			if errors.Is(err, jsvserver.ErrNoOutput) {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			output = append(output, line)
+			mu.Unlock()
+		}
+	}()
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for _, chunk := range input {
+			// a JSV which exited can't read the remaining stream
+			if jsv.SendRaw([]byte(chunk)) != nil {
+				return
+			}
+		}
+	}()
+
+	failure := func(kind, reason, detail string) *Failure {
+		mu.Lock()
+		defer mu.Unlock()
+		return &Failure{
+			Kind: kind, Reason: reason, Detail: detail,
+			Input:  input,
+			Output: append([]string{}, output...),
+			Stderr: jsv.Stderr(),
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-sent:
+	case <-timer.C:
+		return failure(Hang, "blocked input", fmt.Sprintf("JSV did not read its input within %v", timeout)), nil
+	}
+	jsv.CloseStdin()
+	select {
+	case <-outputDone:
+	case <-timer.C:
+		return failure(Hang, "no exit", fmt.Sprintf("JSV did not exit within %v after its input was closed", timeout)), nil
+	}
+	exited, exitErr := jsv.Wait(timeout)
+	if !exited {
+		return failure(Hang, "no exit", fmt.Sprintf("JSV closed stdout but did not exit within %v", timeout)), nil
+	}
+
+	if reason, detail := crashed(exitErr, jsv.Stderr()); reason != "" {
+		return failure(Crash, reason, detail), nil
+	}
+	if reason, detail := nonConforming(input, output); reason != "" {
+		return failure(NonConforming, reason, detail), nil
+	}
+	return nil, nil
+}
+
+// crashed returns the reason when the JSV panicked or was killed by a
+// signal.
+func crashed(exitErr error, stderr []string) (string, string) {
+	for _, line := range stderr {
+		if strings.HasPrefix(line, "panic:") || strings.HasPrefix(line, "fatal error:") {
+			return "panic", line
+		}
+	}
+	var exitError *exec.ExitError
+	if errors.As(exitErr, &exitError) {
+		if status, ok := exitError.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return "signal", fmt.Sprintf("JSV was killed by signal %v", status.Signal())
+		}
+	}
+	return "", ""
+}
+
+// validStates are the states of a RESULT.
+var validStates = map[string]bool{
+	"ACCEPT": true, "CORRECT": true, "REJECT": true, "REJECT_WAIT": true,
+}
+
+// nonConforming returns the reason when a response of the JSV is not
+// part of the protocol, or is sent without request.
+func nonConforming(input, output []string) (string, string) {
+	var starts, begins int
+	for _, line := range strings.Split(strings.Join(input, ""), "\n") {
+		switch strings.TrimSuffix(line, "\r") {
+		case "START":
+			starts++
+		case "BEGIN":
+			begins++
+		}
+	}
+	var started, results int
+	for _, line := range output {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return "empty response", "JSV sent an empty line"
+		}
+		switch fields[0] {
+		case "STARTED":
+			started++
+		case "RESULT":
+			if len(fields) < 3 || fields[1] != "STATE" || !validStates[fields[2]] {
+				return "invalid RESULT", fmt.Sprintf("JSV sent %q", line)
+			}
+			results++
+		case "SEND":
+			if line != "SEND ENV" {
+				return "unknown response", fmt.Sprintf("JSV sent %q", line)
+			}
+		case "ENV":
+			if len(fields) < 3 || (fields[1] != "ADD" && fields[1] != "MOD" && fields[1] != "DEL") {
+				return "invalid ENV", fmt.Sprintf("JSV sent %q", line)
+			}
+		case "PARAM", "LOG", "ERROR":
+		default:
+			return "unknown response", fmt.Sprintf("JSV sent %q", line)
+		}
+	}
+	if started > starts {
+		return "STARTED without START", fmt.Sprintf("JSV sent %d STARTED for %d START", started, starts)
+	}
+	if results > begins {
+		return "RESULT without BEGIN", fmt.Sprintf("JSV sent %d RESULT for %d BEGIN", results, begins)
+	}
+	return "", ""
+}
+
+// Minimize removes writes from the stream and shortens huge writes as
+// long as the JSV fails in the same way. It runs the JSV at most
+// maxRuns times.
+func Minimize(jsvPath string, input []string, failure *Failure, timeout time.Duration, maxRuns int) (*Failure, error) {
+	runs := 0
+	try := func(candidate []string) (*Failure, error) {
+		runs++
+		got, err := Execute(jsvPath, candidate, timeout)
+		if err != nil || !failure.same(got) {
+			return nil, err
+		}
+		return got, nil
+	}
+
+	current := failure
+	for size := len(input) / 2; size >= 1; size /= 2 {
+		for i := 0; i+size <= len(current.Input) && runs < maxRuns; {
+			candidate := append(append([]string{}, current.Input[:i]...), current.Input[i+size:]...)
+			got, err := try(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if got != nil {
+				current = got
+			} else {
+				i += size
+			}
+		}
+	}
+
+	// shorten the writes which are longer than a usual line
+	for i := 0; i < len(current.Input) && runs < maxRuns; i++ {
+		for len(current.Input[i]) > 80 && runs < maxRuns {
+			chunk := current.Input[i]
+			candidate := append([]string{}, current.Input...)
+			candidate[i] = chunk[:len(chunk)/2]
+			if strings.HasSuffix(chunk, "\n") {
+				candidate[i] += "\n"
+			}
+			got, err := try(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if got == nil {
+				break
+			}
+			current = got
+		}
+	}
+	return current, nil
+}
+
+// Generate returns a stream of one to three jobs with one to three
+// mutations, like truncated lines, unknown commands, binary garbage,
+// PARAM before START, repeated BEGIN, and huge lines.
+func Generate(random *rand.Rand, profile jsvserver.Profile, maxLineSize int) []string {
+	var input []string
+	jobs := 1 + random.Intn(3)
+	for job := 1; job <= jobs; job++ {
+		input = append(input, "START\n")
+		spec := &jsvserver.JobSpec{
+			Client:  "qsub",
+			User:    "user",
+			Group:   "group",
+			CmdName: "job.sh",
+			Params:  map[string]string{"N": "job", "l_hard": "h_rt=60,mem=1G"},
+			Environment: map[string]string{
+				"PATH": "/bin",
+			},
+		}
+		for _, command := range profile.Commands(spec, job, random.Intn(2) == 0) {
+			input = append(input, command+"\n")
+		}
+		input = append(input, "BEGIN\n")
+	}
+	if random.Intn(2) == 0 {
+		input = append(input, "QUIT\n")
+	}
+	for n := 1 + random.Intn(3); n > 0; n-- {
+		input = mutations[random.Intn(len(mutations))](random, input, maxLineSize)
+	}
+	return input
+}
+
+// mutation changes a stream.
+type mutation func(random *rand.Rand, input []string, maxLineSize int) []string
+
+var mutations = []mutation{
+	// truncated line, which is continued by the next one
+	func(random *rand.Rand, input []string, _ int) []string {
+		i := random.Intn(len(input))
+		if len(input[i]) > 1 {
+			input[i] = input[i][:random.Intn(len(input[i])-1)]
+		}
+		return input
+	},
+	// unknown command
+	func(random *rand.Rand, input []string, _ int) []string {
+		commands := []string{"FOO\n", "SHOW ALL\n", "RESULT STATE ACCEPT\n", "STARTED\n", "start\n", "BEGINX\n"}
+		return insert(random, input, commands[random.Intn(len(commands))])
+	},
+	// binary garbage
+	func(random *rand.Rand, input []string, _ int) []string {
+		garbage := make([]byte, 1+random.Intn(64))
+		random.Read(garbage)
+		return insert(random, input, string(garbage)+"\n")
+	},
+	// PARAM before START
+	func(random *rand.Rand, input []string, _ int) []string {
+		return append([]string{"PARAM N early\n"}, input...)
+	},
+	// repeated BEGIN
+	func(random *rand.Rand, input []string, _ int) []string {
+		for i, chunk := range input {
+			if chunk == "BEGIN\n" {
+				return append(input[:i+1], append([]string{"BEGIN\n"}, input[i+1:]...)...)
+			}
+		}
+		return append(input, "BEGIN\n")
+	},
+	// huge line
+	func(random *rand.Rand, input []string, maxLineSize int) []string {
+		return insert(random, input, "PARAM N "+strings.Repeat("x", 1+random.Intn(maxLineSize))+"\n")
+	},
+	// incomplete commands
+	func(random *rand.Rand, input []string, _ int) []string {
+		commands := []string{"PARAM\n", "PARAM \n", "ENV\n", "ENV ADD\n", "ENV MOD X\n", "ENV DEL\n", "\n", "START extra\n"}
+		return insert(random, input, commands[random.Intn(len(commands))])
+	},
+	// dropped or duplicated line
+	func(random *rand.Rand, input []string, _ int) []string {
+		i := random.Intn(len(input))
+		if random.Intn(2) == 0 {
+			return append(input[:i], input[i+1:]...)
+		}
+		return append(input[:i+1], input[i:]...)
+	},
+	// Windows line endings
+	func(random *rand.Rand, input []string, _ int) []string {
+		i := random.Intn(len(input))
+		input[i] = strings.TrimSuffix(input[i], "\n") + "\r\n"
+		return input
+	},
+}
+
+// insert inserts a write at a random position.
+func insert(random *rand.Rand, input []string, chunk string) []string {
+	i := random.Intn(len(input) + 1)
+	return append(input[:i], append([]string{chunk}, input[i:]...)...)
+}
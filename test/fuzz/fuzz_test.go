@@ -0,0 +1,102 @@
+package fuzz_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/fuzz"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// script writes a JSV which answers START and BEGIN, and runs the
+// shell command for any other line which is not a PARAM or ENV.
+func script(onBegin, onUnknown string) string {
+	path := filepath.Join(GinkgoT().TempDir(), "jsv.sh")
+	Expect(os.WriteFile(path, []byte(`#!/bin/sh
+while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN) `+onBegin+` ;;
+    QUIT) exit 0 ;;
+    PARAM*|ENV*|"") ;;
+    *) `+onUnknown+` ;;
+  esac
+done
+`), 0755)).To(Succeed())
+	return path
+}
+
+var _ = Describe("Fuzz", func() {
+
+	options := fuzz.Options{Runs: 20, Seed: 1, Timeout: time.Second, MaxLineSize: 4096}
+
+	It("should generate the same streams for the same seed", func() {
+		profile := jsvserver.LegacyProfile()
+		a := fuzz.Generate(rand.New(rand.NewSource(7)), profile, 64)
+		b := fuzz.Generate(rand.New(rand.NewSource(7)), profile, 64)
+		Expect(a).To(Equal(b))
+		Expect(strings.Join(a, "")).ToNot(BeEmpty())
+	})
+
+	It("should report no failures of a robust JSV", func() {
+		jsv := script(`echo "RESULT STATE ACCEPT"`, `echo "ERROR unknown command"`)
+		report, err := fuzz.Run(jsv, options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Failures).To(BeEmpty(), report.String())
+		Expect(report.Runs).To(Equal(20))
+		Expect(report.String()).To(ContainSubstring("20 runs: 0 crashes, 0 hangs, 0 nonconforming"))
+	})
+
+	It("should report a crash with a minimized reproducer", func() {
+		jsv := script(`echo "RESULT STATE ACCEPT"`, `kill -SEGV $$`)
+		options := options
+		options.MinimizeRuns = 100
+		report, err := fuzz.Run(jsv, options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Counts[fuzz.Crash]).To(BeNumerically(">", 0))
+		Expect(report.Failures).To(HaveLen(1))
+		failure := report.Failures[0]
+		Expect(failure.Kind).To(Equal(fuzz.Crash))
+		Expect(failure.Reason).To(Equal("signal"))
+		Expect(len(failure.Input)).To(BeNumerically("<", len(failure.Original)))
+		Expect(failure.Input).To(HaveLen(1), failure.Trace())
+
+		// the reproducer crashes the JSV again
+		again, err := fuzz.Execute(jsv, failure.Input, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).ToNot(BeNil())
+		Expect(again.Kind).To(Equal(fuzz.Crash))
+	})
+
+	It("should report a JSV which does not exit", func() {
+		jsv := script(`echo "RESULT STATE ACCEPT"`, `exec sleep 10`)
+		failure, err := fuzz.Execute(jsv, []string{"START\n", "FOO\n"}, 200*time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failure).ToNot(BeNil())
+		Expect(failure.Kind).To(Equal(fuzz.Hang))
+		Expect(failure.Output).To(Equal([]string{"STARTED"}))
+	})
+
+	It("should report responses which are not part of the protocol", func() {
+		jsv := script(`echo "RESULT STATE MAYBE"`, `:`)
+		failure, err := fuzz.Execute(jsv, []string{"START\n", "BEGIN\n"}, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failure).ToNot(BeNil())
+		Expect(failure.Kind).To(Equal(fuzz.NonConforming))
+		Expect(failure.Detail).To(ContainSubstring(`"RESULT STATE MAYBE"`))
+
+		jsv = script(`echo "RESULT STATE ACCEPT"; echo "RESULT STATE ACCEPT"`, `:`)
+		failure, err = fuzz.Execute(jsv, []string{"START\n", "BEGIN\n"}, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failure).ToNot(BeNil())
+		Expect(failure.Reason).To(Equal("RESULT without BEGIN"))
+		Expect(failure.Trace()).To(ContainSubstring(`> "BEGIN\n"`))
+	})
+
+})
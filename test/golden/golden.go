@@ -0,0 +1,167 @@
+// Package golden compares the results of a JSV with expected results
+// which are stored next to the job specifications of jsvtest. The
+// expected result of "jobspecs/foo.json" is "jobspecs/foo.expected.json".
+package golden
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Suffix is the file name suffix of expected results.
+const Suffix = ".expected.json"
+
+// Expected is the expected result of a job specification.
+type Expected struct {
+	// State is the expected RESULT state, like ACCEPT or CORRECT.
+	State string `json:"state"`
+	// MessagePattern is a regular expression which must match the
+	// message of the result. It is not checked when empty.
+	MessagePattern string `json:"message_pattern,omitempty"`
+	// Modifications are the expected modifications of the JSV.
+	Modifications jsvserver.Diff `json:"modifications"`
+	// Logs are the expected LOG lines in the order of the JSV.
+	Logs []ExpectedLog `json:"logs,omitempty"`
+}
+
+// ExpectedLog is an expected LOG line.
+type ExpectedLog struct {
+	Level string `json:"level"`
+	// Pattern is a regular expression which must match the message.
+	Pattern string `json:"pattern"`
+}
+
+// ExpectedPath returns the path of the expected result of a job
+// specification file.
+func ExpectedPath(specPath string) string {
+	return strings.TrimSuffix(specPath, ".json") + Suffix
+}
+
+// IsExpected returns true when the file name is an expected result
+// and not a job specification.
+func IsExpected(name string) bool {
+	return strings.HasSuffix(name, Suffix)
+}
+
+// FromResult returns the expected result which matches exactly the
+// given result. The patterns are anchored literals, which can be
+// relaxed by editing the file.
+func FromResult(result *jsvserver.JSVResult) *Expected {
+	e := &Expected{
+		State:          result.State,
+		MessagePattern: "^" + regexp.QuoteMeta(result.Message) + "$",
+		Modifications:  result.Diff,
+	}
+	for _, log := range result.Logs {
+		e.Logs = append(e.Logs, ExpectedLog{
+			Level:   log.Level,
+			Pattern: "^" + regexp.QuoteMeta(log.Message) + "$",
+		})
+	}
+	return e
+}
+
+// ReadExpected reads an expected result. The error wraps
+// fs.ErrNotExist when the file does not exist.
+func ReadExpected(path string) (*Expected, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected result: %w", err)
+	}
+	var e Expected
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse expected result %s: %w", path, err)
+	}
+	patterns := []string{e.MessagePattern}
+	for _, log := range e.Logs {
+		patterns = append(patterns, log.Pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern in expected result %s: %w", path, err)
+		}
+	}
+	return &e, nil
+}
+
+// WriteExpected writes an expected result.
+func WriteExpected(path string, e *Expected) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal expected result: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write expected result: %w", err)
+	}
+	return nil
+}
+
+// Compare compares the result of the JSV with the expected result and
+// returns a readable line per mismatch. The result matches when no
+// lines are returned.
+func (e *Expected) Compare(result *jsvserver.JSVResult) []string {
+	var mismatches []string
+	if result.State != e.State {
+		mismatches = append(mismatches, fmt.Sprintf("state: expected %s, got %s", e.State, result.State))
+	}
+	if e.MessagePattern != "" && !matches(e.MessagePattern, result.Message) {
+		mismatches = append(mismatches, fmt.Sprintf("message: %q does not match %q", result.Message, e.MessagePattern))
+	}
+
+	expected := lines(e.Modifications.String())
+	actual := lines(result.Diff.String())
+	for _, line := range expected {
+		if !contains(actual, line) {
+			mismatches = append(mismatches, "missing modification: "+line)
+		}
+	}
+	for _, line := range actual {
+		if !contains(expected, line) {
+			mismatches = append(mismatches, "unexpected modification: "+line)
+		}
+	}
+
+	for i, log := range e.Logs {
+		if i >= len(result.Logs) {
+			mismatches = append(mismatches, fmt.Sprintf("missing log: %s %s", log.Level, log.Pattern))
+			continue
+		}
+		got := result.Logs[i]
+		if !strings.EqualFold(got.Level, log.Level) || !matches(log.Pattern, got.Message) {
+			mismatches = append(mismatches, fmt.Sprintf("log %d: %s %q does not match %s %q",
+				i+1, got.Level, got.Message, log.Level, log.Pattern))
+		}
+	}
+	for _, got := range result.Logs[min(len(e.Logs), len(result.Logs)):] {
+		mismatches = append(mismatches, fmt.Sprintf("unexpected log: %s %s", got.Level, got.Message))
+	}
+	return mismatches
+}
+
+// matches returns true when the pattern matches the value. An invalid
+// pattern matches nothing, ReadExpected rejects them.
+func matches(pattern, value string) bool {
+	re, err := regexp.Compile(pattern)
+	return err == nil && re.MatchString(value)
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
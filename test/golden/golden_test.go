@@ -0,0 +1,82 @@
+package golden_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/golden"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("Golden", func() {
+
+	var result *jsvserver.JSVResult
+
+	BeforeEach(func() {
+		result = &jsvserver.JSVResult{
+			State:   "CORRECT",
+			Message: "runtime (h_rt) added",
+			Logs: []jsvserver.LogMessage{
+				{Level: "INFO", Message: "no runtime requested"},
+			},
+			Diff: jsvserver.Diff{
+				AddedParams:   map[string]string{"l_hard": "h_rt=3600"},
+				ChangedParams: map[string]jsvserver.ValueChange{"q_hard": {Old: "all.q", New: "long.q"}},
+			},
+		}
+	})
+
+	It("should name the expected results after the job specifications", func() {
+		Expect(golden.ExpectedPath("jobspecs/job1.json")).To(Equal("jobspecs/job1.expected.json"))
+		Expect(golden.IsExpected("job1.expected.json")).To(BeTrue())
+		Expect(golden.IsExpected("job1.json")).To(BeFalse())
+	})
+
+	It("should match the result it was created from", func() {
+		expected := golden.FromResult(result)
+		Expect(expected.MessagePattern).To(Equal(`^runtime \(h_rt\) added$`))
+		Expect(expected.Compare(result)).To(BeEmpty())
+	})
+
+	It("should report the mismatches", func() {
+		expected := golden.FromResult(result)
+		expected.State = "ACCEPT"
+		expected.MessagePattern = "^accepted"
+		expected.Modifications.AddedParams = map[string]string{"l_hard": "h_rt=600"}
+		expected.Logs = append(expected.Logs, golden.ExpectedLog{Level: "WARNING", Pattern: "quota"})
+
+		Expect(expected.Compare(result)).To(Equal([]string{
+			"state: expected ACCEPT, got CORRECT",
+			`message: "runtime (h_rt) added" does not match "^accepted"`,
+			"missing modification: +PARAM l_hard h_rt=600",
+			"unexpected modification: +PARAM l_hard h_rt=3600",
+			"missing log: WARNING quota",
+		}))
+
+		expected = golden.FromResult(result)
+		expected.Logs = nil
+		expected.MessagePattern = "h_rt"
+		Expect(expected.Compare(result)).To(Equal([]string{
+			"unexpected log: INFO no runtime requested",
+		}))
+	})
+
+	It("should write and read expected results", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "job1.expected.json")
+		_, err := golden.ReadExpected(path)
+		Expect(err).To(MatchError(fs.ErrNotExist))
+
+		Expect(golden.WriteExpected(path, golden.FromResult(result))).To(Succeed())
+		expected, err := golden.ReadExpected(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expected).To(Equal(golden.FromResult(result)))
+
+		Expect(os.WriteFile(path, []byte(`{"state": "ACCEPT", "message_pattern": "("}`), 0644)).To(Succeed())
+		_, err = golden.ReadExpected(path)
+		Expect(err).To(MatchError(ContainSubstring("invalid pattern")))
+	})
+})
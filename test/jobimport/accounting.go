@@ -0,0 +1,375 @@
+package jobimport
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Fields of the colon separated accounting file. See accounting(5).
+const (
+	acctQname          = 0
+	acctGroup          = 2
+	acctOwner          = 3
+	acctJobName        = 4
+	acctJobNumber      = 5
+	acctAccount        = 6
+	acctPriority       = 7
+	acctSubmissionTime = 8
+	acctProject        = 31
+	acctGrantedPE      = 33
+	acctSlots          = 34
+	acctCategory       = 39
+	// acctFields is the number of fields of SGE 6.2 accounting
+	// records (up to ar_submission_time).
+	acctFields = 45
+)
+
+// AccountingOptions select the jobs which are imported from the
+// accounting file.
+type AccountingOptions struct {
+	// Since and Until limit the submission time of the jobs. Zero
+	// values do not limit the submission time.
+	Since time.Time
+	Until time.Time
+	// Deduplicate drops jobs which have the same job specification
+	// as a previously imported job.
+	Deduplicate bool
+	// Sample is the fraction (0 < Sample < 1) of jobs which are kept.
+	// All jobs are kept when it is 0.
+	Sample float64
+	// Seed initializes the random sampling.
+	Seed int64
+	// Limit is the maximum number of jobs. 0 means no limit.
+	Limit int
+	// GrantedQueue requests the queue the job ran in when the job did
+	// not request a queue.
+	GrantedQueue bool
+}
+
+// AccountingStats are the numbers of records and jobs processed by
+// ReadAccounting.
+type AccountingStats struct {
+	// Records is the number of accounting records.
+	Records int
+	// Tasks is the number of records of already imported jobs (array
+	// tasks and parallel tasks).
+	Tasks int
+	// Filtered is the number of jobs outside of the time range.
+	Filtered int
+	// Invalid is the number of records which could not be converted.
+	Invalid int
+	// Duplicates is the number of jobs dropped by deduplication.
+	Duplicates int
+	// Dropped is the number of jobs dropped by sampling or the limit.
+	Dropped int
+	// Jobs is the number of imported jobs.
+	Jobs int
+}
+
+// record is a finished job of the accounting file.
+type record struct {
+	jobNumber      string
+	qname          string
+	owner          string
+	group          string
+	jobName        string
+	account        string
+	project        string
+	priority       string
+	submissionTime time.Time
+	grantedPE      string
+	slots          string
+	category       string
+	submitCommand  string
+}
+
+// ReadAccountingFile reads the jobs of an accounting file.
+func ReadAccountingFile(path string, options AccountingOptions) ([]Job, AccountingStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, AccountingStats{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	jobs, stats, err := ReadAccounting(f, options)
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return jobs, stats, nil
+}
+
+// ReadAccounting converts the records of a Grid Engine accounting file
+// into jobs. It supports the colon separated format of SGE 6.2 and
+// its successors (including the additional fields of Univa Grid
+// Engine, which also reports times in milliseconds) and the JSON line
+// format of Open Cluster Scheduler. Records of array tasks and
+// parallel tasks are imported once per job.
+//
+// When the record contains the submit command line (UGE, OCS), it is
+// parsed like a qsub command line. Otherwise the job specification is
+// built from the category (the resource requests of the job), the
+// owner, group, project, and the granted parallel environment.
+func ReadAccounting(r io.Reader, options AccountingOptions) ([]Job, AccountingStats, error) {
+	var stats AccountingStats
+	var jobs []Job
+	random := rand.New(rand.NewSource(options.Seed))
+	imported := make(map[string]bool)
+	specs := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		stats.Records++
+		var rec *record
+		var err error
+		if strings.HasPrefix(line, "{") {
+			rec, err = parseJSONRecord(line)
+		} else {
+			rec, err = parseRecord(line)
+		}
+		if err != nil {
+			stats.Invalid++
+			continue
+		}
+		if imported[rec.jobNumber] {
+			stats.Tasks++
+			continue
+		}
+		imported[rec.jobNumber] = true
+
+		if (!options.Since.IsZero() && rec.submissionTime.Before(options.Since)) ||
+			(!options.Until.IsZero() && !rec.submissionTime.Before(options.Until)) {
+			stats.Filtered++
+			continue
+		}
+		spec, err := rec.spec(options.GrantedQueue)
+		if err != nil {
+			stats.Invalid++
+			continue
+		}
+		if options.Deduplicate {
+			key := spec.User + " " + spec.Group + " " + spec.CommandLine()
+			if specs[key] {
+				stats.Duplicates++
+				continue
+			}
+			specs[key] = true
+		}
+		if options.Sample > 0 && options.Sample < 1 && random.Float64() >= options.Sample {
+			stats.Dropped++
+			continue
+		}
+		if options.Limit > 0 && len(jobs) >= options.Limit {
+			stats.Dropped++
+			continue
+		}
+		jobs = append(jobs, Job{ID: rec.jobNumber, Spec: spec})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, stats, fmt.Errorf("failed to read accounting file: %w", err)
+	}
+	stats.Jobs = len(jobs)
+	return jobs, stats, nil
+}
+
+// parseRecord parses a colon separated accounting record. The category
+// and the fields of newer versions (cwd, submit_cmd) can contain
+// colons, hence the end of the category is found by the types of the
+// following fields (iow, pe_taskid, maxvmem, arid).
+func parseRecord(line string) (*record, error) {
+	fields := strings.Split(line, ":")
+	if len(fields) < acctFields {
+		return nil, fmt.Errorf("record has %d fields, expected at least %d", len(fields), acctFields)
+	}
+	end := -1
+	for i := acctCategory; i+4 < len(fields); i++ {
+		if isNumber(fields[i]) && (fields[i+1] == "NONE" || strings.Contains(fields[i+1], ".")) &&
+			isNumber(fields[i+2]) && isNumber(fields[i+3]) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, fmt.Errorf("failed to find the end of the category")
+	}
+	submitted, err := epochTime(fields[acctSubmissionTime])
+	if err != nil {
+		return nil, err
+	}
+	rec := &record{
+		jobNumber:      fields[acctJobNumber],
+		qname:          fields[acctQname],
+		owner:          fields[acctOwner],
+		group:          fields[acctGroup],
+		jobName:        fields[acctJobName],
+		account:        fields[acctAccount],
+		project:        fields[acctProject],
+		priority:       fields[acctPriority],
+		submissionTime: submitted,
+		grantedPE:      fields[acctGrantedPE],
+		slots:          fields[acctSlots],
+		category:       strings.Join(fields[acctCategory:end], ":"),
+	}
+	// UGE: ar_submission_time, job_class, qdel_info, maxrss, maxpss,
+	// submit_host, cwd, submit_cmd, wallclock, ioops
+	if submitCmd := end + 11; submitCmd < len(fields)-2 {
+		rec.submitCommand = strings.Join(fields[submitCmd:len(fields)-2], ":")
+	}
+	return rec, nil
+}
+
+// parseJSONRecord parses an accounting record of Open Cluster
+// Scheduler.
+func parseJSONRecord(line string) (*record, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &values); err != nil {
+		return nil, err
+	}
+	get := func(name string) string {
+		switch v := values[name].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	}
+	if get("job_number") == "" {
+		return nil, fmt.Errorf("record without job_number")
+	}
+	submitted, err := epochTime(get("submission_time"))
+	if err != nil {
+		return nil, err
+	}
+	submitCommand := get("submit_cmd_line")
+	if submitCommand == "" {
+		submitCommand = get("submit_cmd")
+	}
+	return &record{
+		jobNumber:      get("job_number"),
+		qname:          get("qname"),
+		owner:          get("owner"),
+		group:          get("group"),
+		jobName:        get("job_name"),
+		account:        get("account"),
+		project:        get("project"),
+		priority:       get("priority"),
+		submissionTime: submitted,
+		grantedPE:      get("granted_pe"),
+		slots:          get("slots"),
+		category:       get("category"),
+		submitCommand:  submitCommand,
+	}, nil
+}
+
+// spec converts the record into a job specification.
+func (r *record) spec(grantedQueue bool) (*jsvserver.JobSpec, error) {
+	if client := strings.Fields(r.submitCommand); len(client) > 0 && isClient(client[0]) {
+		spec, err := jsvserver.ParseCommandLine(r.submitCommand, nil)
+		if err == nil {
+			spec.User = r.owner
+			spec.Group = r.group
+			return spec, nil
+		}
+		// fall back to the category
+	}
+
+	s := newSubmission()
+	s.user = r.owner
+	s.group = r.group
+	s.options = categoryOptions(r.category)
+	s.add("-N", r.jobName)
+	if r.account != "sge" {
+		s.add("-A", r.account)
+	}
+	if !hasOption(s.options, "-P") {
+		s.add("-P", r.project)
+	}
+	if r.priority != "0" {
+		s.add("-p", r.priority)
+	}
+	if !hasOption(s.options, "-pe") && r.grantedPE != "NONE" {
+		s.add("-pe", r.grantedPE, r.slots)
+	}
+	if grantedQueue && !hasOption(s.options, "-q") {
+		queue, _, _ := strings.Cut(r.qname, "@")
+		s.add("-q", queue)
+	}
+	// the job script is not accounted, the job name defaults to it
+	s.script = r.jobName
+	return s.spec()
+}
+
+// categoryOptions returns the qsub options of a job category like
+// "-U deadlineusers -l h_rt=3600 -pe mpi 8-16". Access lists (-u, -U)
+// are not qsub options and are removed.
+func categoryOptions(category string) []string {
+	var options []string
+	fields := strings.Fields(category)
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "-u" || fields[i] == "-U" {
+			i++
+			continue
+		}
+		options = append(options, fields[i])
+	}
+	if len(options) > 0 && options[0] == "NONE" {
+		return nil
+	}
+	return options
+}
+
+// hasOption returns true when the option is in the hard or soft part
+// of the options.
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isClient(name string) bool {
+	switch name {
+	case "qsub", "qrsh", "qlogin", "qsh":
+		return true
+	}
+	return false
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// epochTime converts seconds or milliseconds (UGE) since the epoch
+// into a time.
+func epochTime(value string) (time.Time, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	seconds := int64(n)
+	switch {
+	case seconds > 100000000000000:
+		// microseconds (OCS)
+		return time.UnixMicro(seconds), nil
+	case seconds > 100000000000:
+		// milliseconds (UGE)
+		return time.UnixMilli(seconds), nil
+	}
+	return time.Unix(seconds, 0), nil
+}
@@ -0,0 +1,89 @@
+package jobimport_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jobimport"
+)
+
+var _ = Describe("Accounting", func() {
+
+	ids := func(jobs []jobimport.Job) []string {
+		var result []string
+		for _, job := range jobs {
+			result = append(result, job.ID)
+		}
+		return result
+	}
+
+	It("should import the jobs of all accounting formats", func() {
+		jobs, stats, err := jobimport.ReadAccountingFile("testdata/accounting", jobimport.AccountingOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ids(jobs)).To(Equal([]string{"100", "101", "102", "103", "104"}))
+		Expect(stats).To(Equal(jobimport.AccountingStats{Records: 7, Tasks: 1, Invalid: 1, Jobs: 5}))
+
+		Expect(jobs[0].Spec.User).To(Equal("alice"))
+		Expect(jobs[0].Spec.Group).To(Equal("staff"))
+		Expect(jobs[0].Spec.CmdName).To(Equal("sim.sh"))
+		Expect(jobs[0].Spec.Params).To(Equal(map[string]string{
+			"N":       "sim.sh",
+			"P":       "physics",
+			"l_hard":  "h_rt=3600,h_vmem=2G",
+			"q_hard":  "long.q",
+			"pe_name": "mpi",
+			"pe_min":  "8",
+			"pe_max":  "16",
+		}))
+		// colons in the category
+		Expect(jobs[1].Spec.Params).To(Equal(map[string]string{
+			"N":      "hello",
+			"l_hard": "h_rt=1:00:00",
+		}))
+		// submit command line of UGE
+		Expect(jobs[3].Spec.CommandLine()).To(Equal("qsub -N uge -P bio -l h_rt=1:00:00 job.sh"))
+		Expect(jobs[3].Spec.User).To(Equal("carol"))
+		// JSON records of OCS
+		Expect(jobs[4].Spec.Params).To(HaveKeyWithValue("pe_name", "smp"))
+		Expect(jobs[4].Spec.Params).To(HaveKeyWithValue("l_hard", "h_rt=600"))
+	})
+
+	It("should filter, deduplicate, and sample the jobs", func() {
+		jobs, stats, err := jobimport.ReadAccountingFile("testdata/accounting", jobimport.AccountingOptions{
+			Since:        time.Unix(1700050000, 0),
+			Deduplicate:  true,
+			GrantedQueue: true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ids(jobs)).To(Equal([]string{"101", "102", "103", "104"}))
+		Expect(stats.Filtered).To(Equal(1))
+		Expect(jobs[0].Spec.Params).To(HaveKeyWithValue("q_hard", "all.q"))
+
+		jobs, stats, err = jobimport.ReadAccountingFile("testdata/accounting", jobimport.AccountingOptions{
+			Deduplicate: true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ids(jobs)).To(Equal([]string{"100", "101", "103", "104"}))
+		Expect(stats.Duplicates).To(Equal(1))
+
+		jobs, stats, err = jobimport.ReadAccountingFile("testdata/accounting", jobimport.AccountingOptions{
+			Limit: 2,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ids(jobs)).To(Equal([]string{"100", "101"}))
+		Expect(stats.Dropped).To(Equal(3))
+
+		sampled, _, err := jobimport.ReadAccountingFile("testdata/accounting", jobimport.AccountingOptions{
+			Sample: 0.5, Seed: 42,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		again, _, err := jobimport.ReadAccountingFile("testdata/accounting", jobimport.AccountingOptions{
+			Sample: 0.5, Seed: 42,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(sampled)).To(BeNumerically("<", 5))
+		Expect(ids(again)).To(Equal(ids(sampled)))
+	})
+})
@@ -0,0 +1,129 @@
+// Package jobimport converts real Grid Engine jobs into job
+// specifications which can be sent to a JSV with the jsvserver
+// package or the jsvtest command.
+//
+// The jobs are converted into the qsub options which would have
+// created them. The options are parsed with jsvserver.ParseArgs, hence
+// the imported job specifications contain the same JSV parameters as
+// job specifications created from a qsub command line.
+package jobimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Job is an imported job.
+type Job struct {
+	// ID is the job number.
+	ID string
+	// Spec is the job specification which qmaster would send to a
+	// JSV when the job is submitted again.
+	Spec *jsvserver.JobSpec
+}
+
+// submission collects the qsub command line and the submit
+// environment of a job.
+type submission struct {
+	client  string
+	user    string
+	group   string
+	options []string
+	script  string
+	args    []string
+	env     map[string]string
+}
+
+func newSubmission() *submission {
+	return &submission{client: "qsub", env: make(map[string]string)}
+}
+
+// add adds a qsub option with its arguments when the value is set.
+func (s *submission) add(option, value string, extra ...string) {
+	if value == "" || strings.EqualFold(value, "NONE") {
+		return
+	}
+	s.options = append(s.options, option, value)
+	s.options = append(s.options, extra...)
+}
+
+// flag adds a qsub option without argument.
+func (s *submission) flag(option string, enabled bool) {
+	if enabled {
+		s.options = append(s.options, option)
+	}
+}
+
+// spec converts the submission into a job specification.
+func (s *submission) spec() (*jsvserver.JobSpec, error) {
+	argv := append([]string{s.client}, s.options...)
+	if s.script != "" {
+		argv = append(argv, s.script)
+		argv = append(argv, s.args...)
+	}
+	spec, err := jsvserver.ParseArgs(argv, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert job: %w", err)
+	}
+	spec.User = s.user
+	spec.Group = s.group
+	for key, value := range s.env {
+		spec.Environment[key] = value
+	}
+	return spec, nil
+}
+
+// WriteJobSpecs writes each job as "<prefix><id>.json" into the
+// directory, which is created when it does not exist. It returns the
+// names of the written files.
+func WriteJobSpecs(dir, prefix string, jobs []Job) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	files := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		data, err := json.MarshalIndent(job.Spec, "", "  ")
+		if err != nil {
+			return files, fmt.Errorf("failed to encode job %s: %w", job.ID, err)
+		}
+		file := filepath.Join(dir, prefix+job.ID+".json")
+		if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			return files, fmt.Errorf("failed to write job %s: %w", job.ID, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// ReadJobSpecs reads the job specifications (*.json) of a directory,
+// like the ones written by WriteJobSpecs, in the order of the file
+// names. The ID of a job is the file name without ".json". Files for
+// which skip returns true are not read; skip may be nil.
+func ReadJobSpecs(dir string, skip func(name string) bool) ([]Job, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	var jobs []Job
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" || (skip != nil && skip(name)) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job specification: %w", err)
+		}
+		var spec jsvserver.JobSpec
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("failed to parse job specification %s: %w", name, err)
+		}
+		jobs = append(jobs, Job{ID: strings.TrimSuffix(name, ".json"), Spec: &spec})
+	}
+	return jobs, nil
+}
@@ -0,0 +1,13 @@
+package jobimport_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestJobimport(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Jobimport Suite")
+}
@@ -0,0 +1,582 @@
+package jobimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bits of JB_type.
+const (
+	jobTypeImmediate = 0x01
+	jobTypeQsh       = 0x02
+	jobTypeQlogin    = 0x04
+	jobTypeQrsh      = 0x08
+	jobTypeNoShell   = 0x80
+	jobTypeBinary    = 0x100
+)
+
+// Bits of JB_mail_options.
+var mailOptions = []struct {
+	bit    int64
+	option string
+}{
+	{0x00040000, "a"},
+	{0x00080000, "b"},
+	{0x00100000, "e"},
+	{0x00200000, "n"},
+	{0x00400000, "s"},
+}
+
+// basePriority is added to the priority (-p) of a job.
+const basePriority = 1024
+
+// binding types of BN_type
+var bindingTypes = map[string]string{"1": "pe", "2": "env", "3": "set"}
+
+// verify modes of JB_verify_suitable_queues
+var verifyModes = map[string]string{"1": "e", "2": "w", "3": "v", "4": "p"}
+
+// ReadQstatFile reads the jobs of a file with the output of
+// "qstat -xml -j <ids>" or "qstat -j <ids>".
+func ReadQstatFile(path string) ([]Job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	jobs, err := ReadQstat(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return jobs, nil
+}
+
+// ReadQstat reads the jobs of the output of "qstat -xml -j <ids>" or
+// "qstat -j <ids>". The format is detected from the first character.
+// Multiple jobs and multiple concatenated outputs are supported.
+func ReadQstat(r io.Reader) ([]Job, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if c[0] == ' ' || c[0] == '\t' || c[0] == '\r' || c[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		if c[0] == '<' {
+			return ReadQstatXML(br)
+		}
+		return ReadQstatText(br)
+	}
+}
+
+// ReadQstatXML reads the jobs of the output of "qstat -xml -j <ids>".
+func ReadQstatXML(r io.Reader) ([]Job, error) {
+	root, err := parseXML(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse qstat XML: %w", err)
+	}
+	var jobs []Job
+	for _, element := range root.withChild("JB_job_number") {
+		job, err := xmlJob(element)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// xmlJob converts a job element of qstat -xml -j.
+func xmlJob(e *node) (Job, error) {
+	id := e.value("JB_job_number")
+	s := newSubmission()
+	s.user = e.value("JB_owner")
+	s.group = e.value("JB_group")
+
+	jobType, _ := strconv.ParseInt(e.value("JB_type"), 10, 64)
+	switch {
+	case jobType&jobTypeQrsh != 0:
+		s.client = "qrsh"
+	case jobType&jobTypeQlogin != 0:
+		s.client = "qlogin"
+	case jobType&jobTypeQsh != 0:
+		s.client = "qsh"
+	}
+	if jobType&jobTypeBinary != 0 {
+		s.add("-b", "y")
+	}
+	if jobType&jobTypeNoShell != 0 {
+		s.add("-shell", "n")
+	}
+	if jobType&jobTypeImmediate != 0 {
+		s.add("-now", "y")
+	}
+
+	s.add("-N", e.value("JB_job_name"))
+	s.add("-A", e.value("JB_account"))
+	s.add("-P", e.value("JB_project"))
+	s.add("-ckpt", e.value("JB_checkpoint_name"))
+	s.add("-wd", e.value("JB_cwd"))
+	s.add("-o", e.joined("JB_stdout_path_list", "PN_path"))
+	s.add("-e", e.joined("JB_stderr_path_list", "PN_path"))
+	s.add("-i", e.joined("JB_stdin_path_list", "PN_path"))
+	s.add("-S", e.joined("JB_shell_list", "PN_path"))
+	s.add("-q", e.joined("JB_hard_queue_list", "QR_name"))
+	s.add("-masterq", e.joined("JB_master_hard_queue_list", "QR_name"))
+	s.add("-hold_jid", e.joined("JB_jid_request_list", "JRE_job_name"))
+	s.add("-hold_jid_ad", e.joined("JB_ja_ad_request_list", "JRE_job_name"))
+	s.add("-l", e.requests("JB_hard_resource_list"))
+	if isTrue(e.value("JB_merge_stderr")) {
+		s.add("-j", "y")
+	}
+	s.flag("-notify", isTrue(e.value("JB_notify")))
+	if isTrue(e.value("JB_reserve")) {
+		s.add("-R", "y")
+	}
+	switch e.value("JB_restart") {
+	case "1":
+		s.add("-r", "y")
+	case "2":
+		s.add("-r", "n")
+	}
+	s.add("-w", verifyModes[e.value("JB_verify_suitable_queues")])
+	if js := e.value("JB_jobshare"); js != "0" {
+		s.add("-js", js)
+	}
+	if priority, err := strconv.Atoi(e.value("JB_priority")); err == nil && priority != basePriority {
+		s.add("-p", strconv.Itoa(priority-basePriority))
+	}
+	s.add("-a", epochDate(e.value("JB_execution_time")))
+	s.add("-dl", epochDate(e.value("JB_deadline")))
+
+	var mailUsers []string
+	for _, mail := range e.all("JB_mail_list", "MR_user") {
+		user := mail.text
+		if host := mail.parent.value("MR_host"); host != "" && host != "NONE" {
+			user += "@" + host
+		}
+		mailUsers = append(mailUsers, user)
+	}
+	s.add("-M", strings.Join(mailUsers, ","))
+	if options, err := strconv.ParseInt(e.value("JB_mail_options"), 10, 64); err == nil && options != 0 {
+		m := ""
+		for _, mail := range mailOptions {
+			if options&mail.bit != 0 {
+				m += mail.option
+			}
+		}
+		s.add("-m", m)
+	}
+
+	if pe := e.value("JB_pe"); pe != "" {
+		min := e.first("JB_pe_range", "RN_min")
+		max := e.first("JB_pe_range", "RN_max")
+		slots := min
+		if max != min {
+			slots = min + "-" + max
+		}
+		s.add("-pe", pe, slots)
+	}
+	if min := e.first("JB_ja_structure", "RN_min"); min != "" {
+		max := e.first("JB_ja_structure", "RN_max")
+		step := e.first("JB_ja_structure", "RN_step")
+		if min != "1" || max != "1" {
+			s.add("-t", min+"-"+max+":"+step)
+		}
+	}
+	if binding := xmlBinding(e.child("JB_binding")); binding != nil {
+		s.options = append(s.options, binding...)
+	}
+
+	if soft := e.requests("JB_soft_resource_list"); soft != "" || e.joined("JB_soft_queue_list", "QR_name") != "" {
+		s.options = append(s.options, "-soft")
+		s.add("-l", soft)
+		s.add("-q", e.joined("JB_soft_queue_list", "QR_name"))
+	}
+
+	var context []string
+	for _, variable := range e.all("JB_context", "VA_variable") {
+		context = append(context, variable.text+"="+variable.parent.value("VA_value"))
+	}
+	s.add("-ac", strings.Join(context, ","))
+
+	for _, variable := range e.all("JB_env_list", "VA_variable") {
+		if strings.HasPrefix(variable.text, "__SGE_PREFIX__") {
+			// SGE_O_* variables which are set by qsub
+			continue
+		}
+		s.env[variable.text] = variable.parent.value("VA_value")
+	}
+
+	s.script = e.value("JB_script_file")
+	for _, arg := range e.all("JB_job_args", "ST_name") {
+		s.args = append(s.args, arg.text)
+	}
+	spec, err := s.spec()
+	if err != nil {
+		return Job{}, fmt.Errorf("job %s: %w", id, err)
+	}
+	return Job{ID: id, Spec: spec}, nil
+}
+
+// xmlBinding converts the binding element into a -binding option.
+func xmlBinding(b *node) []string {
+	if b == nil {
+		return nil
+	}
+	strategy := b.find("BN_strategy")
+	if strategy == nil || strategy.text == "" || strategy.text == "no_job_binding" {
+		return nil
+	}
+	binding := strategy.parent
+	amount := binding.value("BN_parameter_n")
+	step := binding.value("BN_parameter_striding_step_size")
+	offset := binding.value("BN_parameter_socket_offset") + "," + binding.value("BN_parameter_core_offset")
+	var value string
+	switch strategy.text {
+	case "linear_automatic":
+		value = "linear:" + amount
+	case "linear":
+		value = "linear:" + amount + ":" + offset
+	case "striding_automatic":
+		value = "striding:" + amount + ":" + step
+	case "striding":
+		value = "striding:" + amount + ":" + step + ":" + offset
+	case "explicit":
+		value = "explicit:" + strings.TrimPrefix(binding.value("BN_parameter_explicit"), "explicit:")
+	default:
+		return nil
+	}
+	bindingType, exists := bindingTypes[binding.value("BN_type")]
+	if !exists {
+		bindingType = "set"
+	}
+	return []string{"-binding", bindingType, value}
+}
+
+// ReadQstatText reads the jobs of the output of "qstat -j <ids>".
+// Jobs are separated by lines of "=" characters.
+func ReadQstatText(r io.Reader) ([]Job, error) {
+	var jobs []Job
+	values := make(map[string]string)
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		job, err := textJob(values)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+		values = make(map[string]string)
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "===") {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if line == "" || line[0] == ' ' || line[0] == '\t' {
+			// continuation lines like scheduling info
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read qstat output: %w", err)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// textJob converts the fields of a job of qstat -j.
+func textJob(v map[string]string) (Job, error) {
+	id := v["job_number"]
+	if id == "" {
+		return Job{}, fmt.Errorf("job without job_number")
+	}
+	s := newSubmission()
+	s.user = v["owner"]
+	s.group = v["group"]
+	s.add("-N", v["job_name"])
+	s.add("-A", v["account"])
+	s.add("-P", v["project"])
+	s.add("-ckpt", v["checkpoint_object"])
+	s.add("-wd", v["cwd"])
+	s.add("-o", textPath(v["stdout_path_list"]))
+	s.add("-e", textPath(v["stderr_path_list"]))
+	s.add("-i", textPath(v["stdin_path_list"]))
+	s.add("-S", textPath(v["shell_list"]))
+	s.add("-q", v["hard_queue_list"])
+	s.add("-masterq", v["master_hard_queue_list"])
+	s.add("-hold_jid", v["jid_predecessor_list (req)"])
+	s.add("-hold_jid_ad", v["jid_ad_predecessor_list (req)"])
+	s.add("-l", v["hard resource_list"])
+	s.add("-M", v["mail_list"])
+	s.add("-m", v["mail_options"])
+	s.add("-j", yesNo(v["merge"]))
+	s.add("-R", yesNo(v["reserve"]))
+	s.add("-r", yesNo(v["restart"]))
+	s.flag("-notify", yesNo(v["notify"]) == "y")
+	if js := v["jobshare"]; js != "0" {
+		s.add("-js", js)
+	}
+	if p := v["priority"]; p != "0" {
+		s.add("-p", p)
+	}
+	s.add("-a", textDate(v["execution_time"]))
+	s.add("-dl", textDate(v["deadline"]))
+	s.add("-ac", v["context"])
+	if pe := v["parallel environment"]; pe != "" {
+		name, slots, _ := strings.Cut(pe, "range:")
+		s.add("-pe", strings.TrimSpace(name), strings.TrimSpace(slots))
+	}
+	if tasks := v["job-array tasks"]; tasks != "" {
+		s.add("-t", tasks)
+	}
+	if binding := strings.Fields(v["binding"]); len(binding) > 0 && binding[0] != "NONE" {
+		s.options = append(s.options, "-binding")
+		s.options = append(s.options, binding...)
+	}
+	if v["soft resource_list"] != "" || v["soft_queue_list"] != "" {
+		s.options = append(s.options, "-soft")
+		s.add("-l", v["soft resource_list"])
+		s.add("-q", v["soft_queue_list"])
+	}
+	for key, value := range splitVariables(v["env_list"]) {
+		s.env[key] = value
+	}
+	s.script = v["script_file"]
+	if args := v["job_args"]; args != "" {
+		s.args = strings.Split(args, ",")
+	}
+	spec, err := s.spec()
+	if err != nil {
+		return Job{}, fmt.Errorf("job %s: %w", id, err)
+	}
+	return Job{ID: id, Spec: spec}, nil
+}
+
+// textPath returns the path of a path list entry like
+// "NONE:host:/path" or "NONE:/path".
+func textPath(value string) string {
+	fields := strings.SplitN(value, ":", 3)
+	if len(fields) == 1 {
+		return value
+	}
+	return fields[len(fields)-1]
+}
+
+// splitVariables splits a variable list like "A=1,B=2". Commas in
+// values are kept when the next element is not a variable assignment.
+func splitVariables(value string) map[string]string {
+	variables := make(map[string]string)
+	last := ""
+	for _, element := range strings.Split(value, ",") {
+		key, v, found := strings.Cut(element, "=")
+		if !found && last != "" {
+			variables[last] += "," + element
+			continue
+		}
+		if key == "" {
+			continue
+		}
+		variables[key] = v
+		last = key
+	}
+	return variables
+}
+
+func isTrue(value string) bool {
+	return strings.EqualFold(value, "true") || value == "1"
+}
+
+func yesNo(value string) string {
+	switch strings.ToLower(value) {
+	case "y", "yes", "true":
+		return "y"
+	case "n", "no", "false":
+		return "n"
+	}
+	return ""
+}
+
+// epochDate converts a time since the epoch into the date format of
+// qsub -a.
+func epochDate(value string) string {
+	t, err := epochTime(value)
+	if err != nil || t.Unix() <= 0 {
+		return ""
+	}
+	return t.Format("200601021504.05")
+}
+
+// textDate converts the dates printed by qstat into the date format
+// of qsub -a.
+func textDate(value string) string {
+	for _, layout := range []string{"Mon Jan _2 15:04:05 2006", "01/02/2006 15:04:05.000", "01/02/2006 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Format("200601021504.05")
+		}
+	}
+	return ""
+}
+
+// node is an element of an XML document.
+type node struct {
+	name     string
+	text     string
+	parent   *node
+	children []*node
+}
+
+// parseXML reads all (possibly concatenated) XML documents of r into
+// the children of a single root node.
+func parseXML(r io.Reader) (*node, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// qstat prints a declaration per document
+	data = bytes.ReplaceAll(data, []byte("<?xml version='1.0'?>"), nil)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := &node{}
+	current := root
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child := &node{name: t.Name.Local, parent: current}
+			current.children = append(current.children, child)
+			current = child
+		case xml.EndElement:
+			current.text = strings.TrimSpace(current.text)
+			current = current.parent
+		case xml.CharData:
+			current.text += string(t)
+		}
+	}
+	return root, nil
+}
+
+// child returns the direct child with the given name.
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// value returns the text of the direct child with the given name.
+func (n *node) value(name string) string {
+	if c := n.child(name); c != nil {
+		return c.text
+	}
+	return ""
+}
+
+// find returns the first descendant with the given name.
+func (n *node) find(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+		if found := c.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// collect appends all descendants with the given name.
+func (n *node) collect(name string, nodes []*node) []*node {
+	for _, c := range n.children {
+		if c.name == name {
+			nodes = append(nodes, c)
+			continue
+		}
+		nodes = c.collect(name, nodes)
+	}
+	return nodes
+}
+
+// all returns the descendants with the given name of the child list.
+func (n *node) all(list, name string) []*node {
+	if c := n.child(list); c != nil {
+		return c.collect(name, nil)
+	}
+	return nil
+}
+
+// first returns the text of the first element of the child list.
+func (n *node) first(list, name string) string {
+	if elements := n.all(list, name); len(elements) > 0 {
+		return elements[0].text
+	}
+	return ""
+}
+
+// joined returns the texts of all elements of the child list as a
+// comma separated list.
+func (n *node) joined(list, name string) string {
+	var values []string
+	for _, element := range n.all(list, name) {
+		values = append(values, element.text)
+	}
+	return strings.Join(values, ",")
+}
+
+// requests returns a resource request list like "h_rt=99,mem=1G".
+func (n *node) requests(list string) string {
+	var requests []string
+	for _, name := range n.all(list, "CE_name") {
+		requests = append(requests, name.text+"="+name.parent.value("CE_stringval"))
+	}
+	return strings.Join(requests, ",")
+}
+
+// withChild returns all descendants which have a child with the given
+// name.
+func (n *node) withChild(name string) []*node {
+	var nodes []*node
+	for _, c := range n.children {
+		if c.child(name) != nil {
+			nodes = append(nodes, c)
+			continue
+		}
+		nodes = append(nodes, c.withChild(name)...)
+	}
+	return nodes
+}
@@ -0,0 +1,100 @@
+package jobimport_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jobimport"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("Qstat", func() {
+
+	expectJobs := func(jobs []jobimport.Job) {
+		Expect(jobs).To(HaveLen(2))
+
+		Expect(jobs[0].ID).To(Equal("4711"))
+		job := jobs[0].Spec
+		Expect(job.Client).To(Equal("qsub"))
+		Expect(job.User).To(Equal("alice"))
+		Expect(job.Group).To(Equal("staff"))
+		Expect(job.CmdName).To(Equal("sim.sh"))
+		Expect(job.CmdArgs).To(Equal(1))
+		Expect(job.Environment).To(Equal(map[string]string{"OMP_NUM_THREADS": "4"}))
+		Expect(job.Params).To(Equal(map[string]string{
+			"N":                "sim",
+			"A":                "sge",
+			"P":                "physics",
+			"j":                "y",
+			"M":                "alice@example.com",
+			"r":                "n",
+			"p":                "-10",
+			"l_hard":           "h_rt=3600,h_vmem=2G",
+			"l_soft":           "arch=lx-amd64",
+			"q_hard":           "long.q,short.q",
+			"pe_name":          "mpi",
+			"pe_min":           "8",
+			"pe_max":           "16",
+			"binding_type":     "set",
+			"binding_strategy": "linear_automatic",
+			"binding_amount":   "2",
+			"CMDARG0":          "input.dat",
+		}))
+
+		Expect(jobs[1].ID).To(Equal("4712"))
+		Expect(jobs[1].Spec.Params).To(HaveKeyWithValue("t_min", "1"))
+		Expect(jobs[1].Spec.Params).To(HaveKeyWithValue("t_max", "100"))
+		Expect(jobs[1].Spec.Params).To(HaveKeyWithValue("t_step", "2"))
+		Expect(jobs[1].Spec.Params).To(HaveKeyWithValue("hold_jid", "4711"))
+	}
+
+	It("should import qstat -xml -j output", func() {
+		jobs, err := jobimport.ReadQstatFile("testdata/qstat.xml")
+		Expect(err).ToNot(HaveOccurred())
+		expectJobs(jobs)
+		// JB_type of a binary qrsh job
+		Expect(jobs[1].Spec.Client).To(Equal("qrsh"))
+		Expect(jobs[1].Spec.Params).To(HaveKeyWithValue("b", "y"))
+	})
+
+	It("should import qstat -j output", func() {
+		jobs, err := jobimport.ReadQstatFile("testdata/qstat.txt")
+		Expect(err).ToNot(HaveOccurred())
+		expectJobs(jobs)
+	})
+
+	It("should write the job specifications as JSON", func() {
+		jobs, err := jobimport.ReadQstatFile("testdata/qstat.txt")
+		Expect(err).ToNot(HaveOccurred())
+		dir := GinkgoT().TempDir()
+		files, err := jobimport.WriteJobSpecs(dir, "job_", jobs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(Equal([]string{filepath.Join(dir, "job_4711.json"), filepath.Join(dir, "job_4712.json")}))
+
+		data, err := os.ReadFile(files[0])
+		Expect(err).ToNot(HaveOccurred())
+		var spec jsvserver.JobSpec
+		Expect(json.Unmarshal(data, &spec)).To(Succeed())
+		Expect(&spec).To(Equal(jobs[0].Spec))
+
+		// skipped files are not read
+		Expect(os.WriteFile(filepath.Join(dir, "job_4711.skip.json"), []byte("{}"), 0644)).To(Succeed())
+		read, err := jobimport.ReadJobSpecs(dir, func(name string) bool {
+			return strings.HasSuffix(name, ".skip.json")
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read).To(HaveLen(2))
+		Expect(read[0].ID).To(Equal("job_4711"))
+		Expect(read[0].Spec).To(Equal(jobs[0].Spec))
+		Expect(read[1].ID).To(Equal("job_4712"))
+
+		read, err = jobimport.ReadJobSpecs(dir, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(read).To(HaveLen(3))
+	})
+})
@@ -0,0 +1,188 @@
+// Package jsvdiff runs two JSVs side by side on the same job
+// specifications and reports the jobs they verify differently. It is
+// used to prove that a rewritten JSV behaves like the original one.
+package jsvdiff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgruber/jsv/test/jobimport"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Categories of differences.
+const (
+	// State is a different RESULT state.
+	State = "state"
+	// Message is a different RESULT message.
+	Message = "message"
+	// Job is a different effective job, which qmaster would store.
+	Job = "job"
+	// Error is a job which only one of the JSVs failed to verify.
+	Error = "error"
+)
+
+// Categories returns the categories in the order of their importance.
+func Categories() []string {
+	return []string{Error, State, Message, Job}
+}
+
+// unorderedParams are parameters with a comma separated list whose
+// order is irrelevant for qmaster.
+var unorderedParams = map[string]bool{
+	"l_hard": true, "l_soft": true, "q_hard": true, "q_soft": true,
+	"masterq": true, "masterl": true, "hold_jid": true, "hold_jid_ad": true,
+	"ac": true, "dc": true, "sc": true, "M": true,
+}
+
+// Difference is a difference of the verification of a job.
+type Difference struct {
+	Category string `json:"category"`
+	// Detail describes the difference from the first to the second
+	// JSV, like "ACCEPT -> REJECT".
+	Detail string `json:"detail"`
+}
+
+// JobDiff are the differences of a job.
+type JobDiff struct {
+	// Name of the job specification.
+	Name        string       `json:"name"`
+	Differences []Difference `json:"differences"`
+}
+
+// Report is the result of a comparison.
+type Report struct {
+	// Jobs is the number of compared jobs.
+	Jobs int `json:"jobs"`
+	// Different are the jobs which were verified differently.
+	Different []JobDiff `json:"different"`
+	// Counts are the number of different jobs per category.
+	Counts map[string]int `json:"counts"`
+}
+
+// Compare returns the differences between the result and error of the
+// first JSV and the result and error of the second JSV. Modifications
+// which only differ in the order of list values are equal.
+func Compare(a *jsvserver.JSVResult, errA error, b *jsvserver.JSVResult, errB error) []Difference {
+	switch {
+	case errA != nil && errB != nil:
+		return nil
+	case errA != nil:
+		return []Difference{{Category: Error, Detail: fmt.Sprintf("%v -> %s", errA, b.State)}}
+	case errB != nil:
+		return []Difference{{Category: Error, Detail: fmt.Sprintf("%s -> %v", a.State, errB)}}
+	}
+
+	var differences []Difference
+	if a.State != b.State {
+		differences = append(differences, Difference{Category: State, Detail: a.State + " -> " + b.State})
+	}
+	if a.Message != b.Message {
+		differences = append(differences, Difference{Category: Message, Detail: fmt.Sprintf("%q -> %q", a.Message, b.Message)})
+	}
+	// rejected jobs have no effective job
+	if a.Job != nil && b.Job != nil {
+		diff := jsvserver.DiffJobs(Normalize(a.Job), Normalize(b.Job))
+		if !diff.IsEmpty() {
+			for _, line := range strings.Split(diff.String(), "\n") {
+				differences = append(differences, Difference{Category: Job, Detail: line})
+			}
+		}
+	}
+	return differences
+}
+
+// Normalize returns a copy of the job with sorted list values, like
+// "h_rt=60,mem=1G" for "mem=1G,h_rt=60".
+func Normalize(job *jsvserver.JobSpec) *jsvserver.JobSpec {
+	normalized := job.Copy()
+	for name, value := range normalized.Params {
+		if unorderedParams[name] && strings.Contains(value, ",") {
+			values := strings.Split(value, ",")
+			sort.Strings(values)
+			normalized.Params[name] = strings.Join(values, ",")
+		}
+	}
+	return normalized
+}
+
+// Run sends the jobs to both JSVs and returns the jobs which were
+// verified differently. The options are used for both test servers.
+// A failed JSV is restarted like qmaster does, so that one failure does
+// not fail the remaining jobs.
+func Run(jsvA, jsvB string, jobs []jobimport.Job, options ...jsvserver.Option) (*Report, error) {
+	options = append([]jsvserver.Option{
+		jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()),
+	}, options...)
+	serverA, err := start(jsvA, options)
+	if err != nil {
+		return nil, err
+	}
+	defer serverA.Stop()
+	serverB, err := start(jsvB, options)
+	if err != nil {
+		return nil, err
+	}
+	defer serverB.Stop()
+
+	report := &Report{Counts: make(map[string]int)}
+	for _, job := range jobs {
+		a, errA := serverA.SendJob(job.Spec)
+		b, errB := serverB.SendJob(job.Spec)
+		report.Add(job.ID, Compare(a, errA, b, errB))
+	}
+	return report, nil
+}
+
+func start(jsv string, options []jsvserver.Option) (*jsvserver.JSVTestServer, error) {
+	server, err := jsvserver.NewJSVTestServer(jsv, options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := server.Start(); err != nil {
+		server.Stop()
+		return nil, fmt.Errorf("failed to start JSV %s: %w", jsv, err)
+	}
+	return server, nil
+}
+
+// Add adds the differences of a job to the report.
+func (r *Report) Add(name string, differences []Difference) {
+	r.Jobs++
+	if len(differences) == 0 {
+		return
+	}
+	r.Different = append(r.Different, JobDiff{Name: name, Differences: differences})
+	counted := make(map[string]bool)
+	for _, difference := range differences {
+		if !counted[difference.Category] {
+			counted[difference.Category] = true
+			r.Counts[difference.Category]++
+		}
+	}
+}
+
+// String returns the differences per job followed by the counts.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, job := range r.Different {
+		fmt.Fprintf(&b, "%s\n", job.Name)
+		for _, difference := range job.Differences {
+			fmt.Fprintf(&b, "    %-8s %s\n", difference.Category, difference.Detail)
+		}
+	}
+	var counts []string
+	for _, category := range Categories() {
+		if count := r.Counts[category]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", category, count))
+		}
+	}
+	fmt.Fprintf(&b, "%d of %d jobs differ", len(r.Different), r.Jobs)
+	if len(counts) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(counts, ", "))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
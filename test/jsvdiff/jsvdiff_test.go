@@ -0,0 +1,93 @@
+package jsvdiff_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jobimport"
+	"github.com/dgruber/jsv/test/jsvdiff"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// script writes a JSV shell script into a temporary directory.
+func script(name, onBegin string) string {
+	path := filepath.Join(GinkgoT().TempDir(), name)
+	Expect(os.WriteFile(path, []byte(`#!/bin/sh
+while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    "PARAM N "*) name=${line#PARAM N } ;;
+    BEGIN)
+`+onBegin+`
+      ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`), 0755)).To(Succeed())
+	return path
+}
+
+var _ = Describe("Jsvdiff", func() {
+
+	job := func(params map[string]string) *jsvserver.JobSpec {
+		return &jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh", Params: params, Environment: map[string]string{}}
+	}
+
+	It("should ignore the order of list values", func() {
+		a := &jsvserver.JSVResult{State: "CORRECT", Job: job(map[string]string{"l_hard": "h_rt=60,mem=1G"})}
+		b := &jsvserver.JSVResult{State: "CORRECT", Job: job(map[string]string{"l_hard": "mem=1G,h_rt=60"})}
+		Expect(jsvdiff.Compare(a, nil, b, nil)).To(BeEmpty())
+
+		b.Job.Params["l_hard"] = "mem=2G,h_rt=60"
+		b.Job.Params["P"] = "project"
+		Expect(jsvdiff.Compare(a, nil, b, nil)).To(Equal([]jsvdiff.Difference{
+			{Category: jsvdiff.Job, Detail: "+PARAM P project"},
+			{Category: jsvdiff.Job, Detail: "~PARAM l_hard h_rt=60,mem=1G -> h_rt=60,mem=2G"},
+		}))
+	})
+
+	It("should compare the state, the message, and errors", func() {
+		a := &jsvserver.JSVResult{State: "ACCEPT", Job: job(nil)}
+		b := &jsvserver.JSVResult{State: "REJECT", Message: "no project"}
+		Expect(jsvdiff.Compare(a, nil, b, nil)).To(Equal([]jsvdiff.Difference{
+			{Category: jsvdiff.State, Detail: "ACCEPT -> REJECT"},
+			{Category: jsvdiff.Message, Detail: `"" -> "no project"`},
+		}))
+		Expect(jsvdiff.Compare(a, nil, nil, errors.New("timeout"))).To(Equal([]jsvdiff.Difference{
+			{Category: jsvdiff.Error, Detail: "ACCEPT -> timeout"},
+		}))
+		Expect(jsvdiff.Compare(nil, errors.New("timeout"), nil, errors.New("timeout"))).To(BeEmpty())
+	})
+
+	It("should run two JSVs side by side", func() {
+		original := script("original.sh", `      if [ "$name" = big ]; then echo "PARAM l_hard h_rt=60,mem=1G"; echo "RESULT STATE CORRECT"
+      elif [ "$name" = bad ]; then echo "RESULT STATE REJECT invalid job"
+      else echo "RESULT STATE ACCEPT"; fi`)
+		rewrite := script("rewrite.sh", `      if [ "$name" = big ]; then echo "PARAM l_hard mem=1G,h_rt=60"; echo "RESULT STATE CORRECT"
+      elif [ "$name" = bad ]; then echo "RESULT STATE REJECT job is invalid"
+      else echo "PARAM P default"; echo "RESULT STATE CORRECT"; fi`)
+
+		jobs := []jobimport.Job{
+			{ID: "big", Spec: job(map[string]string{"N": "big"})},
+			{ID: "bad", Spec: job(map[string]string{"N": "bad"})},
+			{ID: "small", Spec: job(map[string]string{"N": "small"})},
+		}
+		report, err := jsvdiff.Run(original, rewrite, jobs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Jobs).To(Equal(3))
+		Expect(report.Different).To(HaveLen(2))
+		Expect(report.Different[0].Name).To(Equal("bad"))
+		Expect(report.Counts).To(Equal(map[string]int{jsvdiff.Message: 1, jsvdiff.State: 1, jsvdiff.Job: 1}))
+		Expect(report.String()).To(Equal(`bad
+    message  "invalid job" -> "job is invalid"
+small
+    state    ACCEPT -> CORRECT
+    job      +PARAM P default
+2 of 3 jobs differ (state 1, message 1, job 1)
+`))
+	})
+})
@@ -0,0 +1,131 @@
+package jsvserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// readOnlyParams are the pseudo parameters which can't be changed by
+// a JSV.
+var readOnlyParams = map[string]bool{
+	"VERSION": true, "CONTEXT": true, "CLIENT": true, "USER": true,
+	"GROUP": true, "CMDNAME": true, "CMDARGS": true, "JOB_ID": true,
+}
+
+// IsReadOnly returns true when the parameter is a pseudo parameter
+// which can't be changed by a JSV, like USER or CONTEXT.
+func IsReadOnly(name string) bool {
+	return readOnlyParams[name]
+}
+
+// Copy returns a deep copy of the job specification.
+func (j *JobSpec) Copy() *JobSpec {
+	c := *j
+	c.Params = make(map[string]string, len(j.Params))
+	for name, value := range j.Params {
+		c.Params[name] = value
+	}
+	c.Environment = make(map[string]string, len(j.Environment))
+	for name, value := range j.Environment {
+		c.Environment[name] = value
+	}
+	return &c
+}
+
+// setParam applies "PARAM name value" to the job. An empty value
+// deletes the parameter.
+func (j *JobSpec) setParam(name, value string) {
+	if readOnlyParams[name] {
+		return
+	}
+	if value == "" {
+		delete(j.Params, name)
+		return
+	}
+	j.Params[name] = value
+}
+
+// ValueChange is a changed parameter or environment variable.
+type ValueChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Diff are the differences between two job specifications.
+type Diff struct {
+	AddedParams   map[string]string      `json:"added_params,omitempty"`
+	ChangedParams map[string]ValueChange `json:"changed_params,omitempty"`
+	DeletedParams []string               `json:"deleted_params,omitempty"`
+	AddedEnv      map[string]string      `json:"added_env,omitempty"`
+	ChangedEnv    map[string]ValueChange `json:"changed_env,omitempty"`
+	DeletedEnv    []string               `json:"deleted_env,omitempty"`
+}
+
+// DiffJobs returns the differences of the parameters and environment
+// variables of two job specifications.
+func DiffJobs(before, after *JobSpec) Diff {
+	var d Diff
+	d.AddedParams, d.ChangedParams, d.DeletedParams = diffMaps(before.Params, after.Params)
+	d.AddedEnv, d.ChangedEnv, d.DeletedEnv = diffMaps(before.Environment, after.Environment)
+	return d
+}
+
+func diffMaps(before, after map[string]string) (map[string]string, map[string]ValueChange, []string) {
+	var added map[string]string
+	var changed map[string]ValueChange
+	var deleted []string
+	for name, value := range after {
+		old, exists := before[name]
+		switch {
+		case !exists:
+			if added == nil {
+				added = make(map[string]string)
+			}
+			added[name] = value
+		case old != value:
+			if changed == nil {
+				changed = make(map[string]ValueChange)
+			}
+			changed[name] = ValueChange{Old: old, New: value}
+		}
+	}
+	for name := range before {
+		if _, exists := after[name]; !exists {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return added, changed, deleted
+}
+
+// IsEmpty returns true when the job specifications are equal.
+func (d Diff) IsEmpty() bool {
+	return len(d.AddedParams) == 0 && len(d.ChangedParams) == 0 && len(d.DeletedParams) == 0 &&
+		len(d.AddedEnv) == 0 && len(d.ChangedEnv) == 0 && len(d.DeletedEnv) == 0
+}
+
+// String returns one line per difference, like "+PARAM h_rt 3600",
+// "~PARAM q_hard all.q -> long.q", and "-ENV DISPLAY".
+func (d Diff) String() string {
+	var lines []string
+	format := func(kind string, added map[string]string, changed map[string]ValueChange, deleted []string) {
+		for _, name := range sortedKeys(added) {
+			lines = append(lines, fmt.Sprintf("+%s %s %s", kind, name, added[name]))
+		}
+		names := make([]string, 0, len(changed))
+		for name := range changed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(lines, fmt.Sprintf("~%s %s %s -> %s", kind, name, changed[name].Old, changed[name].New))
+		}
+		for _, name := range deleted {
+			lines = append(lines, fmt.Sprintf("-%s %s", kind, name))
+		}
+	}
+	format("PARAM", d.AddedParams, d.ChangedParams, d.DeletedParams)
+	format("ENV", d.AddedEnv, d.ChangedEnv, d.DeletedEnv)
+	return strings.Join(lines, "\n")
+}
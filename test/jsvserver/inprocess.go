@@ -0,0 +1,23 @@
+package jsvserver
+
+import (
+	"io"
+
+	"github.com/dgruber/jsv"
+)
+
+// NewInProcessJSVTestServer creates a JSVTestServer for a JSV which
+// runs the protocol loop of the jsv package in the test process, like
+// jsv.Run does in a JSV executable. No binary needs to be built, and
+// the verification function is covered by the coverage of the test
+// and checked by the race detector.
+//
+// The state of the jsv package is global, hence only one in-process
+// JSV runs at a time; the JSV of a second server waits until the first
+// one is stopped.
+func NewInProcessJSVTestServer(checkEnvironment bool, verificationFunction, onStartFunction func(), options ...Option) (*JSVTestServer, error) {
+	return NewJSVTestServerFunc(func(stdin io.Reader, stdout, stderr io.Writer) error {
+		jsv.RunWithIO(stdin, stdout, checkEnvironment, verificationFunction, onStartFunction)
+		return nil
+	}, options...)
+}
@@ -0,0 +1,96 @@
+package jsvserver_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("In-process JSV", func() {
+
+	job := &jsvserver.JobSpec{
+		Client: "qsub", CmdName: "job.sh",
+		Params:      map[string]string{"l_hard": "h_rt=60"},
+		Environment: map[string]string{"PATH": "/bin"},
+	}
+
+	It("should verify jobs with the protocol loop of the jsv package", func() {
+		server, err := jsvserver.NewInProcessJSVTestServer(true, func() {
+			if path, _ := jsv.GetEnv("PATH"); path != "/bin" {
+				jsv.Reject("unexpected PATH " + path)
+				return
+			}
+			jsv.LogInfo("increasing the runtime")
+			jsv.SubAddParam("l_hard", "h_rt", "600")
+			jsv.Correct("runtime increased")
+		}, jsv.SendEnv)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+
+		for i := 0; i < 2; i++ {
+			result, err := server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.State).To(Equal("CORRECT"))
+			Expect(result.Message).To(Equal("runtime increased"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("l_hard", "h_rt=600"))
+			Expect(result.Logged("INFO", "runtime")).To(BeTrue())
+			Expect(result.Job.Params).To(HaveKeyWithValue("l_hard", "h_rt=600"))
+		}
+		Expect(server.Stop()).To(Succeed())
+	})
+
+	It("should restart a JSV function which panicked", func() {
+		calls := 0
+		server, err := jsvserver.NewInProcessJSVTestServer(false, func() {
+			calls++
+			if calls == 1 {
+				panic("no job")
+			}
+			jsv.Accept("")
+		}, nil, jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+		defer server.Stop()
+
+		// the panic ends the JSV like it would end an executable
+		_, err = server.SendJob(job)
+		Expect(err).To(HaveOccurred())
+
+		result, err := server.SendJob(job)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.State).To(Equal("ACCEPT"))
+		Expect(server.RestartCount(jsvserver.RestartExit)).To(Equal(1))
+	})
+
+	It("should time out a JSV function which does not verify the job", func() {
+		release := make(chan struct{})
+		calls := 0
+		server, err := jsvserver.NewInProcessJSVTestServer(false, func() {
+			calls++
+			if calls == 1 {
+				<-release
+			}
+			jsv.Accept("")
+		}, nil,
+			jsvserver.WithJobTimeout(200*time.Millisecond),
+			jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+		defer server.Stop()
+
+		_, err = server.SendJob(job)
+		var timeout *jsvserver.TimeoutError
+		Expect(errors.As(err, &timeout)).To(BeTrue())
+
+		// the restarted JSV runs when the killed function returned
+		close(release)
+		result, err := server.SendJob(job)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.State).To(Equal("ACCEPT"))
+	})
+})
@@ -0,0 +1,13 @@
+package jsvserver_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestJsvserver(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Jsvserver Suite")
+}
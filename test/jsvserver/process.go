@@ -0,0 +1,287 @@
+package jsvserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// JSVFunc is a JSV which runs in the test process. It reads the
+// commands of qmaster from stdin and writes its responses to stdout
+// until stdin is closed or it receives QUIT.
+type JSVFunc func(stdin io.Reader, stdout, stderr io.Writer) error
+
+// errKilled is the exit error of a killed JSVFunc.
+var errKilled = errors.New("JSV function was killed")
+
+// process is a running JSV. A restarted JSV is a new process. The JSV
+// is either an executable (cmd) or a function (run).
+type process struct {
+	cmd *exec.Cmd
+	run JSVFunc
+	// the ends of the pipes of a function, which are closed when the
+	// function returns or is killed
+	funcStdin  *pipe
+	funcStdout *pipe
+	funcStderr *pipe
+	done       chan error
+	stdin      io.WriteCloser
+	stdout     *bufio.Reader
+	stderr     *bufio.Reader
+	// lines are the lines the JSV wrote to stdout, the channel is
+	// closed when stdout is closed
+	lines   chan string
+	readErr error
+	// eof is set when stdout of the JSV was closed
+	eof bool
+	// writeErr is the error of the last failed write to stdin
+	writeErr    error
+	stdinClosed bool
+	// killed is set when the process was killed by the test server
+	killed bool
+	// stopped is closed when the process is killed, the lines are not
+	// read anymore
+	stopped  chan struct{}
+	waitOnce sync.Once
+	waitErr  error
+}
+
+func newProcess(path string) (*process, error) {
+	cmd := exec.Command(path)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+	}
+
+	return &process{
+		cmd:     cmd,
+		stdin:   stdin,
+		stdout:  bufio.NewReader(stdout),
+		stderr:  bufio.NewReader(stderr),
+		lines:   make(chan string),
+		stopped: make(chan struct{}),
+	}, nil
+}
+
+// newFuncProcess returns a process which runs the function in a
+// goroutine, connected by in-memory pipes.
+func newFuncProcess(run JSVFunc) *process {
+	stdin, stdout, stderr := newPipe(), newPipe(), newPipe()
+	return &process{
+		run:        run,
+		funcStdin:  stdin,
+		funcStdout: stdout,
+		funcStderr: stderr,
+		done:       make(chan error, 1),
+		stdin:      stdin,
+		stdout:     bufio.NewReader(stdout),
+		stderr:     bufio.NewReader(stderr),
+		lines:      make(chan string),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// start starts the process and the goroutines which read stdout and
+// stderr. Each stderr line is passed to onStderr.
+func (p *process) start(onStderr func(line string)) error {
+	if p.run != nil {
+		go p.runFunc()
+	} else if err := p.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start JSV process: %w", err)
+	}
+	go p.readStdout()
+	go p.readStderr(onStderr)
+	return nil
+}
+
+// runFunc runs the function of the process. A panic of the function
+// is written to stderr like the Go runtime does for an executable.
+func (p *process) runFunc() {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(p.funcStderr, "panic: %v\n\n%s", r, debug.Stack())
+			err = fmt.Errorf("JSV function panicked: %v", r)
+		}
+		p.funcStdin.Close()
+		p.funcStdout.Close()
+		p.funcStderr.Close()
+		p.done <- err
+	}()
+	err = p.run(p.funcStdin, p.funcStdout, p.funcStderr)
+}
+
+// readStdout sends the lines of the JSV to the lines channel until
+// stdout is closed or the process is killed.
+func (p *process) readStdout() {
+	defer close(p.lines)
+	for {
+		line, err := p.stdout.ReadString('\n')
+		if line != "" {
+			select {
+			case p.lines <- strings.TrimSpace(line):
+			case <-p.stopped:
+				return
+			}
+		}
+		if err != nil {
+			p.readErr = err
+			return
+		}
+	}
+}
+
+func (p *process) readStderr(onStderr func(line string)) {
+	for {
+		line, err := p.stderr.ReadString('\n')
+		if err != nil {
+			return
+		}
+		onStderr(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// write sends a line to the JSV.
+func (p *process) write(line string) error {
+	if _, err := fmt.Fprintf(p.stdin, "%s\n", line); err != nil {
+		p.writeErr = err
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+	return nil
+}
+
+// closeStdin closes stdin of the JSV, which reads EOF afterwards.
+func (p *process) closeStdin() {
+	p.stdinClosed = true
+	p.stdin.Close()
+}
+
+// failed returns true when the JSV can't be used anymore.
+func (p *process) failed() bool {
+	return p.killed || p.eof || p.writeErr != nil || p.stdinClosed
+}
+
+// kill kills the JSV process.
+func (p *process) kill() {
+	if p.killed {
+		return
+	}
+	p.killed = true
+	close(p.stopped)
+	if p.run != nil {
+		// a function can't be stopped, it reads EOF and its output
+		// is discarded
+		p.funcStdin.CloseWithError(errKilled)
+		p.funcStdout.CloseWithError(errKilled)
+		p.funcStderr.CloseWithError(errKilled)
+		return
+	}
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+}
+
+// wait waits for the process to exit. It can be called multiple
+// times.
+func (p *process) wait() error {
+	p.waitOnce.Do(func() {
+		switch {
+		case p.run == nil:
+			p.waitErr = p.cmd.Wait()
+		case p.killed:
+			// a killed function might still hang in the verification
+			select {
+			case p.waitErr = <-p.done:
+			default:
+				p.waitErr = errKilled
+			}
+		default:
+			p.waitErr = <-p.done
+		}
+	})
+	return p.waitErr
+}
+
+// pipe is an in-memory pipe with an unbounded buffer. Like the pipe of
+// an executable, and unlike io.Pipe, writes don't wait for the reader.
+type pipe struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	closed bool
+	// err is returned by reads and writes after CloseWithError
+	err error
+}
+
+func newPipe() *pipe {
+	p := &pipe{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pipe) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.buf.Write(data)
+	p.cond.Broadcast()
+	return len(data), nil
+}
+
+// Read blocks until there is data, and returns io.EOF when the pipe was
+// closed and all data was read.
+func (p *pipe) Read(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	if p.buf.Len() > 0 {
+		return p.buf.Read(data)
+	}
+	return 0, io.EOF
+}
+
+// Close closes the pipe, the reader reads the remaining data.
+func (p *pipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+	return nil
+}
+
+// CloseWithError closes the pipe and discards the remaining data.
+func (p *pipe) CloseWithError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.err = err
+	p.buf.Reset()
+	p.cond.Broadcast()
+}
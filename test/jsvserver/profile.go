@@ -0,0 +1,219 @@
+package jsvserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile describes how a qmaster version sends jobs to a JSV. The
+// predefined profiles model the behaviour of the versions, sites can
+// copy and adjust them.
+type Profile struct {
+	// Name of the profile, like "SGE 6.2".
+	Name string
+	// Version is the value of the VERSION pseudo parameter.
+	Version string
+	// PseudoParams is the order of the pseudo parameters which are
+	// sent before the job parameters. Supported are VERSION, CONTEXT,
+	// CLIENT, USER, GROUP, JOB_ID, CMDNAME, SCRIPT, and CMDARGS. The
+	// CMDARG<n> parameters follow CMDARGS.
+	PseudoParams []string
+	// Defaults are parameters which are sent when the job does not
+	// set them, like "b n".
+	Defaults map[string]string
+	// MasterDefaults are additional defaults in the master (server)
+	// context, which are set by qmaster before the JSV is called.
+	MasterDefaults map[string]string
+	// ParamOrder is the order of the job parameters. Parameters which
+	// are not listed follow in alphabetical order.
+	ParamOrder []string
+	// StartPerJob sends START before each job but the first, as the
+	// JSV is back in the initialized state after the RESULT.
+	StartPerJob bool
+	// FillDefaults sets missing CONTEXT ("client") and CLIENT ("qsub")
+	// values, and the job name (N) in the master context.
+	FillDefaults bool
+}
+
+// paramOrder is the order in which qmaster sends the job parameters.
+var paramOrder = strings.Fields(`a ar A ac b binding_strategy binding_type
+	binding_amount binding_socket binding_core binding_step binding_exp_n
+	c_interval c_occasion ckpt cwd C display dl e h hold_jid hold_jid_ad i
+	j jc js l_hard l_soft m M masterl masterq notify now N noshell nostdin
+	o ot P p pe_name pe_min pe_max pty q_hard q_soft R r shell S t_min
+	t_max t_step tc w wd`)
+
+// booleanDefaults are the values qmaster sends for boolean options
+// which are not requested.
+var booleanDefaults = map[string]string{
+	"b": "n", "j": "n", "notify": "n", "R": "n", "shell": "y",
+}
+
+// LegacyProfile returns the profile of the simplified stream of
+// earlier versions of the test server. It sends the job parameters in
+// alphabetical order and no defaults.
+func LegacyProfile() Profile {
+	return Profile{
+		Name:         "legacy",
+		Version:      "1.0",
+		PseudoParams: []string{"VERSION", "CONTEXT", "CLIENT", "USER", "GROUP", "CMDNAME", "CMDARGS"},
+		StartPerJob:  true,
+	}
+}
+
+// SGE62Profile returns the profile of Sun Grid Engine 6.2, which sends
+// the job script as SCRIPT.
+func SGE62Profile() Profile {
+	return Profile{
+		Name:           "SGE 6.2",
+		Version:        "1.0",
+		PseudoParams:   []string{"VERSION", "CONTEXT", "CLIENT", "USER", "GROUP", "JOB_ID", "SCRIPT", "CMDARGS"},
+		Defaults:       copyMap(booleanDefaults),
+		MasterDefaults: map[string]string{"A": "sge"},
+		ParamOrder:     paramOrder,
+		StartPerJob:    true,
+		FillDefaults:   true,
+	}
+}
+
+// UGE8Profile returns the profile of Univa Grid Engine 8.x, which sends
+// the job script as CMDNAME and SCRIPT.
+func UGE8Profile() Profile {
+	p := SGE62Profile()
+	p.Name = "UGE 8"
+	p.PseudoParams = []string{"VERSION", "CONTEXT", "CLIENT", "USER", "GROUP", "JOB_ID", "CMDNAME", "SCRIPT", "CMDARGS"}
+	return p
+}
+
+// OCS9Profile returns the profile of Open Cluster Scheduler 9.x, which
+// sends the job script as CMDNAME.
+func OCS9Profile() Profile {
+	p := SGE62Profile()
+	p.Name = "OCS 9"
+	p.PseudoParams = []string{"VERSION", "CONTEXT", "CLIENT", "USER", "GROUP", "JOB_ID", "CMDNAME", "CMDARGS"}
+	return p
+}
+
+// Profiles returns the predefined profiles by name.
+func Profiles() map[string]Profile {
+	return map[string]Profile{
+		"legacy": LegacyProfile(),
+		"sge62":  SGE62Profile(),
+		"uge8":   UGE8Profile(),
+		"ocs9":   OCS9Profile(),
+	}
+}
+
+// Job returns the job as qmaster sends it to the JSV, with the
+// defaults of the profile.
+func (p Profile) Job(job *JobSpec) *JobSpec {
+	j := job.Copy()
+	if p.FillDefaults {
+		if j.Context == "" {
+			j.Context = "client"
+		}
+		if j.Client == "" {
+			j.Client = "qsub"
+		}
+		if _, exists := j.Params["N"]; !exists && j.Context == "master" && j.CmdName != "" {
+			j.Params["N"] = filepath.Base(j.CmdName)
+		}
+	}
+	defaults := p.Defaults
+	if j.Context == "master" {
+		defaults = copyMap(p.Defaults)
+		for name, value := range p.MasterDefaults {
+			defaults[name] = value
+		}
+	}
+	for name, value := range defaults {
+		if _, exists := j.Params[name]; !exists {
+			j.Params[name] = value
+		}
+	}
+	return j
+}
+
+// Commands returns the PARAM and ENV commands which qmaster sends for
+// the job before BEGIN. The jobID is sent as JOB_ID in the master
+// context; in the client context the job has no ID yet and 0 is sent.
+// The environment is only sent when withEnv is set (SEND ENV).
+func (p Profile) Commands(job *JobSpec, jobID int, withEnv bool) []string {
+	job = p.Job(job)
+	params := job.Params
+	if job.Context != "master" {
+		jobID = 0
+	}
+
+	var commands []string
+	param := func(name, value string) {
+		commands = append(commands, fmt.Sprintf("PARAM %s %s", name, value))
+	}
+	for _, name := range p.PseudoParams {
+		switch name {
+		case "VERSION":
+			param(name, p.Version)
+		case "CONTEXT":
+			param(name, job.Context)
+		case "CLIENT":
+			param(name, job.Client)
+		case "USER":
+			param(name, job.User)
+		case "GROUP":
+			param(name, job.Group)
+		case "JOB_ID":
+			param(name, strconv.Itoa(jobID))
+		case "CMDNAME", "SCRIPT":
+			param(name, job.CmdName)
+		case "CMDARGS":
+			param(name, strconv.Itoa(job.CmdArgs))
+			for n := 0; ; n++ {
+				arg := fmt.Sprintf("CMDARG%d", n)
+				value, exists := params[arg]
+				if !exists {
+					break
+				}
+				param(arg, value)
+				delete(params, arg)
+			}
+		}
+	}
+
+	for _, name := range p.ParamOrder {
+		if value, exists := params[name]; exists {
+			param(name, value)
+			delete(params, name)
+		}
+	}
+	for _, name := range sortedKeys(params) {
+		param(name, params[name])
+	}
+
+	if withEnv {
+		for _, name := range sortedKeys(job.Environment) {
+			commands = append(commands, fmt.Sprintf("ENV ADD %s %s", name, job.Environment[name]))
+		}
+	}
+	return commands
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for key, value := range m {
+		c[key] = value
+	}
+	return c
+}
+
+// ProfileNames returns the sorted names of the predefined profiles.
+func ProfileNames() []string {
+	names := make([]string, 0, 4)
+	for name := range Profiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
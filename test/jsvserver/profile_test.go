@@ -0,0 +1,102 @@
+package jsvserver_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("Profile", func() {
+
+	job := &jsvserver.JobSpec{
+		User:        "alice",
+		Group:       "staff",
+		CmdName:     "/home/alice/job.sh",
+		CmdArgs:     1,
+		Params:      map[string]string{"q_hard": "all.q", "l_hard": "h_rt=99", "CMDARG0": "input", "b": "y"},
+		Environment: map[string]string{"PATH": "/bin", "HOME": "/home/alice"},
+	}
+
+	It("should send the parameters in the order of the profile", func() {
+		Expect(jsvserver.SGE62Profile().Commands(job, 42, true)).To(Equal([]string{
+			"PARAM VERSION 1.0",
+			"PARAM CONTEXT client",
+			"PARAM CLIENT qsub",
+			"PARAM USER alice",
+			"PARAM GROUP staff",
+			"PARAM JOB_ID 0",
+			"PARAM SCRIPT /home/alice/job.sh",
+			"PARAM CMDARGS 1",
+			"PARAM CMDARG0 input",
+			"PARAM b y",
+			"PARAM j n",
+			"PARAM l_hard h_rt=99",
+			"PARAM notify n",
+			"PARAM q_hard all.q",
+			"PARAM R n",
+			"PARAM shell y",
+			"ENV ADD HOME /home/alice",
+			"ENV ADD PATH /bin",
+		}))
+	})
+
+	It("should add the defaults of the master context", func() {
+		master := job.Copy()
+		master.Context = "master"
+		commands := jsvserver.OCS9Profile().Commands(master, 42, false)
+		Expect(commands[:8]).To(Equal([]string{
+			"PARAM VERSION 1.0",
+			"PARAM CONTEXT master",
+			"PARAM CLIENT qsub",
+			"PARAM USER alice",
+			"PARAM GROUP staff",
+			"PARAM JOB_ID 42",
+			"PARAM CMDNAME /home/alice/job.sh",
+			"PARAM CMDARGS 1",
+		}))
+		Expect(commands).To(ContainElements("PARAM A sge", "PARAM N job.sh"))
+		Expect(commands).ToNot(ContainElement(HavePrefix("ENV")))
+	})
+
+	It("should send the simplified stream of the legacy profile", func() {
+		Expect(jsvserver.LegacyProfile().Commands(job, 1, false)).To(Equal([]string{
+			"PARAM VERSION 1.0",
+			"PARAM CONTEXT ",
+			"PARAM CLIENT ",
+			"PARAM USER alice",
+			"PARAM GROUP staff",
+			"PARAM CMDNAME /home/alice/job.sh",
+			"PARAM CMDARGS 1",
+			"PARAM CMDARG0 input",
+			"PARAM b y",
+			"PARAM l_hard h_rt=99",
+			"PARAM q_hard all.q",
+		}))
+	})
+
+	It("should send START before each job", func() {
+		server, err := jsvserver.NewJSVTestServer(script(`while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN) echo "RESULT STATE ACCEPT" ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`), jsvserver.WithProfile(jsvserver.UGE8Profile()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+		defer server.Stop()
+
+		result, err := server.SendJob(&jsvserver.JobSpec{Context: "master", CmdName: "job.sh"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Transcript[0].Line).To(Equal("PARAM VERSION 1.0"))
+		Expect(result.Job.Params).To(HaveKeyWithValue("N", "job.sh"))
+
+		result, err = server.SendJob(&jsvserver.JobSpec{Context: "master", CmdName: "job.sh"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Transcript[0]).To(Equal(jsvserver.TranscriptEntry{Source: jsvserver.FromServer, Line: "START"}))
+		Expect(result.Transcript[1]).To(Equal(jsvserver.TranscriptEntry{Source: jsvserver.FromJSV, Line: "STARTED"}))
+		Expect(result.TranscriptString()).To(ContainSubstring("> PARAM JOB_ID 2\n"))
+	})
+})
@@ -0,0 +1,523 @@
+package jsvserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgruber/jsv/jobscript"
+)
+
+// UnlimitedSlots is the maximum number of slots of an open ended
+// parallel environment range like "-pe mpi 4-".
+const UnlimitedSlots = 9999999
+
+// simpleOptions are the qsub options with a single argument which
+// are sent as JSV parameter with the same name and value.
+var simpleOptions = []string{
+	"A", "a", "ar", "C", "ckpt", "display", "dl", "e", "i", "jc", "js",
+	"M", "m", "N", "o", "P", "p", "S", "tc", "u", "w", "wd",
+}
+
+// flagOptions are the options without argument which are sent as JSV
+// parameter with the value "y". -noshell, -nostdin, and -inherit are
+// options of qrsh.
+var flagOptions = []string{"notify", "noshell", "nostdin", "inherit"}
+
+// yesNoOptions are the qsub options with a y[es]|n[o] argument.
+var yesNoOptions = []string{"b", "j", "now", "pty", "R", "r", "shell"}
+
+// listOptions are the qsub options with a comma separated list which
+// is extended when the option is used multiple times.
+var listOptions = []string{"ac", "dc", "sc", "hold_jid", "hold_jid_ad", "masterq"}
+
+// clientOptions are options which are handled by the client and not
+// sent to the JSV. The value tells if the option has an argument.
+var clientOptions = map[string]bool{
+	"sync": true, "jsv": true, "terse": false, "verify": false,
+}
+
+// ParseCommandLine parses a qsub, qrsh, or qlogin command line like
+// "qsub -l h_rt=99 -pe mpi 3 job.sh" into the job specification which
+// qmaster sends to a JSV. The command line is split like a shell does.
+// See ParseArgs for the environ argument.
+func ParseCommandLine(line string, environ []string) (*JobSpec, error) {
+	args, err := jobscript.SplitArgs(line)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split command line: %w", err)
+	}
+	return ParseArgs(args, environ)
+}
+
+// ParseArgs parses the argv of a qsub, qrsh, or qlogin call into the
+// job specification which qmaster sends to a JSV. The first element
+// is the client, like "qsub". Options before the job script (or the
+// command) are translated into JSV parameters, e.g. "-l h_rt=99"
+// becomes "l_hard" and "-pe mpi 3" becomes "pe_name", "pe_min", and
+// "pe_max". The arguments after the script are sent as CMDARG<n>.
+//
+// The environ contains the environment of the submitting user in the
+// form "key=value". It is used for -V, for variables of -v without
+// value, and for the directory of -cwd (PWD).
+func ParseArgs(argv []string, environ []string) (*JobSpec, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("empty command line")
+	}
+	env := make(map[string]string)
+	for _, e := range environ {
+		key, value, _ := strings.Cut(e, "=")
+		env[key] = value
+	}
+	job := &JobSpec{
+		Context:     "client",
+		Client:      filepath.Base(argv[0]),
+		Params:      make(map[string]string),
+		Environment: make(map[string]string),
+	}
+	isSoft := false
+	for i := 1; i < len(argv); i++ {
+		arg := argv[i]
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			job.CmdName = arg
+			job.CmdArgs = len(argv) - i - 1
+			for n, cmdArg := range argv[i+1:] {
+				job.Params[fmt.Sprintf("CMDARG%d", n)] = cmdArg
+			}
+			break
+		}
+		option := arg[1:]
+		next := func() (string, error) {
+			if i+1 >= len(argv) {
+				return "", fmt.Errorf("option -%s requires an argument", option)
+			}
+			i++
+			return argv[i], nil
+		}
+
+		if hasArg, isClientOption := clientOptions[option]; isClientOption {
+			if hasArg {
+				if _, err := next(); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		switch {
+		case option == "hard":
+			isSoft = false
+		case option == "soft":
+			isSoft = true
+		case option == "clear":
+			job.Params = make(map[string]string)
+			job.Environment = make(map[string]string)
+			isSoft = false
+		case option == "h":
+			job.Params["h"] = "u"
+		case contains(flagOptions, option):
+			job.Params[option] = "y"
+		case option == "cwd":
+			job.Params["cwd"] = env["PWD"]
+		case option == "V":
+			for key, value := range env {
+				if _, exists := job.Environment[key]; !exists {
+					job.Environment[key] = value
+				}
+			}
+		case option == "@":
+			return nil, fmt.Errorf("option files (-@) are not supported")
+		default:
+			value, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if err := job.parseOption(option, value, isSoft, env, next); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if job.CmdName == "" {
+		// qsub reads the job script from stdin, qrsh and qlogin
+		// start an interactive session
+		job.CmdName = "NONE"
+		if job.Client == "qsub" {
+			job.CmdName = "STDIN"
+		}
+	}
+	return job, nil
+}
+
+// parseOption converts a qsub option with an argument into JSV
+// parameters.
+func (j *JobSpec) parseOption(option, value string, isSoft bool, env map[string]string, next func() (string, error)) error {
+	scope := "hard"
+	if isSoft {
+		scope = "soft"
+	}
+	switch {
+	case contains(simpleOptions, option):
+		j.Params[option] = value
+	case contains(yesNoOptions, option):
+		switch strings.ToLower(value) {
+		case "y", "yes":
+			j.Params[option] = "y"
+		case "n", "no":
+			j.Params[option] = "n"
+		default:
+			return fmt.Errorf("option -%s requires y[es] or n[o], got %q", option, value)
+		}
+	case contains(listOptions, option):
+		j.Params[option] = mergeList(j.Params[option], value, false)
+	case option == "l":
+		j.Params["l_"+scope] = mergeList(j.Params["l_"+scope], value, true)
+	case option == "q":
+		j.Params["q_"+scope] = mergeList(j.Params["q_"+scope], value, false)
+	case option == "pe":
+		slots, err := next()
+		if err != nil {
+			return err
+		}
+		min, max, err := parseRange(slots, 1, UnlimitedSlots)
+		if err != nil {
+			return fmt.Errorf("invalid slot range %q of -pe: %w", slots, err)
+		}
+		j.Params["pe_name"] = value
+		j.Params["pe_min"] = strconv.Itoa(min)
+		j.Params["pe_max"] = strconv.Itoa(max)
+	case option == "t":
+		spec, step, hasStep := strings.Cut(value, ":")
+		min, max, err := parseRange(spec, 0, 0)
+		if err != nil || min <= 0 {
+			return fmt.Errorf("invalid task range %q of -t", value)
+		}
+		if !hasStep {
+			step = "1"
+		}
+		if n, err := strconv.Atoi(step); err != nil || n <= 0 {
+			return fmt.Errorf("invalid task step %q of -t", value)
+		}
+		j.Params["t_min"] = strconv.Itoa(min)
+		j.Params["t_max"] = strconv.Itoa(max)
+		j.Params["t_step"] = step
+	case option == "c":
+		if strings.Trim(value, "nsmx") == "" {
+			j.Params["c_occasion"] = value
+		} else {
+			j.Params["c_interval"] = value
+		}
+	case option == "v":
+		for _, variable := range strings.Split(value, ",") {
+			if variable == "" {
+				continue
+			}
+			key, v, hasValue := strings.Cut(variable, "=")
+			if !hasValue {
+				v = env[key]
+			}
+			j.Environment[key] = v
+		}
+	case option == "binding":
+		if value == "set" || value == "env" || value == "pe" {
+			strategy, err := next()
+			if err != nil {
+				return err
+			}
+			return j.parseBinding(value, strategy)
+		}
+		return j.parseBinding("set", value)
+	default:
+		return fmt.Errorf("unknown option -%s", option)
+	}
+	return nil
+}
+
+// parseBinding converts a binding strategy like "linear:2",
+// "striding:2:4:0,0", or "explicit:0,0:0,1" into the binding_*
+// parameters.
+func (j *JobSpec) parseBinding(bindingType, strategy string) error {
+	fields := strings.Split(strategy, ":")
+	invalid := fmt.Errorf("invalid binding strategy %q", strategy)
+	j.Params["binding_type"] = bindingType
+	switch fields[0] {
+	case "linear", "striding":
+		args := 2
+		if fields[0] == "striding" {
+			args = 3
+		}
+		if len(fields) != args && len(fields) != args+1 {
+			return invalid
+		}
+		j.Params["binding_amount"] = fields[1]
+		if fields[0] == "striding" {
+			j.Params["binding_step"] = fields[2]
+		}
+		if len(fields) == args {
+			j.Params["binding_strategy"] = fields[0] + "_automatic"
+			return nil
+		}
+		socket, core, found := strings.Cut(fields[args], ",")
+		if !found {
+			return invalid
+		}
+		j.Params["binding_strategy"] = fields[0]
+		j.Params["binding_socket"] = socket
+		j.Params["binding_core"] = core
+	case "explicit":
+		if len(fields) < 2 {
+			return invalid
+		}
+		j.Params["binding_strategy"] = "explicit"
+		j.Params["binding_exp_n"] = strconv.Itoa(len(fields) - 1)
+		for n, field := range fields[1:] {
+			socket, core, found := strings.Cut(field, ",")
+			if !found {
+				return invalid
+			}
+			j.Params[fmt.Sprintf("binding_exp_socket%d", n)] = socket
+			j.Params[fmt.Sprintf("binding_exp_core%d", n)] = core
+		}
+	default:
+		return invalid
+	}
+	return nil
+}
+
+// parseRange parses "n", "n-m", "-m", and "n-". Open ends are only
+// allowed when defaults are given (not 0).
+func parseRange(value string, defaultMin, defaultMax int) (int, int, error) {
+	first, last, isRange := strings.Cut(value, "-")
+	if !isRange {
+		last = first
+	}
+	parse := func(s string, def int) (int, error) {
+		if s == "" && def != 0 {
+			return def, nil
+		}
+		return strconv.Atoi(s)
+	}
+	min, err := parse(first, defaultMin)
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := parse(last, defaultMax)
+	if err != nil {
+		return 0, 0, err
+	}
+	if min < 0 || max < min {
+		return 0, 0, fmt.Errorf("invalid range")
+	}
+	return min, max, nil
+}
+
+// mergeList appends the elements of a comma separated list to an
+// existing list. When keyed is set, elements like "h_rt=99" replace
+// the elements with the same name.
+func mergeList(list, add string, keyed bool) string {
+	var elements []string
+	if list != "" {
+		elements = strings.Split(list, ",")
+	}
+	for _, element := range strings.Split(add, ",") {
+		if element == "" {
+			continue
+		}
+		replaced := false
+		if keyed {
+			name, _, _ := strings.Cut(element, "=")
+			for n, existing := range elements {
+				if existingName, _, _ := strings.Cut(existing, "="); existingName == name {
+					elements[n] = element
+					replaced = true
+				}
+			}
+		}
+		if !replaced {
+			elements = append(elements, element)
+		}
+	}
+	return strings.Join(elements, ",")
+}
+
+func contains(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandLine renders the job specification as command line of the
+// client, like "qsub -l h_rt=99 -pe mpi 3 job.sh". It is the reverse
+// of ParseCommandLine and is meant for readable test output.
+// Parameters without qsub option are rendered as "-<name> <value>".
+func (j *JobSpec) CommandLine() string {
+	params := make(map[string]string, len(j.Params))
+	for name, value := range j.Params {
+		params[name] = value
+	}
+	take := func(name string) (string, bool) {
+		value, exists := params[name]
+		delete(params, name)
+		return value, exists
+	}
+
+	client := j.Client
+	if client == "" {
+		client = "qsub"
+	}
+	args := []string{client}
+
+	for _, option := range append(append([]string{}, simpleOptions...), yesNoOptions...) {
+		if value, exists := take(option); exists {
+			args = append(args, "-"+option, value)
+		}
+	}
+	for _, option := range listOptions {
+		if value, exists := take(option); exists {
+			args = append(args, "-"+option, value)
+		}
+	}
+	if _, exists := take("h"); exists {
+		args = append(args, "-h")
+	}
+	for _, option := range flagOptions {
+		if _, exists := take(option); exists {
+			args = append(args, "-"+option)
+		}
+	}
+	if _, exists := take("cwd"); exists {
+		args = append(args, "-cwd")
+	}
+	for _, name := range []string{"c_interval", "c_occasion"} {
+		if value, exists := take(name); exists {
+			args = append(args, "-c", value)
+		}
+	}
+	if name, exists := take("pe_name"); exists {
+		min, _ := take("pe_min")
+		max, _ := take("pe_max")
+		slots := min
+		if max == strconv.Itoa(UnlimitedSlots) {
+			slots = min + "-"
+		} else if max != min {
+			slots = min + "-" + max
+		}
+		args = append(args, "-pe", name, slots)
+	}
+	if min, exists := take("t_min"); exists {
+		max, _ := take("t_max")
+		step, _ := take("t_step")
+		tasks := min
+		if max != "" && max != min {
+			tasks += "-" + max
+		}
+		if step != "" && step != "1" {
+			tasks += ":" + step
+		}
+		args = append(args, "-t", tasks)
+	}
+	if binding := renderBinding(take); binding != nil {
+		args = append(args, binding...)
+	}
+	if len(j.Environment) > 0 {
+		var variables []string
+		for _, key := range sortedKeys(j.Environment) {
+			variables = append(variables, key+"="+j.Environment[key])
+		}
+		args = append(args, "-v", strings.Join(variables, ","))
+	}
+	for _, scope := range []string{"hard", "soft"} {
+		l, hasL := take("l_" + scope)
+		q, hasQ := take("q_" + scope)
+		if scope == "soft" && (hasL || hasQ) {
+			args = append(args, "-soft")
+		}
+		if hasL {
+			args = append(args, "-l", l)
+		}
+		if hasQ {
+			args = append(args, "-q", q)
+		}
+	}
+
+	var cmdArgs []string
+	for n := 0; ; n++ {
+		value, exists := take(fmt.Sprintf("CMDARG%d", n))
+		if !exists {
+			break
+		}
+		cmdArgs = append(cmdArgs, value)
+	}
+	for _, name := range sortedKeys(params) {
+		args = append(args, "-"+name, params[name])
+	}
+	if j.CmdName != "" && j.CmdName != "NONE" && j.CmdName != "STDIN" {
+		args = append(args, j.CmdName)
+		args = append(args, cmdArgs...)
+	}
+
+	for n, arg := range args {
+		args[n] = quote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// renderBinding returns the -binding option of the binding_*
+// parameters.
+func renderBinding(take func(string) (string, bool)) []string {
+	strategy, exists := take("binding_strategy")
+	if !exists {
+		return nil
+	}
+	bindingType, _ := take("binding_type")
+	amount, _ := take("binding_amount")
+	step, _ := take("binding_step")
+	socket, _ := take("binding_socket")
+	core, _ := take("binding_core")
+	var value string
+	switch strategy {
+	case "linear_automatic":
+		value = "linear:" + amount
+	case "linear":
+		value = "linear:" + amount + ":" + socket + "," + core
+	case "striding_automatic":
+		value = "striding:" + amount + ":" + step
+	case "striding":
+		value = "striding:" + amount + ":" + step + ":" + socket + "," + core
+	case "explicit":
+		value = "explicit"
+		count, _ := take("binding_exp_n")
+		n, _ := strconv.Atoi(count)
+		for i := 0; i < n; i++ {
+			s, _ := take(fmt.Sprintf("binding_exp_socket%d", i))
+			c, _ := take(fmt.Sprintf("binding_exp_core%d", i))
+			value += ":" + s + "," + c
+		}
+	default:
+		value = strategy
+	}
+	if bindingType != "" && bindingType != "set" {
+		return []string{"-binding", bindingType, value}
+	}
+	return []string{"-binding", value}
+}
+
+// quote quotes an argument for a shell when required.
+func quote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`#;&|<>()*?[]{}~!") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+package jsvserver_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+var _ = Describe("Qsub", func() {
+
+	environ := []string{"PWD=/home/user", "HOME=/home/user", "LANG=C"}
+
+	It("should convert a qsub command line into JSV parameters", func() {
+		job, err := jsvserver.ParseCommandLine(
+			"qsub -l h_rt=99 -pe mpi 3 -q long.q -soft -l mem=1G -q short.q -hard -l h_rt=100,arch=lx-amd64 -N 'my job' -j yes -t 1-10:2 -hold_jid 1 -hold_jid 2 -h -cwd -sync y job.sh a 'b c'",
+			environ)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.Context).To(Equal("client"))
+		Expect(job.Client).To(Equal("qsub"))
+		Expect(job.CmdName).To(Equal("job.sh"))
+		Expect(job.CmdArgs).To(Equal(2))
+		Expect(job.Params).To(Equal(map[string]string{
+			"l_hard":   "h_rt=100,arch=lx-amd64",
+			"l_soft":   "mem=1G",
+			"q_hard":   "long.q",
+			"q_soft":   "short.q",
+			"pe_name":  "mpi",
+			"pe_min":   "3",
+			"pe_max":   "3",
+			"N":        "my job",
+			"j":        "y",
+			"t_min":    "1",
+			"t_max":    "10",
+			"t_step":   "2",
+			"hold_jid": "1,2",
+			"h":        "u",
+			"cwd":      "/home/user",
+			"CMDARG0":  "a",
+			"CMDARG1":  "b c",
+		}))
+	})
+
+	It("should convert the binding strategies", func() {
+		job, err := jsvserver.ParseArgs([]string{"qsub", "-binding", "striding:2:4:0,1", "job.sh"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.Params).To(Equal(map[string]string{
+			"binding_type":     "set",
+			"binding_strategy": "striding",
+			"binding_amount":   "2",
+			"binding_step":     "4",
+			"binding_socket":   "0",
+			"binding_core":     "1",
+		}))
+
+		job, err = jsvserver.ParseArgs([]string{"qsub", "-binding", "pe", "explicit:0,0:1,2", "job.sh"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.Params).To(Equal(map[string]string{
+			"binding_type":        "pe",
+			"binding_strategy":    "explicit",
+			"binding_exp_n":       "2",
+			"binding_exp_socket0": "0",
+			"binding_exp_core0":   "0",
+			"binding_exp_socket1": "1",
+			"binding_exp_core1":   "2",
+		}))
+	})
+
+	It("should export the environment with -v and -V", func() {
+		job, err := jsvserver.ParseArgs([]string{"qrsh", "-v", "LANG,FOO=bar", "-V", "hostname"}, environ)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.Client).To(Equal("qrsh"))
+		Expect(job.Environment).To(Equal(map[string]string{
+			"PWD": "/home/user", "HOME": "/home/user", "LANG": "C", "FOO": "bar",
+		}))
+	})
+
+	It("should parse a qrsh command line", func() {
+		job, err := jsvserver.ParseCommandLine("qrsh -now no -pty y -noshell -nostdin -inherit -jc interactive.default -u alice -l h_rt=600 -q interactive.q /bin/hostname -f", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.Client).To(Equal("qrsh"))
+		Expect(job.CmdName).To(Equal("/bin/hostname"))
+		Expect(job.Params).To(Equal(map[string]string{
+			"now": "n", "pty": "y", "noshell": "y", "nostdin": "y", "inherit": "y",
+			"jc": "interactive.default", "u": "alice",
+			"l_hard": "h_rt=600", "q_hard": "interactive.q", "CMDARG0": "-f",
+		}))
+		Expect(job.CommandLine()).To(Equal("qrsh -jc interactive.default -u alice -now n -pty y -noshell -nostdin -inherit -l h_rt=600 -q interactive.q /bin/hostname -f"))
+	})
+
+	It("should use the command names of jobs without script", func() {
+		job, err := jsvserver.ParseArgs([]string{"qsub", "-pe", "smp", "4-"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.CmdName).To(Equal("STDIN"))
+		Expect(job.Params["pe_min"]).To(Equal("4"))
+		Expect(job.Params["pe_max"]).To(Equal("9999999"))
+
+		job, err = jsvserver.ParseArgs([]string{"qlogin"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.CmdName).To(Equal("NONE"))
+	})
+
+	It("should reject invalid command lines", func() {
+		for _, line := range []string{"qsub -unknown job.sh", "qsub -pe mpi", "qsub -j maybe job.sh", "qsub -t 0-5 job.sh", "qsub -binding linear job.sh"} {
+			_, err := jsvserver.ParseCommandLine(line, nil)
+			Expect(err).To(HaveOccurred(), line)
+		}
+	})
+
+	It("should render a job specification as command line", func() {
+		line := "qsub -N 'my job' -j y -hold_jid 1,2 -h -pe mpi 2-8 -t 1-10:2 -binding env linear:2:0,0 -v 'A=1,B=x y' -l h_rt=99 -q long.q -soft -l mem=1G job.sh a 'it'\\''s'"
+		job, err := jsvserver.ParseCommandLine(line, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(job.CommandLine()).To(Equal(line))
+
+		reparsed, err := jsvserver.ParseCommandLine(job.CommandLine(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reparsed).To(Equal(job))
+	})
+})
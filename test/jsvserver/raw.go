@@ -0,0 +1,131 @@
+package jsvserver
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoOutput is returned by RawJSV.Read when the JSV sent no line
+// within the timeout.
+var ErrNoOutput = errors.New("JSV sent no output")
+
+// RawJSV is a JSV process which is driven line by line, without the
+// protocol handling of JSVTestServer. It is used to check the protocol
+// of a JSV and to send malformed input.
+type RawJSV struct {
+	proc     *process
+	stderrMu sync.Mutex
+	stderr   []string
+}
+
+// StartRaw starts the JSV.
+func StartRaw(jsvPath string) (*RawJSV, error) {
+	proc, err := newProcess(jsvPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &RawJSV{proc: proc}
+	if err := proc.start(r.addStderr); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RawJSV) addStderr(line string) {
+	r.stderrMu.Lock()
+	defer r.stderrMu.Unlock()
+	r.stderr = append(r.stderr, line)
+}
+
+// Send sends a line to the JSV. The line is sent as it is, a line
+// without newline is completed by the next one.
+func (r *RawJSV) Send(line string) error {
+	return r.proc.write(line)
+}
+
+// SendRaw sends the data to the JSV without adding a newline.
+func (r *RawJSV) SendRaw(data []byte) error {
+	if _, err := r.proc.stdin.Write(data); err != nil {
+		r.proc.writeErr = err
+		return err
+	}
+	return nil
+}
+
+// Read returns the next line of the JSV. It returns ErrNoOutput when
+// the JSV sent no line within the timeout, and io.EOF when the JSV
+// closed stdout.
+func (r *RawJSV) Read(timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case line, ok := <-r.proc.lines:
+		if !ok {
+			r.proc.eof = true
+			return "", io.EOF
+		}
+		return line, nil
+	case <-timer.C:
+		return "", ErrNoOutput
+	}
+}
+
+// ReadUntil reads lines until a line starts with the prefix, which is
+// the last returned line. The timeout is the time for all lines.
+func (r *RawJSV) ReadUntil(prefix string, timeout time.Duration) ([]string, error) {
+	deadline := time.Now().Add(timeout)
+	var lines []string
+	for {
+		line, err := r.Read(time.Until(deadline))
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+		if strings.HasPrefix(line, prefix) {
+			return lines, nil
+		}
+	}
+}
+
+// CloseStdin closes stdin of the JSV.
+func (r *RawJSV) CloseStdin() {
+	r.proc.closeStdin()
+}
+
+// Wait waits until the JSV exits and returns false when it did not
+// exit within the timeout. The error is the exit error of the JSV.
+// The remaining output of the JSV is discarded, a JSV which did not
+// exit should be killed.
+func (r *RawJSV) Wait(timeout time.Duration) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		// drain stdout, a JSV blocks when nobody reads its output
+		for range r.proc.lines {
+		}
+		done <- r.proc.wait()
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return true, err
+	case <-timer.C:
+		return false, nil
+	}
+}
+
+// Kill kills the JSV and waits until it exited.
+func (r *RawJSV) Kill() {
+	r.proc.kill()
+	r.proc.wait()
+}
+
+// Stderr returns the lines the JSV wrote to stderr.
+func (r *RawJSV) Stderr() []string {
+	r.stderrMu.Lock()
+	defer r.stderrMu.Unlock()
+	return append([]string{}, r.stderr...)
+}
@@ -0,0 +1,103 @@
+package jsvserver
+
+import (
+	"strings"
+)
+
+// Sources of transcript entries.
+const (
+	// FromServer marks lines the test server sent to the JSV.
+	FromServer = ">"
+	// FromJSV marks lines the JSV sent to the test server.
+	FromJSV = "<"
+)
+
+// LogMessage is a message the JSV logged with "LOG <level> <message>".
+type LogMessage struct {
+	// Level is INFO, WARNING, or ERROR.
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// TranscriptEntry is a line of the protocol exchange.
+type TranscriptEntry struct {
+	// Source is FromServer or FromJSV.
+	Source string
+	Line   string
+}
+
+type JSVResult struct {
+	State          string
+	Message        string
+	ModifiedParams map[string]string
+	ModifiedEnv    map[string]string
+	// Logs are the LOG messages of the JSV in the order they were sent.
+	Logs []LogMessage
+	// Errors are the messages of ERROR lines, which the JSV sends
+	// on protocol errors.
+	Errors []string
+	// Stderr are the lines the JSV wrote to stderr while the job was
+	// verified.
+	Stderr []string
+	// Transcript is the protocol exchange of the job.
+	Transcript []TranscriptEntry
+	// Job is the job qmaster would store: the job with the
+	// modifications of the JSV when it was accepted or corrected, and
+	// nil when it was rejected.
+	Job *JobSpec
+	// Diff are the modifications the JSV requested, independent of
+	// the result.
+	Diff Diff
+}
+
+// LogMessages returns the messages logged with the given level. All
+// messages are returned when the level is empty.
+func (r *JSVResult) LogMessages(level string) []string {
+	var messages []string
+	for _, log := range r.Logs {
+		if level == "" || strings.EqualFold(log.Level, level) {
+			messages = append(messages, log.Message)
+		}
+	}
+	return messages
+}
+
+// Logged returns true when the JSV logged a message with the given
+// level (any level when empty) which contains the substring.
+func (r *JSVResult) Logged(level, substring string) bool {
+	return containsSubstring(r.LogMessages(level), substring)
+}
+
+// HasError returns true when the JSV sent an ERROR line which contains
+// the substring.
+func (r *JSVResult) HasError(substring string) bool {
+	return containsSubstring(r.Errors, substring)
+}
+
+// StderrContains returns true when a stderr line of the JSV contains
+// the substring.
+func (r *JSVResult) StderrContains(substring string) bool {
+	return containsSubstring(r.Stderr, substring)
+}
+
+// TranscriptString returns the transcript with one line per entry,
+// prefixed with the source, like "> BEGIN" and "< RESULT STATE ACCEPT".
+func (r *JSVResult) TranscriptString() string {
+	var b strings.Builder
+	for _, entry := range r.Transcript {
+		b.WriteString(entry.Source)
+		b.WriteString(" ")
+		b.WriteString(entry.Line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func containsSubstring(lines []string, substring string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,81 +1,192 @@
 package jsvserver
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
 )
 
+// DefaultTimeout is the default time the JSV has to respond during
+// startup, job verification, and shutdown.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultStderrGrace is the default time to wait for stderr output of
+// the JSV after it sent the result of a job.
+const DefaultStderrGrace = 10 * time.Millisecond
+
 type JSVTestServer struct {
-	cmd          *exec.Cmd
-	stdin        io.WriteCloser
-	stdout       *bufio.Reader
-	stderr       *bufio.Reader
+	// newProc returns a new JSV process, for the start and restarts
+	newProc      func() (*process, error)
+	proc         *process
 	mu           sync.Mutex
-	timeout      time.Duration
+	startTimeout time.Duration
+	jobTimeout   time.Duration
+	stopTimeout  time.Duration
 	envRequested bool
+	// received are the lines of the current phase
+	received []string
+	// profile is the emulated qmaster
+	profile    Profile
+	jobID      int
+	needsStart bool
+	// result is the result of the currently verified job
+	result      *JSVResult
+	stderrGrace time.Duration
+	stderrMu    sync.Mutex
+	stderrLines []string
+	// supervisor state, see supervisor.go
+	policy   RestartPolicy
+	restarts []Restart
+	// restartReason is set when the JSV must be restarted before
+	// the next job
+	restartReason string
+	// jobsSinceStart are the jobs the current JSV process verified
+	jobsSinceStart int
+	// protocolError is set when the JSV sent ERROR or an unknown
+	// command during the current job
+	protocolError bool
+	faults        Faults
 }
 
-// NewJSVTestServer creates a new JSVTestServer instance.
-//
-// The first argument is the path to the JSV script.
-func NewJSVTestServer(jsvPath string) (*JSVTestServer, error) {
-	cmd := exec.Command(jsvPath)
+// Option configures a JSVTestServer.
+type Option func(*JSVTestServer)
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdin pipe: %w", err)
+// WithTimeout sets the timeouts of startup, job verification, and
+// shutdown.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *JSVTestServer) {
+		s.startTimeout = timeout
+		s.jobTimeout = timeout
+		s.stopTimeout = timeout
 	}
+}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stdout pipe: %w", err)
+// WithStartTimeout sets the time the JSV has to answer START.
+func WithStartTimeout(timeout time.Duration) Option {
+	return func(s *JSVTestServer) {
+		s.startTimeout = timeout
 	}
+}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get stderr pipe: %w", err)
+// WithJobTimeout sets the time the JSV has to send the result of a
+// job after BEGIN.
+func WithJobTimeout(timeout time.Duration) Option {
+	return func(s *JSVTestServer) {
+		s.jobTimeout = timeout
 	}
+}
 
-	return &JSVTestServer{
-		cmd:     cmd,
-		stdin:   stdin,
-		stdout:  bufio.NewReader(stdout),
-		stderr:  bufio.NewReader(stderr),
-		timeout: 5 * time.Second,
-	}, nil
+// WithStopTimeout sets the time the JSV has to exit after QUIT.
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(s *JSVTestServer) {
+		s.stopTimeout = timeout
+	}
 }
 
-func (s *JSVTestServer) Start() error {
-	if err := s.cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start JSV process: %w", err)
+// WithStderrGrace sets the time to wait for stderr output after the
+// result of a job. Stderr is read independently of stdout, hence lines
+// the JSV wrote just before the result can arrive after it.
+func WithStderrGrace(grace time.Duration) Option {
+	return func(s *JSVTestServer) {
+		s.stderrGrace = grace
+	}
+}
+
+// WithProfile sets the qmaster profile which defines the parameters
+// sent to the JSV. The default is LegacyProfile.
+func WithProfile(profile Profile) Option {
+	return func(s *JSVTestServer) {
+		s.profile = profile
 	}
+}
 
-	go s.monitorStderr()
+// TimeoutError is returned when the JSV does not respond in time. Like
+// qmaster does when SGE_JSV_TIMEOUT expires, the JSV process is killed.
+type TimeoutError struct {
+	// Phase is "start", "job", or "stop".
+	Phase string
+	// Timeout is the expired timeout.
+	Timeout time.Duration
+	// Output are the lines the JSV sent in the phase before the
+	// timeout expired.
+	Output []string
+}
 
-	//ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
-	//defer cancel()
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("JSV did not respond within %v (%s), received %d lines",
+		e.Timeout, e.Phase, len(e.Output))
+}
 
-	// Send initial START command
+// NewJSVTestServer creates a new JSVTestServer instance.
+//
+// The first argument is the path to the JSV script. The timeouts
+// default to DefaultTimeout and can be changed with options.
+func NewJSVTestServer(jsvPath string, options ...Option) (*JSVTestServer, error) {
+	return newJSVTestServer(func() (*process, error) {
+		return newProcess(jsvPath)
+	}, options)
+}
+
+// NewJSVTestServerFunc creates a JSVTestServer for a JSV which runs
+// as a function in the test process, see NewInProcessJSVTestServer.
+func NewJSVTestServerFunc(run JSVFunc, options ...Option) (*JSVTestServer, error) {
+	return newJSVTestServer(func() (*process, error) {
+		return newFuncProcess(run), nil
+	}, options)
+}
+
+func newJSVTestServer(newProc func() (*process, error), options []Option) (*JSVTestServer, error) {
+	proc, err := newProc()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &JSVTestServer{
+		newProc:      newProc,
+		proc:         proc,
+		startTimeout: DefaultTimeout,
+		jobTimeout:   DefaultTimeout,
+		stopTimeout:  DefaultTimeout,
+		stderrGrace:  DefaultStderrGrace,
+		profile:      LegacyProfile(),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+func (s *JSVTestServer) Start() error {
+	if err := s.proc.start(s.addStderr); err != nil {
+		return err
+	}
+	s.jobsSinceStart = 0
+	return s.start()
+}
+
+// start runs the START/STARTED handshake.
+func (s *JSVTestServer) start() error {
+	s.envRequested = false
 	if err := s.sendCommand("START"); err != nil {
 		return err
 	}
 
 	// Handle JSV initialization sequence
+	deadline := s.startPhase(s.startTimeout)
 	for {
-		line, err := s.stdout.ReadString('\n')
+		line, err := s.readLine("start", s.startTimeout, deadline)
 		if err != nil {
-			return fmt.Errorf("protocol error: %w", err)
+			return err
+		}
+		if s.result != nil {
+			s.result.Transcript = append(s.result.Transcript, TranscriptEntry{Source: FromJSV, Line: line})
 		}
-		line = strings.TrimSpace(line)
 
 		switch {
 		case line == "STARTED":
+			s.needsStart = false
 			return nil
 		case strings.HasPrefix(line, "SEND"):
 			parts := strings.SplitN(line, " ", 2)
@@ -88,62 +199,68 @@ func (s *JSVTestServer) Start() error {
 	}
 }
 
+// SendJob sends the job to the JSV like the qmaster of the profile
+// does and returns the result of the verification. With a restart
+// policy the JSV is restarted before the job when the previous job
+// failed.
 func (s *JSVTestServer) SendJob(job *JobSpec) (*JSVResult, error) {
-	//ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
-	//defer cancel()
+	result := &JSVResult{}
+	s.result = result
+	defer func() {
+		s.result = nil
+	}()
 
-	// Send pseudo-parameters first
-	if err := s.sendCommand("PARAM VERSION 1.0"); err != nil {
-		return nil, err
-	}
-	if err := s.sendCommand(fmt.Sprintf("PARAM CONTEXT %s", job.Context)); err != nil {
-		return nil, err
-	}
-	if err := s.sendCommand(fmt.Sprintf("PARAM CLIENT %s", job.Client)); err != nil {
-		return nil, err
-	}
-	if err := s.sendCommand(fmt.Sprintf("PARAM USER %s", job.User)); err != nil {
-		return nil, err
-	}
-	if err := s.sendCommand(fmt.Sprintf("PARAM GROUP %s", job.Group)); err != nil {
-		return nil, err
-	}
-	if err := s.sendCommand(fmt.Sprintf("PARAM CMDNAME %s", job.CmdName)); err != nil {
-		return nil, err
+	// the handshake of a restarted JSV is part of the transcript
+	if s.restartReason != "" {
+		if err := s.restart(s.restartReason); err != nil {
+			return nil, err
+		}
 	}
-	if err := s.sendCommand(fmt.Sprintf("PARAM CMDARGS %d", job.CmdArgs)); err != nil {
-		return nil, err
+	if s.proc.killed {
+		return nil, fmt.Errorf("JSV process was killed")
 	}
+	result, err := s.sendJob(job, result)
+	s.supervise(err)
+	return result, err
+}
+
+func (s *JSVTestServer) sendJob(job *JobSpec, result *JSVResult) (*JSVResult, error) {
+	s.protocolError = false
+	stderrStart := s.stderrCount()
 
-	// Send other parameters
-	for param, value := range job.Params {
-		if err := s.sendCommand(fmt.Sprintf("PARAM %s %s", param, value)); err != nil {
+	// the JSV is in the initialized state after the previous result
+	if s.needsStart && s.profile.StartPerJob {
+		if err := s.start(); err != nil {
 			return nil, err
 		}
 	}
 
-	// Send environment if requested
-	if s.envRequested {
-		for env, value := range job.Environment {
-			if err := s.sendCommand(fmt.Sprintf("ENV ADD %s %s", env, value)); err != nil {
-				return nil, err
-			}
+	s.jobID++
+	s.jobsSinceStart++
+	sent := s.profile.Job(job)
+	modified := sent.Copy()
+	for _, command := range s.profile.Commands(job, s.jobID, s.envRequested) {
+		if err := s.sendCommand(command); err != nil {
+			return nil, err
 		}
 	}
 
+	s.injectFaults(beforeBegin)
+
 	// Begin verification
 	if err := s.sendCommand("BEGIN"); err != nil {
 		return nil, err
 	}
+	s.injectFaults(afterBegin)
 
 	// Process JSV response
-	result := &JSVResult{}
+	deadline := s.startPhase(s.jobTimeout)
 	for {
-		line, err := s.stdout.ReadString('\n')
+		line, err := s.readLine("job", s.jobTimeout, deadline)
 		if err != nil {
-			return nil, fmt.Errorf("read error: %w", err)
+			return nil, err
 		}
-		line = strings.TrimSpace(line)
+		result.Transcript = append(result.Transcript, TranscriptEntry{Source: FromJSV, Line: line})
 
 		switch {
 		case strings.HasPrefix(line, "RESULT"):
@@ -155,7 +272,18 @@ func (s *JSVTestServer) SendJob(job *JobSpec) (*JSVResult, error) {
 			if len(parts) > 3 {
 				result.Message = strings.Join(parts[3:], " ")
 			}
-			log.Printf("JSV Result: %+v", result)
+			if s.stderrGrace > 0 {
+				time.Sleep(s.stderrGrace)
+			}
+			result.Stderr = s.stderrSince(stderrStart)
+			result.Diff = DiffJobs(sent, modified)
+			// like the jsv package documents, ACCEPT and CORRECT have
+			// the same semantic
+			if result.State == "ACCEPT" || result.State == "CORRECT" {
+				result.Job = modified
+			}
+			s.needsStart = true
+			log.Printf("JSV Result: %s %s", result.State, result.Message)
 			return result, nil
 
 		case strings.HasPrefix(line, "PARAM"):
@@ -171,26 +299,50 @@ func (s *JSVTestServer) SendJob(job *JobSpec) (*JSVResult, error) {
 				result.ModifiedParams = make(map[string]string)
 			}
 			result.ModifiedParams[parts[1]] = value
+			modified.setParam(parts[1], value)
 
 		case strings.HasPrefix(line, "ENV"):
 			parts := strings.SplitN(line, " ", 4)
-			if len(parts) < 4 {
+			if len(parts) < 3 {
 				return nil, fmt.Errorf("invalid ENV format: %s", line)
 			}
 			switch parts[1] {
 			case "ADD", "MOD":
+				value := ""
+				if len(parts) > 3 {
+					value = parts[3]
+				}
 				if result.ModifiedEnv == nil {
 					result.ModifiedEnv = make(map[string]string)
 				}
-				result.ModifiedEnv[parts[2]] = parts[3]
+				result.ModifiedEnv[parts[2]] = value
+				modified.Environment[parts[2]] = value
 			case "DEL":
 				delete(result.ModifiedEnv, parts[2])
+				delete(modified.Environment, parts[2])
+			default:
+				return nil, fmt.Errorf("invalid ENV format: %s", line)
 			}
 
 		case strings.HasPrefix(line, "LOG"):
+			parts := strings.SplitN(line, " ", 3)
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("invalid LOG format: %s", line)
+			}
+			message := LogMessage{Level: parts[1]}
+			if len(parts) > 2 {
+				message.Message = parts[2]
+			}
+			result.Logs = append(result.Logs, message)
 			log.Printf("JSV LOG: %s", line)
 
+		case strings.HasPrefix(line, "ERROR"):
+			result.Errors = append(result.Errors, strings.TrimSpace(strings.TrimPrefix(line, "ERROR")))
+			s.protocolError = true
+			log.Printf("JSV ERROR: %s", line)
+
 		default:
+			s.protocolError = true
 			log.Printf("Unexpected JSV response: %s", line)
 		}
 	}
@@ -200,32 +352,127 @@ func (s *JSVTestServer) sendCommand(cmd string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, err := fmt.Fprintf(s.stdin, "%s\n", cmd)
-	if err != nil {
-		return fmt.Errorf("failed to send command: %w", err)
+	if s.faults.SlowWrite > 0 {
+		time.Sleep(s.faults.SlowWrite)
+	}
+	if err := s.proc.write(cmd); err != nil {
+		return err
+	}
+	if s.result != nil {
+		s.result.Transcript = append(s.result.Transcript, TranscriptEntry{Source: FromServer, Line: cmd})
 	}
 	return nil
 }
 
-func (s *JSVTestServer) monitorStderr() {
-	for {
-		line, err := s.stderr.ReadString('\n')
-		if err != nil {
-			return
+// startPhase resets the received lines and returns the deadline of
+// the phase. A timeout of 0 disables the deadline.
+func (s *JSVTestServer) startPhase(timeout time.Duration) time.Time {
+	s.received = nil
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// readLine returns the next line of the JSV. When the deadline
+// expires, the JSV process is killed and a TimeoutError is returned.
+func (s *JSVTestServer) readLine(phase string, timeout time.Duration, deadline time.Time) (string, error) {
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case line, ok := <-s.proc.lines:
+		if !ok {
+			s.proc.eof = true
+			return "", fmt.Errorf("protocol error: %w", s.proc.readErr)
 		}
-		log.Printf("JSV STDERR: %s", strings.TrimSpace(line))
+		if s.faults.SlowRead > 0 {
+			time.Sleep(s.faults.SlowRead)
+		}
+		s.received = append(s.received, line)
+		return line, nil
+	case <-expired:
+		s.proc.kill()
+		return "", &TimeoutError{Phase: phase, Timeout: timeout, Output: s.received}
 	}
 }
 
+// addStderr records a line the JSV wrote to stderr.
+func (s *JSVTestServer) addStderr(line string) {
+	s.stderrMu.Lock()
+	s.stderrLines = append(s.stderrLines, line)
+	s.stderrMu.Unlock()
+	log.Printf("JSV STDERR: %s", line)
+}
+
+// stderrCount returns the number of lines the JSV wrote to stderr.
+func (s *JSVTestServer) stderrCount() int {
+	s.stderrMu.Lock()
+	defer s.stderrMu.Unlock()
+	return len(s.stderrLines)
+}
+
+// stderrSince returns the stderr lines after the first n lines.
+func (s *JSVTestServer) stderrSince(n int) []string {
+	s.stderrMu.Lock()
+	defer s.stderrMu.Unlock()
+	if n >= len(s.stderrLines) {
+		return nil
+	}
+	return append([]string{}, s.stderrLines[n:]...)
+}
+
+// Stop sends QUIT and waits until the JSV exits. When the JSV does
+// not exit in time, it is killed and a TimeoutError is returned. Stop
+// only reaps a JSV which was already killed or has closed its stdin
+// or stdout.
 func (s *JSVTestServer) Stop() error {
+	if s.proc.failed() {
+		s.proc.kill()
+		s.proc.wait()
+		return nil
+	}
 	if err := s.sendCommand("QUIT"); err != nil {
 		return err
 	}
 
-	if err := s.cmd.Wait(); err != nil {
-		return fmt.Errorf("JSV process exit error: %w", err)
+	// read the remaining output until the JSV closes stdout
+	deadline := s.startPhase(s.stopTimeout)
+	for {
+		_, err := s.readLine("stop", s.stopTimeout, deadline)
+		if _, isTimeout := err.(*TimeoutError); isTimeout {
+			s.proc.wait()
+			return err
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.proc.wait()
+	}()
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("JSV process exit error: %w", err)
+		}
+		return nil
+	case <-expired:
+		s.proc.kill()
+		<-done
+		return &TimeoutError{Phase: "stop", Timeout: s.stopTimeout, Output: s.received}
 	}
-	return nil
 }
 
 // JobSpec is a specifiction of a batch job which is processed by
@@ -241,10 +488,3 @@ type JobSpec struct {
 	Params      map[string]string `json:"params"`
 	Environment map[string]string `json:"environment"`
 }
-
-type JSVResult struct {
-	State          string
-	Message        string
-	ModifiedParams map[string]string
-	ModifiedEnv    map[string]string
-}
@@ -0,0 +1,350 @@
+package jsvserver_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// script writes a JSV shell script into a temporary directory.
+func script(content string) string {
+	path := filepath.Join(GinkgoT().TempDir(), "jsv.sh")
+	Expect(os.WriteFile(path, []byte("#!/bin/sh\n"+content), 0755)).To(Succeed())
+	return path
+}
+
+var _ = Describe("Server", func() {
+
+	Context("timeouts", func() {
+
+		It("should kill a JSV which does not start", func() {
+			server, err := jsvserver.NewJSVTestServer(script(`read line
+echo "SEND ENV"
+exec sleep 10
+`), jsvserver.WithTimeout(200*time.Millisecond))
+			Expect(err).ToNot(HaveOccurred())
+
+			start := time.Now()
+			err = server.Start()
+			var timeout *jsvserver.TimeoutError
+			Expect(errors.As(err, &timeout)).To(BeTrue())
+			Expect(timeout.Phase).To(Equal("start"))
+			Expect(timeout.Timeout).To(Equal(200 * time.Millisecond))
+			Expect(timeout.Output).To(Equal([]string{"SEND ENV"}))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(server.Stop()).To(Succeed())
+		})
+
+		It("should kill a JSV which does not verify a job", func() {
+			server, err := jsvserver.NewJSVTestServer(script(`while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN) echo "LOG INFO checking"; exec sleep 10 ;;
+  esac
+done
+`), jsvserver.WithJobTimeout(200*time.Millisecond))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+
+			_, err = server.SendJob(&jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh"})
+			var timeout *jsvserver.TimeoutError
+			Expect(errors.As(err, &timeout)).To(BeTrue())
+			Expect(timeout.Phase).To(Equal("job"))
+			Expect(timeout.Output).To(Equal([]string{"LOG INFO checking"}))
+
+			_, err = server.SendJob(&jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh"})
+			Expect(err).To(HaveOccurred())
+			Expect(server.Stop()).To(Succeed())
+		})
+
+		It("should kill a JSV which does not exit", func() {
+			server, err := jsvserver.NewJSVTestServer(script(`while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    QUIT) exec sleep 10 ;;
+  esac
+done
+`), jsvserver.WithStopTimeout(200*time.Millisecond))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+
+			err = server.Stop()
+			var timeout *jsvserver.TimeoutError
+			Expect(errors.As(err, &timeout)).To(BeTrue())
+			Expect(timeout.Phase).To(Equal("stop"))
+		})
+		It("should not leak the reader of a killed JSV", func() {
+			// the JSV sends a line after the result which is never read
+			jsv := script(`while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN) echo "RESULT STATE ACCEPT"; echo "LOG INFO done" ;;
+  esac
+done
+`)
+			before := runtime.NumGoroutine()
+			for i := 0; i < 10; i++ {
+				server, err := jsvserver.NewJSVTestServer(jsv,
+					jsvserver.WithFaults(jsvserver.Faults{CloseStdinAtJob: 1}))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(server.Start()).To(Succeed())
+				_, err = server.SendJob(&jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh"})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(server.Stop()).To(Succeed())
+			}
+			Eventually(runtime.NumGoroutine).WithTimeout(5 * time.Second).Should(BeNumerically("<", before+5))
+		})
+	})
+
+	Context("results", func() {
+
+		It("should capture logs, errors, stderr, and the transcript", func() {
+			server, err := jsvserver.NewJSVTestServer(script(`while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN)
+      echo "LOG INFO checking job"
+      echo "LOG WARNING no runtime requested"
+      echo "ERROR unknown command"
+      echo "debug output" >&2
+      echo "RESULT STATE ACCEPT"
+      ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+			defer server.Stop()
+
+			result, err := server.SendJob(&jsvserver.JobSpec{Context: "client", Client: "qsub", CmdName: "job.sh"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.State).To(Equal("ACCEPT"))
+			Expect(result.Logs).To(Equal([]jsvserver.LogMessage{
+				{Level: "INFO", Message: "checking job"},
+				{Level: "WARNING", Message: "no runtime requested"},
+			}))
+			Expect(result.LogMessages("warning")).To(Equal([]string{"no runtime requested"}))
+			Expect(result.Logged("INFO", "checking")).To(BeTrue())
+			Expect(result.Logged("ERROR", "checking")).To(BeFalse())
+			Expect(result.Errors).To(Equal([]string{"unknown command"}))
+			Expect(result.HasError("unknown")).To(BeTrue())
+			Expect(result.Stderr).To(Equal([]string{"debug output"}))
+			Expect(result.StderrContains("debug")).To(BeTrue())
+			Expect(result.Transcript[0]).To(Equal(jsvserver.TranscriptEntry{Source: jsvserver.FromServer, Line: "PARAM VERSION 1.0"}))
+			Expect(result.TranscriptString()).To(HaveSuffix("> BEGIN\n< LOG INFO checking job\n< LOG WARNING no runtime requested\n< ERROR unknown command\n< RESULT STATE ACCEPT\n"))
+
+			// stderr is correlated to the job
+			result, err = server.SendJob(&jsvserver.JobSpec{Context: "client", Client: "qsub", CmdName: "job.sh"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Stderr).To(Equal([]string{"debug output"}))
+		})
+	})
+
+	Context("effective job", func() {
+
+		It("should apply the modifications of the JSV", func() {
+			server, err := jsvserver.NewJSVTestServer(script(`state=CORRECT
+while read line; do
+  case "$line" in
+    START) echo "SEND ENV"; echo STARTED ;;
+    "PARAM N accept") state=ACCEPT ;;
+    "PARAM N reject") state=REJECT ;;
+    BEGIN)
+      echo "PARAM q_hard long.q"
+      echo "PARAM N"
+      echo "PARAM P project"
+      echo "ENV ADD FOO bar"
+      echo "ENV MOD PATH /usr/bin"
+      echo "ENV DEL DISPLAY"
+      echo "RESULT STATE $state"
+      ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+			defer server.Stop()
+
+			job := &jsvserver.JobSpec{
+				Context: "client",
+				Client:  "qsub",
+				CmdName: "job.sh",
+				Params:  map[string]string{"q_hard": "all.q", "N": "test", "l_hard": "h_rt=99"},
+				Environment: map[string]string{
+					"DISPLAY": ":0", "PATH": "/bin",
+				},
+			}
+			result, err := server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.State).To(Equal("CORRECT"))
+			Expect(result.ModifiedParams).To(HaveKeyWithValue("N", ""))
+			Expect(result.Job.Params).To(Equal(map[string]string{"q_hard": "long.q", "l_hard": "h_rt=99", "P": "project"}))
+			Expect(result.Job.Environment).To(Equal(map[string]string{"PATH": "/usr/bin", "FOO": "bar"}))
+			Expect(result.Diff).To(Equal(jsvserver.Diff{
+				AddedParams:   map[string]string{"P": "project"},
+				ChangedParams: map[string]jsvserver.ValueChange{"q_hard": {Old: "all.q", New: "long.q"}},
+				DeletedParams: []string{"N"},
+				AddedEnv:      map[string]string{"FOO": "bar"},
+				ChangedEnv:    map[string]jsvserver.ValueChange{"PATH": {Old: "/bin", New: "/usr/bin"}},
+				DeletedEnv:    []string{"DISPLAY"},
+			}))
+			Expect(result.Diff.String()).To(Equal(`+PARAM P project
+~PARAM q_hard all.q -> long.q
+-PARAM N
++ENV FOO bar
+~ENV PATH /bin -> /usr/bin
+-ENV DISPLAY`))
+			// the submitted job is not modified
+			Expect(job.Params).To(HaveKeyWithValue("N", "test"))
+
+			// accepted jobs are modified like corrected jobs
+			job.Params["N"] = "accept"
+			result, err = server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.State).To(Equal("ACCEPT"))
+			Expect(result.Job.Params).To(Equal(map[string]string{"q_hard": "long.q", "l_hard": "h_rt=99", "P": "project"}))
+			Expect(result.Diff.IsEmpty()).To(BeFalse())
+
+			job.Params["N"] = "reject"
+			result, err = server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Job).To(BeNil())
+		})
+	})
+
+	Context("supervisor", func() {
+
+		// jsv accepts jobs; the first process behaves like the given
+		// shell commands on BEGIN
+		jsv := func(firstBegin string) string {
+			return script(`dir=$(dirname "$0")
+first=0
+if [ ! -f "$dir/started" ]; then touch "$dir/started"; first=1; fi
+while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN)
+      if [ $first = 1 ]; then first=0; ` + firstBegin + `; fi
+      echo "RESULT STATE ACCEPT"
+      ;;
+    QUIT) exit 0 ;;
+  esac
+done
+`)
+		}
+		job := &jsvserver.JobSpec{Client: "qsub", CmdName: "job.sh"}
+
+		It("should restart a JSV after a timeout", func() {
+			server, err := jsvserver.NewJSVTestServer(jsv("exec sleep 10"),
+				jsvserver.WithJobTimeout(200*time.Millisecond),
+				jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+			defer server.Stop()
+
+			_, err = server.SendJob(job)
+			var timeout *jsvserver.TimeoutError
+			Expect(errors.As(err, &timeout)).To(BeTrue())
+
+			result, err := server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.State).To(Equal("ACCEPT"))
+			Expect(result.TranscriptString()).To(HavePrefix("> START\n< STARTED\n"))
+			Expect(server.Restarts()).To(Equal([]jsvserver.Restart{{Reason: jsvserver.RestartTimeout, Job: 1}}))
+		})
+
+		It("should restart a JSV after unknown commands", func() {
+			server, err := jsvserver.NewJSVTestServer(jsv(`echo "UNKNOWN"`),
+				jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+			defer server.Stop()
+
+			for i := 0; i < 3; i++ {
+				result, err := server.SendJob(job)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(result.State).To(Equal("ACCEPT"))
+			}
+			Expect(server.RestartCount(jsvserver.RestartError)).To(Equal(1))
+			Expect(server.RestartCount("")).To(Equal(1))
+		})
+
+		It("should restart a JSV every N jobs", func() {
+			server, err := jsvserver.NewJSVTestServer(jsv("true"),
+				jsvserver.WithRestartPolicy(jsvserver.RestartPolicy{EveryJobs: 2}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+
+			for i := 0; i < 5; i++ {
+				_, err := server.SendJob(job)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(server.Restarts()).To(Equal([]jsvserver.Restart{
+				{Reason: jsvserver.RestartJobs, Job: 2},
+				{Reason: jsvserver.RestartJobs, Job: 4},
+			}))
+			Expect(server.Stop()).To(Succeed())
+		})
+
+		It("should restart a crashed JSV", func() {
+			server, err := jsvserver.NewJSVTestServer(jsv("true"),
+				jsvserver.WithRestartPolicy(jsvserver.RestartPolicy{OnExit: true, MaxRestarts: 1}),
+				jsvserver.WithFaults(jsvserver.Faults{KillAtJob: 1, SlowWrite: time.Millisecond}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+			defer server.Stop()
+
+			_, err = server.SendJob(job)
+			Expect(err).To(HaveOccurred())
+			_, err = server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.RestartCount(jsvserver.RestartExit)).To(Equal(1))
+		})
+
+		It("should let a JSV finish the job when stdin is closed", func() {
+			server, err := jsvserver.NewJSVTestServer(jsv("sleep 0.1"),
+				jsvserver.WithRestartPolicy(jsvserver.QmasterRestartPolicy()),
+				jsvserver.WithFaults(jsvserver.Faults{CloseStdinAtJob: 1, SlowRead: time.Millisecond}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+
+			result, err := server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.State).To(Equal("ACCEPT"))
+			_, err = server.SendJob(job)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Restarts()).To(Equal([]jsvserver.Restart{{Reason: jsvserver.RestartExit, Job: 1}}))
+			Expect(server.Stop()).To(Succeed())
+		})
+
+		It("should stop restarting after the limit", func() {
+			server, err := jsvserver.NewJSVTestServer(script(`while read line; do
+  case "$line" in
+    START) echo STARTED ;;
+    BEGIN) exit 1 ;;
+  esac
+done
+`), jsvserver.WithRestartPolicy(jsvserver.RestartPolicy{OnExit: true, MaxRestarts: 1}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Start()).To(Succeed())
+			defer server.Stop()
+
+			_, err = server.SendJob(job)
+			Expect(err).To(HaveOccurred())
+			_, err = server.SendJob(job)
+			Expect(err).To(HaveOccurred())
+			_, err = server.SendJob(job)
+			Expect(err).To(MatchError(ContainSubstring("limit of 1 restarts reached")))
+			Expect(server.RestartCount("")).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,183 @@
+package jsvserver
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Reasons of JSV restarts.
+const (
+	// RestartTimeout is a restart after the JSV did not respond in
+	// time.
+	RestartTimeout = "timeout"
+	// RestartExit is a restart after the JSV exited or closed its
+	// stdin or stdout.
+	RestartExit = "exit"
+	// RestartError is a restart after the JSV sent ERROR or an
+	// unknown command.
+	RestartError = "error"
+	// RestartJobs is a restart after the JSV verified
+	// RestartPolicy.EveryJobs jobs.
+	RestartJobs = "jobs"
+)
+
+// RestartPolicy defines when the test server restarts the JSV. The
+// JSV is restarted before the next job: the failed job returns its
+// error, the following jobs are sent to the new JSV process, which
+// gets the START/STARTED handshake like the first one.
+type RestartPolicy struct {
+	// OnTimeout restarts the JSV after it was killed because it did
+	// not respond in time.
+	OnTimeout bool
+	// OnExit restarts the JSV after it exited unexpectedly.
+	OnExit bool
+	// OnError restarts the JSV after it sent ERROR or a command the
+	// protocol does not know.
+	OnError bool
+	// EveryJobs restarts the JSV gracefully (QUIT) after the given
+	// number of jobs. 0 disables it.
+	EveryJobs int
+	// MaxRestarts limits the number of restarts. 0 means no limit.
+	MaxRestarts int
+}
+
+// QmasterRestartPolicy returns the policy of qmaster, which restarts
+// a server JSV after timeouts, crashes, and protocol errors.
+func QmasterRestartPolicy() RestartPolicy {
+	return RestartPolicy{OnTimeout: true, OnExit: true, OnError: true}
+}
+
+// Restart is a restart of the JSV.
+type Restart struct {
+	// Reason is RestartTimeout, RestartExit, RestartError, or
+	// RestartJobs.
+	Reason string
+	// Job is the number of the job after which the JSV was restarted,
+	// starting with 1.
+	Job int
+}
+
+// Faults are faults the test server injects to verify that a JSV
+// recovers from them.
+type Faults struct {
+	// SlowRead delays processing each line the JSV sends.
+	SlowRead time.Duration
+	// SlowWrite delays each line sent to the JSV.
+	SlowWrite time.Duration
+	// CloseStdinAtJob closes stdin of the JSV after BEGIN of the given
+	// job (starting with 1). The JSV must still send the result and
+	// exit afterwards.
+	CloseStdinAtJob int
+	// KillAtJob kills the JSV before BEGIN of the given job (starting
+	// with 1), like a crash of the JSV while the job is sent.
+	KillAtJob int
+}
+
+// WithRestartPolicy enables the supervisor mode which restarts the JSV
+// like qmaster does.
+func WithRestartPolicy(policy RestartPolicy) Option {
+	return func(s *JSVTestServer) {
+		s.policy = policy
+	}
+}
+
+// WithFaults injects faults into the communication with the JSV.
+func WithFaults(faults Faults) Option {
+	return func(s *JSVTestServer) {
+		s.faults = faults
+	}
+}
+
+// Restarts returns the restarts of the JSV in the order they happened.
+func (s *JSVTestServer) Restarts() []Restart {
+	return append([]Restart{}, s.restarts...)
+}
+
+// RestartCount returns the number of restarts with the given reason,
+// or of all restarts when the reason is empty.
+func (s *JSVTestServer) RestartCount(reason string) int {
+	count := 0
+	for _, restart := range s.restarts {
+		if reason == "" || restart.Reason == reason {
+			count++
+		}
+	}
+	return count
+}
+
+// Points of the job where faults are injected.
+const (
+	beforeBegin = iota
+	afterBegin
+)
+
+// injectFaults injects the faults of the current job.
+func (s *JSVTestServer) injectFaults(point int) {
+	switch point {
+	case beforeBegin:
+		if s.faults.KillAtJob == s.jobID {
+			s.proc.kill()
+		}
+	case afterBegin:
+		if s.faults.CloseStdinAtJob == s.jobID {
+			s.proc.closeStdin()
+		}
+	}
+}
+
+// supervise decides with the error of the last job whether the JSV
+// must be restarted before the next job.
+func (s *JSVTestServer) supervise(err error) {
+	_, isTimeout := err.(*TimeoutError)
+	switch {
+	case isTimeout:
+		if s.policy.OnTimeout {
+			s.restartReason = RestartTimeout
+		}
+	case s.proc.failed():
+		if s.policy.OnExit {
+			s.restartReason = RestartExit
+		}
+	case s.protocolError:
+		if s.policy.OnError {
+			s.restartReason = RestartError
+		}
+	case s.policy.EveryJobs > 0 && s.jobsSinceStart >= s.policy.EveryJobs:
+		s.restartReason = RestartJobs
+	}
+}
+
+// restart replaces the JSV process with a new one. A working JSV is
+// stopped with QUIT, a failed one is killed.
+func (s *JSVTestServer) restart(reason string) error {
+	if s.policy.MaxRestarts > 0 && len(s.restarts) >= s.policy.MaxRestarts {
+		return fmt.Errorf("failed to restart JSV (%s): limit of %d restarts reached",
+			reason, s.policy.MaxRestarts)
+	}
+	s.restartReason = ""
+
+	if reason == RestartJobs || reason == RestartError {
+		if err := s.Stop(); err != nil {
+			log.Printf("JSV did not stop cleanly before restart: %v", err)
+		}
+	} else {
+		s.proc.kill()
+		s.proc.wait()
+	}
+
+	proc, err := s.newProc()
+	if err != nil {
+		return fmt.Errorf("failed to restart JSV (%s): %w", reason, err)
+	}
+	s.proc = proc
+	s.restarts = append(s.restarts, Restart{Reason: reason, Job: s.jobID})
+	log.Printf("Restarting JSV after job %d (%s)", s.jobID, reason)
+
+	if err := s.Start(); err != nil {
+		// the new JSV can be restarted again before the next job
+		s.supervise(err)
+		return fmt.Errorf("failed to restart JSV (%s): %w", reason, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package jsvtesting
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// assert reports an error of the test when the check fails.
+func assert(t testing.TB, result *jsvserver.JSVResult, expectation string, c check) bool {
+	t.Helper()
+	if result == nil {
+		t.Errorf("expected the JSV result to %s, but there is no result", expectation)
+		return false
+	}
+	ok, detail := c(result)
+	if !ok {
+		t.Errorf("expected the JSV result to %s, but %s", expectation, detail)
+	}
+	return ok
+}
+
+// AssertAccepted reports an error when the JSV did not accept the job.
+func AssertAccepted(t testing.TB, result *jsvserver.JSVResult) bool {
+	t.Helper()
+	return assert(t, result, "be accepted", hasState("ACCEPT"))
+}
+
+// AssertCorrected reports an error when the JSV did not correct the
+// job.
+func AssertCorrected(t testing.TB, result *jsvserver.JSVResult) bool {
+	t.Helper()
+	return assert(t, result, "be corrected", hasState("CORRECT"))
+}
+
+// AssertRejected reports an error when the JSV did not reject the job.
+func AssertRejected(t testing.TB, result *jsvserver.JSVResult) bool {
+	t.Helper()
+	return assert(t, result, "be rejected", hasState("REJECT", "REJECT_WAIT"))
+}
+
+// AssertRejectedWith reports an error when the JSV did not reject the
+// job with a message which contains the substring.
+func AssertRejectedWith(t testing.TB, result *jsvserver.JSVResult, substring string) bool {
+	t.Helper()
+	return assert(t, result, fmt.Sprintf("be rejected with %q", substring), isRejectedWith(substring))
+}
+
+// AssertModifiedParam reports an error when the JSV did not set the
+// parameter to the value.
+func AssertModifiedParam(t testing.TB, result *jsvserver.JSVResult, name, value string) bool {
+	t.Helper()
+	return assert(t, result, fmt.Sprintf("have modified %s to %q", name, value), hasModifiedParam(name, value))
+}
+
+// AssertSubParam reports an error when the list parameter of the job
+// qmaster would store does not have the element with the value.
+func AssertSubParam(t testing.TB, result *jsvserver.JSVResult, param, subParam, value string) bool {
+	t.Helper()
+	return assert(t, result, fmt.Sprintf("have %s=%s in %s", subParam, value, param), hasSubParam(param, subParam, value))
+}
+
+// AssertLogged reports an error when the JSV did not log a message with
+// the level, any level when empty, which matches the regular
+// expression.
+func AssertLogged(t testing.TB, result *jsvserver.JSVResult, level, pattern string) bool {
+	t.Helper()
+	return assert(t, result, fmt.Sprintf("have logged %s %q", level, pattern), hasLogged(level, pattern))
+}
+
+// StartServer starts a test server for the JSV executable, which is
+// stopped when the test ends.
+func StartServer(t testing.TB, jsvPath string, options ...jsvserver.Option) *jsvserver.JSVTestServer {
+	t.Helper()
+	server, err := jsvserver.NewJSVTestServer(jsvPath, options...)
+	if err != nil {
+		t.Fatalf("failed to create JSV test server: %v", err)
+	}
+	start(t, server)
+	return server
+}
+
+// StartInProcess starts an in-process test server for the functions,
+// see jsvserver.NewInProcessJSVTestServer. It is stopped when the test
+// ends.
+func StartInProcess(t testing.TB, checkEnvironment bool, verificationFunction, onStartFunction func(), options ...jsvserver.Option) *jsvserver.JSVTestServer {
+	t.Helper()
+	server, err := jsvserver.NewInProcessJSVTestServer(checkEnvironment, verificationFunction, onStartFunction, options...)
+	if err != nil {
+		t.Fatalf("failed to create JSV test server: %v", err)
+	}
+	start(t, server)
+	return server
+}
+
+func start(t testing.TB, server *jsvserver.JSVTestServer) {
+	t.Helper()
+	if err := server.Start(); err != nil {
+		server.Stop()
+		t.Fatalf("failed to start JSV: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := server.Stop(); err != nil {
+			t.Errorf("failed to stop JSV: %v", err)
+		}
+	})
+}
+
+// SendJob sends the job to the JSV and fails the test when the JSV
+// could not verify it.
+func SendJob(t testing.TB, server *jsvserver.JSVTestServer, job *jsvserver.JobSpec) *jsvserver.JSVResult {
+	t.Helper()
+	result, err := server.SendJob(job)
+	if err != nil {
+		t.Fatalf("failed to verify job: %v", err)
+	}
+	return result
+}
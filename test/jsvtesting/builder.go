@@ -0,0 +1,145 @@
+package jsvtesting
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// JobBuilder builds a job specification step by step:
+//
+//	job := jsvtesting.NewJob().User("alice").Queue("long.q").
+//		HardResource("h_rt", "3600").Env("PATH", "/bin").Build()
+type JobBuilder struct {
+	job *jsvserver.JobSpec
+}
+
+// NewJob returns a builder of a job which was submitted with qsub in
+// the client context.
+func NewJob() *JobBuilder {
+	return &JobBuilder{job: &jsvserver.JobSpec{
+		Context:     "client",
+		Client:      "qsub",
+		User:        "testuser",
+		Group:       "testgroup",
+		CmdName:     "job.sh",
+		Params:      make(map[string]string),
+		Environment: make(map[string]string),
+	}}
+}
+
+// Build returns the job. The builder can be used for more jobs.
+func (b *JobBuilder) Build() *jsvserver.JobSpec {
+	return b.job.Copy()
+}
+
+// Context sets the context, "client" or "master".
+func (b *JobBuilder) Context(context string) *JobBuilder {
+	b.job.Context = context
+	return b
+}
+
+// Client sets the submit client, like "qsub" or "qrsh".
+func (b *JobBuilder) Client(client string) *JobBuilder {
+	b.job.Client = client
+	return b
+}
+
+// User sets the submitting user.
+func (b *JobBuilder) User(user string) *JobBuilder {
+	b.job.User = user
+	return b
+}
+
+// Group sets the primary group of the submitting user.
+func (b *JobBuilder) Group(group string) *JobBuilder {
+	b.job.Group = group
+	return b
+}
+
+// Command sets the job script or binary and its arguments.
+func (b *JobBuilder) Command(name string, args ...string) *JobBuilder {
+	for n := 0; n < b.job.CmdArgs; n++ {
+		delete(b.job.Params, fmt.Sprintf("CMDARG%d", n))
+	}
+	b.job.CmdName = name
+	b.job.CmdArgs = len(args)
+	for n, arg := range args {
+		b.job.Params[fmt.Sprintf("CMDARG%d", n)] = arg
+	}
+	return b
+}
+
+// Param sets a parameter, like Param("N", "myjob").
+func (b *JobBuilder) Param(name, value string) *JobBuilder {
+	b.job.Params[name] = value
+	return b
+}
+
+// SubParam sets an element of a list parameter, like
+// SubParam("l_hard", "h_rt", "600"). An element with the same name is
+// replaced.
+func (b *JobBuilder) SubParam(param, subParam, value string) *JobBuilder {
+	element := subParam
+	if value != "" {
+		element += "=" + value
+	}
+	var elements []string
+	replaced := false
+	if list := b.job.Params[param]; list != "" {
+		for _, existing := range strings.Split(list, ",") {
+			if name, _, _ := strings.Cut(existing, "="); name == subParam {
+				existing = element
+				replaced = true
+			}
+			elements = append(elements, existing)
+		}
+	}
+	if !replaced {
+		elements = append(elements, element)
+	}
+	b.job.Params[param] = strings.Join(elements, ",")
+	return b
+}
+
+// HardResource requests a resource, like qsub -hard -l.
+func (b *JobBuilder) HardResource(name, value string) *JobBuilder {
+	return b.SubParam("l_hard", name, value)
+}
+
+// SoftResource requests a resource, like qsub -soft -l.
+func (b *JobBuilder) SoftResource(name, value string) *JobBuilder {
+	return b.SubParam("l_soft", name, value)
+}
+
+// Queue requests a queue, like qsub -q.
+func (b *JobBuilder) Queue(queue string) *JobBuilder {
+	return b.SubParam("q_hard", queue, "")
+}
+
+// PE requests a parallel environment with a range of slots, like
+// qsub -pe mpi 4-8.
+func (b *JobBuilder) PE(name string, min, max int) *JobBuilder {
+	b.job.Params["pe_name"] = name
+	b.job.Params["pe_min"] = strconv.Itoa(min)
+	b.job.Params["pe_max"] = strconv.Itoa(max)
+	return b
+}
+
+// Project sets the project, like qsub -P.
+func (b *JobBuilder) Project(project string) *JobBuilder {
+	return b.Param("P", project)
+}
+
+// Name sets the job name, like qsub -N.
+func (b *JobBuilder) Name(name string) *JobBuilder {
+	return b.Param("N", name)
+}
+
+// Env sets an environment variable of the job.
+func (b *JobBuilder) Env(name, value string) *JobBuilder {
+	b.job.Environment[name] = value
+	return b
+}
@@ -0,0 +1,112 @@
+// Package jsvtesting has Gomega matchers, testing.T assertions, and a
+// job builder for tests of JSVs with the jsvserver test server.
+//
+//	result, err := server.SendJob(jsvtesting.NewJob().Queue("long.q").HardResource("h_rt", "60").Build())
+//	Expect(err).ToNot(HaveOccurred())
+//	Expect(result).To(HaveSubParam("l_hard", "h_rt", "600"))
+package jsvtesting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// check returns true when the result fulfills the expectation, and
+// describes the relevant part of the result for the failure message.
+type check func(result *jsvserver.JSVResult) (bool, string)
+
+func describeResult(result *jsvserver.JSVResult) string {
+	if result.Message == "" {
+		return "the state is " + result.State
+	}
+	return fmt.Sprintf("the state is %s (%q)", result.State, result.Message)
+}
+
+func hasState(states ...string) check {
+	return func(result *jsvserver.JSVResult) (bool, string) {
+		for _, state := range states {
+			if result.State == state {
+				return true, describeResult(result)
+			}
+		}
+		return false, describeResult(result)
+	}
+}
+
+// isRejectedWith checks REJECT and REJECT_WAIT results with a message
+// which contains the substring.
+func isRejectedWith(substring string) check {
+	return func(result *jsvserver.JSVResult) (bool, string) {
+		rejected := result.State == "REJECT" || result.State == "REJECT_WAIT"
+		return rejected && strings.Contains(result.Message, substring), describeResult(result)
+	}
+}
+
+func hasModifiedParam(name, value string) check {
+	return func(result *jsvserver.JSVResult) (bool, string) {
+		modified, exists := result.ModifiedParams[name]
+		if !exists {
+			return false, fmt.Sprintf("the JSV did not modify %s, it modified %v", name, result.ModifiedParams)
+		}
+		return modified == value, fmt.Sprintf("the JSV modified %s to %q", name, modified)
+	}
+}
+
+// hasSubParam checks an element of a list parameter, like h_rt of
+// l_hard, of the job qmaster would store.
+func hasSubParam(param, subParam, value string) check {
+	return func(result *jsvserver.JSVResult) (bool, string) {
+		if result.Job == nil {
+			return false, "the job was not stored, " + describeResult(result)
+		}
+		list, exists := result.Job.Params[param]
+		if !exists {
+			return false, fmt.Sprintf("the job has no %s", param)
+		}
+		actual, exists := SubParam(list, subParam)
+		if !exists {
+			return false, fmt.Sprintf("%s of the job is %q", param, list)
+		}
+		return actual == value, fmt.Sprintf("%s of the job is %q", param, list)
+	}
+}
+
+// hasLogged checks for a LOG message with the level, any level when
+// empty, which matches the regular expression.
+func hasLogged(level, pattern string) check {
+	return func(result *jsvserver.JSVResult) (bool, string) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Sprintf("the pattern is invalid: %v", err)
+		}
+		for _, message := range result.LogMessages(level) {
+			if re.MatchString(message) {
+				return true, fmt.Sprintf("the JSV logged %q", message)
+			}
+		}
+		if len(result.Logs) == 0 {
+			return false, "the JSV logged nothing"
+		}
+		var logs []string
+		for _, log := range result.Logs {
+			logs = append(logs, log.Level+" "+log.Message)
+		}
+		return false, fmt.Sprintf("the JSV logged %q", logs)
+	}
+}
+
+// SubParam returns the value of an element of a list parameter, like
+// "600" for "h_rt" of "h_rt=600,mem=1G". The value of an element
+// without "=" is empty.
+func SubParam(list, subParam string) (string, bool) {
+	for _, element := range strings.Split(list, ",") {
+		name, value, _ := strings.Cut(element, "=")
+		if name == subParam {
+			return value, true
+		}
+	}
+	return "", false
+}
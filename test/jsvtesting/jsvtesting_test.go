@@ -0,0 +1,173 @@
+package jsvtesting_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/test/jsvserver"
+	. "github.com/dgruber/jsv/test/jsvtesting"
+)
+
+// verify rejects jobs without runtime limit and increases short ones.
+func verify() {
+	runtime, exists := jsv.SubGetParam("l_hard", "h_rt")
+	seconds, _ := strconv.Atoi(runtime)
+	switch {
+	case !exists:
+		jsv.LogWarning("no runtime limit")
+		jsv.Reject("No hard runtime limit requested (h_rt)")
+	case seconds < 600:
+		jsv.LogInfo("runtime " + runtime + " increased")
+		jsv.SubAddParam("l_hard", "h_rt", "600")
+		jsv.Correct("Runtime limit was increased to 10 minutes")
+	default:
+		jsv.Accept("")
+	}
+}
+
+// recorder records the errors of the assertions.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+var _ = Describe("Jsvtesting", func() {
+
+	var server *jsvserver.JSVTestServer
+
+	BeforeEach(func() {
+		var err error
+		server, err = jsvserver.NewInProcessJSVTestServer(false, verify, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Stop)
+	})
+
+	Context("matchers", func() {
+
+		It("should match the results", func() {
+			result, err := server.SendJob(NewJob().HardResource("h_rt", "60").Build())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(BeCorrected())
+			Expect(result).ToNot(BeAccepted())
+			Expect(result).To(HaveModifiedParam("l_hard", "h_rt=600"))
+			Expect(result).To(HaveSubParam("l_hard", "h_rt", "600"))
+			Expect(result).To(HaveLogged("INFO", `runtime \d+ increased`))
+			Expect(result).To(HaveLogged("", "increased"))
+			Expect(result).ToNot(HaveLogged("WARNING", ""))
+
+			result, err = server.SendJob(NewJob().Build())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(BeRejected())
+			Expect(result).To(BeRejectedWith("No hard runtime limit"))
+			Expect(result).ToNot(HaveSubParam("l_hard", "h_rt", "600"))
+		})
+
+		It("should describe the result in the failure message", func() {
+			result, err := server.SendJob(NewJob().Build())
+			Expect(err).ToNot(HaveOccurred())
+
+			matcher := BeAccepted()
+			Expect(matcher.Match(result)).To(BeFalse())
+			Expect(matcher.FailureMessage(result)).To(Equal(
+				`Expected the JSV result to be accepted, but the state is REJECT ("No hard runtime limit requested (h_rt)")`))
+
+			matcher = HaveLogged("INFO", "runtime")
+			Expect(matcher.Match(result)).To(BeFalse())
+			Expect(matcher.FailureMessage(result)).To(Equal(
+				`Expected the JSV result to have logged INFO "runtime", but the JSV logged ["WARNING no runtime limit"]`))
+
+			_, err = BeAccepted().Match("ACCEPT")
+			Expect(err).To(MatchError("expected a *jsvserver.JSVResult, got string"))
+		})
+	})
+
+	Context("assertions", func() {
+
+		It("should report failed expectations", func() {
+			result, err := server.SendJob(NewJob().HardResource("h_rt", "60").Build())
+			Expect(err).ToNot(HaveOccurred())
+
+			t := &recorder{}
+			Expect(AssertCorrected(t, result)).To(BeTrue())
+			Expect(AssertSubParam(t, result, "l_hard", "h_rt", "600")).To(BeTrue())
+			Expect(AssertModifiedParam(t, result, "l_hard", "h_rt=600")).To(BeTrue())
+			Expect(AssertLogged(t, result, "INFO", "increased")).To(BeTrue())
+			Expect(t.errors).To(BeEmpty())
+
+			Expect(AssertAccepted(t, result)).To(BeFalse())
+			Expect(AssertRejectedWith(t, result, "runtime")).To(BeFalse())
+			Expect(AssertSubParam(t, result, "l_hard", "mem", "1G")).To(BeFalse())
+			Expect(AssertAccepted(t, nil)).To(BeFalse())
+			Expect(t.errors).To(Equal([]string{
+				`expected the JSV result to be accepted, but the state is CORRECT ("Runtime limit was increased to 10 minutes")`,
+				`expected the JSV result to be rejected with "runtime", but the state is CORRECT ("Runtime limit was increased to 10 minutes")`,
+				`expected the JSV result to have mem=1G in l_hard, but l_hard of the job is "h_rt=600"`,
+				`expected the JSV result to be accepted, but there is no result`,
+			}))
+		})
+	})
+
+	Context("job builder", func() {
+
+		It("should build job specifications", func() {
+			builder := NewJob().User("alice").Command("sim", "-n", "4").
+				Queue("long.q").Queue("all.q").
+				HardResource("h_rt", "60").HardResource("mem", "1G").HardResource("h_rt", "600").
+				SoftResource("arch", "lx-amd64").PE("mpi", 4, 8).Name("sim").Project("physics").
+				Env("PATH", "/bin")
+			job := builder.Build()
+			Expect(job.User).To(Equal("alice"))
+			Expect(job.CmdName).To(Equal("sim"))
+			Expect(job.CmdArgs).To(Equal(2))
+			Expect(job.Params).To(Equal(map[string]string{
+				"CMDARG0": "-n", "CMDARG1": "4",
+				"q_hard":  "long.q,all.q",
+				"l_hard":  "h_rt=600,mem=1G",
+				"l_soft":  "arch=lx-amd64",
+				"pe_name": "mpi", "pe_min": "4", "pe_max": "8",
+				"N": "sim", "P": "physics",
+			}))
+			Expect(job.Environment).To(Equal(map[string]string{"PATH": "/bin"}))
+
+			// the built jobs are independent of the builder
+			other := builder.Command("sim").Param("N", "other").Build()
+			Expect(job.Params["N"]).To(Equal("sim"))
+			Expect(other.Params).ToNot(HaveKey("CMDARG0"))
+			Expect(other.Params).To(HaveKeyWithValue("N", "other"))
+			Expect(other.Params).To(HaveKeyWithValue("q_hard", "long.q,all.q"))
+		})
+
+		It("should return the elements of list parameters", func() {
+			value, exists := SubParam("h_rt=600,mem=1G", "mem")
+			Expect(exists).To(BeTrue())
+			Expect(value).To(Equal("1G"))
+			value, exists = SubParam("long.q,all.q", "all.q")
+			Expect(exists).To(BeTrue())
+			Expect(value).To(BeEmpty())
+			_, exists = SubParam("h_rt=600", "mem")
+			Expect(exists).To(BeFalse())
+		})
+	})
+})
+
+// TestWithoutGinkgo uses the helpers in a plain Go test.
+func TestWithoutGinkgo(t *testing.T) {
+	server := StartInProcess(t, false, verify, nil)
+	result := SendJob(t, server, NewJob().HardResource("h_rt", "3600").Build())
+	AssertAccepted(t, result)
+	result = SendJob(t, server, NewJob().Build())
+	AssertRejectedWith(t, result, "No hard runtime limit")
+	AssertLogged(t, result, "WARNING", "^no runtime")
+}
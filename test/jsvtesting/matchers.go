@@ -0,0 +1,89 @@
+package jsvtesting
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega/types"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// resultMatcher matches a *jsvserver.JSVResult with a check.
+type resultMatcher struct {
+	// expectation completes "Expected the JSV result to ..."
+	expectation string
+	check       check
+	detail      string
+}
+
+func (m *resultMatcher) Match(actual interface{}) (bool, error) {
+	result, ok := actual.(*jsvserver.JSVResult)
+	if !ok || result == nil {
+		return false, fmt.Errorf("expected a *jsvserver.JSVResult, got %T", actual)
+	}
+	var matches bool
+	matches, m.detail = m.check(result)
+	return matches, nil
+}
+
+func (m *resultMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected the JSV result to %s, but %s", m.expectation, m.detail)
+}
+
+func (m *resultMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected the JSV result not to %s, but %s", m.expectation, m.detail)
+}
+
+// BeAccepted succeeds when the JSV accepted the job.
+func BeAccepted() types.GomegaMatcher {
+	return &resultMatcher{expectation: "be accepted", check: hasState("ACCEPT")}
+}
+
+// BeCorrected succeeds when the JSV corrected the job.
+func BeCorrected() types.GomegaMatcher {
+	return &resultMatcher{expectation: "be corrected", check: hasState("CORRECT")}
+}
+
+// BeRejected succeeds when the JSV rejected the job with REJECT or
+// REJECT_WAIT.
+func BeRejected() types.GomegaMatcher {
+	return &resultMatcher{expectation: "be rejected", check: hasState("REJECT", "REJECT_WAIT")}
+}
+
+// BeRejectedWith succeeds when the JSV rejected the job with a message
+// which contains the substring.
+func BeRejectedWith(substring string) types.GomegaMatcher {
+	return &resultMatcher{
+		expectation: fmt.Sprintf("be rejected with %q", substring),
+		check:       isRejectedWith(substring),
+	}
+}
+
+// HaveModifiedParam succeeds when the JSV set the parameter to the
+// value.
+func HaveModifiedParam(name, value string) types.GomegaMatcher {
+	return &resultMatcher{
+		expectation: fmt.Sprintf("have modified %s to %q", name, value),
+		check:       hasModifiedParam(name, value),
+	}
+}
+
+// HaveSubParam succeeds when the list parameter of the job qmaster
+// would store has the element with the value, like
+// HaveSubParam("l_hard", "h_rt", "600").
+func HaveSubParam(param, subParam, value string) types.GomegaMatcher {
+	return &resultMatcher{
+		expectation: fmt.Sprintf("have %s=%s in %s", subParam, value, param),
+		check:       hasSubParam(param, subParam, value),
+	}
+}
+
+// HaveLogged succeeds when the JSV logged a message with the level,
+// any level when empty, which matches the regular expression.
+func HaveLogged(level, pattern string) types.GomegaMatcher {
+	expectation := fmt.Sprintf("have logged %q", pattern)
+	if level != "" {
+		expectation = fmt.Sprintf("have logged %s %q", level, pattern)
+	}
+	return &resultMatcher{expectation: expectation, check: hasLogged(level, pattern)}
+}
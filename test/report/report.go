@@ -0,0 +1,302 @@
+// Package report writes the results of jsvtest runs as JUnit XML, for
+// CI dashboards, and as JSON. Each job specification is a test case.
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+)
+
+// Status of a test case.
+const (
+	// Passed is a job whose result matches the expected result.
+	Passed = "passed"
+	// Failed is a job whose result does not match the expected result.
+	Failed = "failed"
+	// Error is a job which could not be verified by the JSV.
+	Error = "error"
+	// Unchecked is a job without expected result.
+	Unchecked = "unchecked"
+)
+
+// Case is the verification of a job specification.
+type Case struct {
+	// Name is the file name of the job specification.
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// State and Message are the RESULT of the JSV.
+	State         string                 `json:"state,omitempty"`
+	Message       string                 `json:"message,omitempty"`
+	Modifications jsvserver.Diff         `json:"modifications"`
+	Logs          []jsvserver.LogMessage `json:"logs,omitempty"`
+	// Duration is the time the JSV took, encoded in nanoseconds.
+	Duration time.Duration `json:"duration"`
+	// Failures are the mismatches with the expected result.
+	Failures []string `json:"failures,omitempty"`
+	// Error is the error of the verification.
+	Error string `json:"error,omitempty"`
+}
+
+// NewCase returns the test case of a job with the result and the
+// error of the verification, and the mismatches with the expected
+// result. Without expected result, expected must be false.
+func NewCase(name string, result *jsvserver.JSVResult, err error, duration time.Duration, expected bool, mismatches []string) Case {
+	c := Case{Name: name, Duration: duration, Failures: mismatches}
+	switch {
+	case err != nil:
+		c.Status = Error
+		c.Error = err.Error()
+		return c
+	case !expected:
+		c.Status = Unchecked
+	case len(mismatches) > 0:
+		c.Status = Failed
+	default:
+		c.Status = Passed
+	}
+	c.State = result.State
+	c.Message = result.Message
+	c.Modifications = result.Diff
+	c.Logs = result.Logs
+	return c
+}
+
+// Summary are the counts of a report.
+type Summary struct {
+	Tests     int `json:"tests"`
+	Passed    int `json:"passed"`
+	Failed    int `json:"failed"`
+	Errors    int `json:"errors"`
+	Unchecked int `json:"unchecked"`
+	// States are the number of jobs per RESULT state.
+	States map[string]int `json:"states"`
+}
+
+// String returns the summary in one line.
+func (s Summary) String() string {
+	states := make([]string, 0, len(s.States))
+	names := make([]string, 0, len(s.States))
+	for state := range s.States {
+		names = append(names, state)
+	}
+	sort.Strings(names)
+	for _, state := range names {
+		states = append(states, fmt.Sprintf("%s %d", state, s.States[state]))
+	}
+	return fmt.Sprintf("%d tests: %d passed, %d failed, %d errors, %d without expected result (%s)",
+		s.Tests, s.Passed, s.Failed, s.Errors, s.Unchecked, strings.Join(states, ", "))
+}
+
+// Report is the result of a jsvtest run.
+type Report struct {
+	// Name is the name of the test suite, like the job spec directory.
+	Name string `json:"name"`
+	// JSV is the path of the tested JSV.
+	JSV       string        `json:"jsv"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+	Summary   Summary       `json:"summary"`
+	Cases     []Case        `json:"cases"`
+}
+
+// New returns an empty report.
+func New(name, jsv string) *Report {
+	return &Report{
+		Name:      name,
+		JSV:       jsv,
+		Timestamp: time.Now(),
+		Summary:   Summary{States: make(map[string]int)},
+	}
+}
+
+// Add adds a test case and counts it in the summary.
+func (r *Report) Add(c Case) {
+	r.Cases = append(r.Cases, c)
+	r.Summary.Tests++
+	switch c.Status {
+	case Passed:
+		r.Summary.Passed++
+	case Failed:
+		r.Summary.Failed++
+	case Error:
+		r.Summary.Errors++
+	case Unchecked:
+		r.Summary.Unchecked++
+	}
+	if c.State != "" {
+		r.Summary.States[c.State]++
+	}
+}
+
+// WriteJSON writes the report as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+	return nil
+}
+
+// junitTestSuites is the JUnit XML format as read by Jenkins, GitLab
+// and most CI dashboards.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut *junitText    `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitText struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit writes the report as JUnit XML. The result of the JSV is
+// the system-out of a test case, the mismatches are the failure.
+// Jobs without expected result pass.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      r.Name,
+		Tests:     r.Summary.Tests,
+		Failures:  r.Summary.Failed,
+		Errors:    r.Summary.Errors,
+		Time:      seconds(r.Duration),
+		Timestamp: r.Timestamp.Format("2006-01-02T15:04:05"),
+		Properties: []junitProperty{
+			{Name: "jsv", Value: r.JSV},
+		},
+	}
+	states := make([]string, 0, len(r.Summary.States))
+	for state := range r.Summary.States {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		suite.Properties = append(suite.Properties, junitProperty{
+			Name:  "state." + state,
+			Value: fmt.Sprint(r.Summary.States[state]),
+		})
+	}
+
+	for _, c := range r.Cases {
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: r.Name,
+			Time:      seconds(c.Duration),
+		}
+		if out := output(c); out != "" {
+			tc.SystemOut = &junitText{Text: out}
+		}
+		switch c.Status {
+		case Failed:
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%d mismatches with the expected result", len(c.Failures)),
+				Type:    "mismatch",
+				Text:    strings.Join(c.Failures, "\n"),
+			}
+		case Error:
+			tc.Error = &junitMessage{Message: c.Error, Type: "error", Text: c.Error}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	suites := junitTestSuites{
+		Name:     r.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	return nil
+}
+
+// WriteFile writes the report into a file with the given write
+// function, like (*Report).WriteJUnit.
+func (r *Report) WriteFile(path string, write func(*Report, io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := write(r, file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close report: %w", err)
+	}
+	return nil
+}
+
+// output returns the result of the JSV like "RESULT STATE CORRECT
+// message" followed by the modifications and logs.
+func output(c Case) string {
+	if c.State == "" {
+		return ""
+	}
+	lines := []string{strings.TrimSpace("RESULT STATE " + c.State + " " + c.Message)}
+	if diff := c.Modifications.String(); diff != "" {
+		lines = append(lines, diff)
+	}
+	for _, log := range c.Logs {
+		lines = append(lines, fmt.Sprintf("LOG %s %s", log.Level, log.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,105 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/test/jsvserver"
+	"github.com/dgruber/jsv/test/report"
+)
+
+var _ = Describe("Report", func() {
+
+	var r *report.Report
+
+	BeforeEach(func() {
+		corrected := &jsvserver.JSVResult{
+			State:   "CORRECT",
+			Message: "runtime added",
+			Logs:    []jsvserver.LogMessage{{Level: "INFO", Message: "no runtime"}},
+			Diff:    jsvserver.Diff{AddedParams: map[string]string{"l_hard": "h_rt=3600"}},
+		}
+		rejected := &jsvserver.JSVResult{State: "REJECT", Message: "no project"}
+
+		r = report.New("jobspecs", "/usr/local/bin/jsv")
+		r.Add(report.NewCase("job1.json", corrected, nil, 20*time.Millisecond, true, nil))
+		r.Add(report.NewCase("job2.json", rejected, nil, 10*time.Millisecond, true,
+			[]string{"state: expected ACCEPT, got REJECT"}))
+		r.Add(report.NewCase("job3.json", rejected, nil, 10*time.Millisecond, false, nil))
+		r.Add(report.NewCase("job4.json", nil, errors.New("JSV did not respond"), time.Second, false, nil))
+		r.Duration = 1040 * time.Millisecond
+	})
+
+	It("should count the cases and the states", func() {
+		Expect(r.Summary).To(Equal(report.Summary{
+			Tests: 4, Passed: 1, Failed: 1, Errors: 1, Unchecked: 1,
+			States: map[string]int{"CORRECT": 1, "REJECT": 2},
+		}))
+		Expect(r.Summary.String()).To(Equal("4 tests: 1 passed, 1 failed, 1 errors, 1 without expected result (CORRECT 1, REJECT 2)"))
+		Expect(r.Cases[3].Status).To(Equal(report.Error))
+		Expect(r.Cases[3].State).To(BeEmpty())
+	})
+
+	It("should write JUnit XML", func() {
+		var b bytes.Buffer
+		Expect(r.WriteJUnit(&b)).To(Succeed())
+
+		var suites struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Errors   int `xml:"errors,attr"`
+			Suite    struct {
+				Name       string `xml:"name,attr"`
+				Time       string `xml:"time,attr"`
+				Properties []struct {
+					Name  string `xml:"name,attr"`
+					Value string `xml:"value,attr"`
+				} `xml:"properties>property"`
+				Cases []struct {
+					Name      string  `xml:"name,attr"`
+					Time      string  `xml:"time,attr"`
+					Failure   *string `xml:"failure"`
+					Error     *string `xml:"error"`
+					SystemOut string  `xml:"system-out"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		Expect(xml.Unmarshal(b.Bytes(), &suites)).To(Succeed())
+		Expect(suites.Tests).To(Equal(4))
+		Expect(suites.Failures).To(Equal(1))
+		Expect(suites.Errors).To(Equal(1))
+		Expect(suites.Suite.Name).To(Equal("jobspecs"))
+		Expect(suites.Suite.Time).To(Equal("1.040"))
+		Expect(suites.Suite.Properties).To(HaveLen(3))
+		Expect(suites.Suite.Properties[2].Name).To(Equal("state.REJECT"))
+		Expect(suites.Suite.Properties[2].Value).To(Equal("2"))
+
+		cases := suites.Suite.Cases
+		Expect(cases).To(HaveLen(4))
+		Expect(cases[0].Time).To(Equal("0.020"))
+		Expect(cases[0].Failure).To(BeNil())
+		Expect(cases[0].SystemOut).To(Equal("RESULT STATE CORRECT runtime added\n+PARAM l_hard h_rt=3600\nLOG INFO no runtime"))
+		Expect(*cases[1].Failure).To(Equal("state: expected ACCEPT, got REJECT"))
+		Expect(cases[2].Failure).To(BeNil())
+		Expect(*cases[3].Error).To(Equal("JSV did not respond"))
+	})
+
+	It("should write JSON", func() {
+		var b bytes.Buffer
+		Expect(r.WriteJSON(&b)).To(Succeed())
+
+		var decoded report.Report
+		Expect(json.Unmarshal(b.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded.Summary).To(Equal(r.Summary))
+		Expect(decoded.Cases).To(HaveLen(4))
+		Expect(decoded.Cases[0].Modifications.AddedParams).To(HaveKeyWithValue("l_hard", "h_rt=3600"))
+		Expect(decoded.Cases[1].Failures).To(Equal([]string{"state: expected ACCEPT, got REJECT"}))
+		Expect(decoded.Cases[1].Duration).To(Equal(10 * time.Millisecond))
+	})
+})
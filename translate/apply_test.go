@@ -0,0 +1,140 @@
+package translate_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv"
+	"github.com/dgruber/jsv/test/jsvserver"
+	"github.com/dgruber/jsv/translate"
+)
+
+// applied is the outcome of Apply which the JSV sends as message
+type applied struct {
+	Statuses map[string]translate.Status
+	Report   string
+}
+
+func init() {
+	// translate translates and applies the directives of the job script
+	// with the translator of the configuration (slurm or pbs)
+	jsvs["translate"] = func() {
+		var name string
+		readConfig(&name)
+		translator := translate.NewSlurm()
+		if name == "pbs" {
+			translator = translate.NewPBS()
+		}
+		jsv.Run(false, func() {
+			report, err := translator.TranslateJob()
+			if err != nil {
+				jsv.Reject(err.Error())
+				return
+			}
+			corrected := report.Apply()
+			outcome := applied{Statuses: make(map[string]translate.Status), Report: report.String()}
+			for _, m := range report.Mappings {
+				outcome.Statuses[m.Directive] = m.Status
+			}
+			data, err := json.Marshal(outcome)
+			if err != nil {
+				jsv.Reject(err.Error())
+				return
+			}
+			if corrected {
+				jsv.Correct(string(data))
+				return
+			}
+			jsv.Accept(string(data))
+		}, nil)
+	}
+}
+
+var _ = Describe("Apply", func() {
+
+	var script string
+
+	BeforeEach(func() {
+		script = filepath.Join(GinkgoT().TempDir(), "job.sh")
+		Expect(os.WriteFile(script, []byte(`#!/bin/bash
+#SBATCH --time=2:00:00
+#SBATCH --partition=short
+#SBATCH -J slurmjob
+#SBATCH --nodes=2
+hostname
+`), 0644)).To(Succeed())
+	})
+
+	send := func(params map[string]string) (*jsvserver.JSVResult, applied) {
+		result := verify("translate", "slurm", &jsvserver.JobSpec{Client: "qsub", CmdName: script, Params: params})
+		var outcome applied
+		Expect(json.Unmarshal([]byte(result.Message), &outcome)).To(Succeed())
+		return result, outcome
+	}
+
+	It("should keep the parameters which were requested explicitly", func() {
+		result, outcome := send(map[string]string{"l_hard": "h_rt=600", "N": "explicit"})
+		Expect(result.State).To(Equal("CORRECT"))
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("q_hard", "short"))
+		Expect(result.ModifiedParams).ToNot(HaveKey("l_hard"))
+		Expect(result.ModifiedParams).ToNot(HaveKey("N"))
+
+		Expect(outcome.Statuses).To(Equal(map[string]translate.Status{
+			"--time=2:00:00":    translate.Skipped,
+			"--partition=short": translate.Applied,
+			"-J slurmjob":       translate.Skipped,
+			"--nodes=2":         translate.Untranslatable,
+		}))
+		Expect(outcome.Report).To(ContainSubstring("(skipped: l_hard h_rt was requested explicitly)"))
+		Expect(outcome.Report).To(ContainSubstring("(skipped: N was requested explicitly)"))
+	})
+
+	It("should apply the directives when nothing was requested explicitly", func() {
+		// Grid Engine sends the script name as job name by default
+		result, _ := send(map[string]string{"N": "job.sh"})
+		Expect(result.State).To(Equal("CORRECT"))
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("l_hard", "h_rt=7200"))
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("q_hard", "short"))
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("N", "slurmjob"))
+	})
+
+	It("should apply all directives which change the same parameter", func() {
+		Expect(os.WriteFile(script, []byte(`#!/bin/bash
+#SBATCH --partition=short
+#SBATCH -J first
+#SBATCH -p long
+#SBATCH --job-name=second
+`), 0644)).To(Succeed())
+		result, outcome := send(map[string]string{"N": "job.sh"})
+		Expect(result.State).To(Equal("CORRECT"))
+		// the last directive wins like in Slurm
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("q_hard", "long"))
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("N", "second"))
+		Expect(outcome.Statuses).To(Equal(map[string]translate.Status{
+			"--partition=short": translate.Applied,
+			"-J first":          translate.Applied,
+			"-p long":           translate.Applied,
+			"--job-name=second": translate.Applied,
+		}))
+	})
+
+	It("should not count the default values of boolean options as requested", func() {
+		Expect(os.WriteFile(script, []byte(`#!/bin/bash
+#PBS -j oe
+`), 0644)).To(Succeed())
+		job := &jsvserver.JobSpec{Client: "qsub", CmdName: script, Params: map[string]string{"j": "n"}}
+		result := verify("translate", "pbs", job)
+		Expect(result.State).To(Equal("CORRECT"))
+		Expect(result.ModifiedParams).To(HaveKeyWithValue("j", "y"))
+
+		// -j y on the command line
+		job.Params["j"] = "y"
+		result = verify("translate", "pbs", job)
+		Expect(result.State).To(Equal("ACCEPT"))
+		Expect(result.Message).To(ContainSubstring("(skipped: j was requested explicitly)"))
+	})
+})
@@ -0,0 +1,166 @@
+package translate
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseMegabytes converts a memory size with an optional unit into
+// megabytes. The units map contains the factors of the units to
+// megabytes (lower case), a value without unit is in defaultUnit.
+func parseMegabytes(value string, units map[string]float64, defaultUnit string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	number := strings.TrimRightFunc(lower, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	unit := strings.TrimPrefix(lower, number)
+	if strings.HasSuffix(number, ".") {
+		return 0, fmt.Errorf("invalid memory size %q", value)
+	}
+	if unit == "" {
+		unit = defaultUnit
+	}
+	factor, exists := units[unit]
+	if !exists {
+		return 0, fmt.Errorf("unknown memory unit in %q", value)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size %q", value)
+	}
+	megabytes := int64(math.Ceil(n * factor))
+	if megabytes == 0 {
+		return 0, fmt.Errorf("memory size %q is too small", value)
+	}
+	return megabytes, nil
+}
+
+// memoryChanges requests the given memory per slot.
+func (t *Translator) memoryChanges(megabytes, slots int64) []Change {
+	if slots > 1 {
+		megabytes = (megabytes + slots - 1) / slots
+	}
+	return []Change{{Param: "l_hard", SubParam: t.MemoryResource, Value: strconv.FormatInt(megabytes, 10) + "M"}}
+}
+
+// parseCount parses a positive number like a number of tasks.
+func parseCount(name, value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
+}
+
+// arrayChanges converts an array specification like "1-10:2%4" into
+// the t_min, t_max, t_step, and tc parameters.
+func arrayChanges(value string) ([]Change, error) {
+	spec, limit, hasLimit := strings.Cut(value, "%")
+	if strings.Contains(spec, ",") {
+		return nil, fmt.Errorf("array index lists are not supported")
+	}
+	rangeSpec, step, hasStep := strings.Cut(spec, ":")
+	first, last, isRange := strings.Cut(rangeSpec, "-")
+	if !isRange {
+		last = first
+	}
+	if !hasStep {
+		step = "1"
+	}
+	min, err1 := strconv.ParseUint(first, 10, 32)
+	max, err2 := strconv.ParseUint(last, 10, 32)
+	inc, err3 := strconv.ParseUint(step, 10, 32)
+	if err1 != nil || err2 != nil || err3 != nil || inc == 0 || max < min {
+		return nil, fmt.Errorf("invalid array specification %q", value)
+	}
+	if min == 0 {
+		// Grid Engine task ids start with 1
+		return nil, fmt.Errorf("array task id 0 is not supported")
+	}
+	changes := []Change{
+		{Param: "t_min", Value: first},
+		{Param: "t_max", Value: last},
+		{Param: "t_step", Value: step},
+	}
+	if hasLimit {
+		if _, err := strconv.ParseUint(limit, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid array task limit %q", limit)
+		}
+		changes = append(changes, Change{Param: "tc", Value: limit})
+	}
+	return changes, nil
+}
+
+// replacePatterns replaces filename patterns like "%j" with the pseudo
+// environment variables of Grid Engine.
+func replacePatterns(filename string, replacements map[byte]string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(filename); i++ {
+		if filename[i] != '%' {
+			b.WriteByte(filename[i])
+			continue
+		}
+		if i+1 >= len(filename) {
+			return "", fmt.Errorf("incomplete filename pattern %q", filename)
+		}
+		replacement, exists := replacements[filename[i+1]]
+		if !exists {
+			return "", fmt.Errorf("filename pattern %%%c is not supported", filename[i+1])
+		}
+		b.WriteString(replacement)
+		i++
+	}
+	return b.String(), nil
+}
+
+// parseClock converts times like "[[[days:]hours:]minutes:]seconds"
+// into seconds. The unit of a single number is given by unit
+// (in seconds).
+func parseClock(value string, unit int64) (int64, error) {
+	fields := strings.Split(value, ":")
+	if value == "" || len(fields) > 4 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	factors := []int64{1, 60, 3600, 86400}
+	if len(fields) == 1 {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		return n * unit, nil
+	}
+	var seconds int64
+	for i, field := range fields {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+		seconds += n * factors[len(fields)-1-i]
+	}
+	return seconds, nil
+}
+
+// digits returns true when the value is a non-empty string of digits.
+func digits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// hardResource returns the change which requests a hard resource.
+func hardResource(name, value string) []Change {
+	return []Change{{Param: "l_hard", SubParam: name, Value: value}}
+}
+
+// set returns the change of a simple parameter.
+func set(param, value string) []Change {
+	return []Change{{Param: param, Value: value}}
+}
@@ -0,0 +1,291 @@
+package translate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dgruber/jsv/jobscript"
+)
+
+// Kinds of parallel environments which are requested by the rules.
+// They are mapped to the Grid Engine parallel environments with the
+// ParallelEnvironments table of a Translator.
+const (
+	// ParallelPE is used for jobs with multiple tasks which can
+	// span multiple hosts.
+	ParallelPE = "parallel"
+	// ThreadedPE is used for jobs which use multiple cores on a
+	// single host.
+	ThreadedPE = "threaded"
+)
+
+// Rule translates the value of a directive into parameter changes.
+// The values of all directives of the script are passed for rules
+// which depend on other directives. A rule returns no changes and
+// no error when the directive is translated together with another
+// directive. An error marks the directive as untranslatable.
+type Rule func(t *Translator, value string, values map[string]string) ([]Change, error)
+
+// Item is an element of a list directive, like "walltime=1:00:00"
+// of "#PBS -l walltime=1:00:00,mem=1gb".
+type Item struct {
+	Name  string
+	Value string
+}
+
+// Splitter splits the value of a list directive into items.
+type Splitter func(value string) []Item
+
+// Dialect describes the directives of a workload manager.
+type Dialect struct {
+	// Name is the name of the workload manager.
+	Name string
+	// Prefix is the directive prefix, like "#SBATCH".
+	Prefix string
+	// Aliases map option names to the names which are used as keys
+	// of the rules, like "t" to "time".
+	Aliases map[string]string
+	// Flags are the options without argument.
+	Flags map[string]bool
+	// Lists are options whose value is split into items. Each item
+	// is translated by the rule "<option> <item name>".
+	Lists map[string]Splitter
+	// StopAtCommand stops parsing directives at the first line which
+	// is not empty and not a comment.
+	StopAtCommand bool
+	// Rules map the option names to their translation.
+	Rules map[string]Rule
+}
+
+// Translator translates the directives of a dialect into Grid Engine
+// job parameters.
+type Translator struct {
+	// Dialect is the dialect of the directives.
+	Dialect *Dialect
+	// Queues maps queue names (like Slurm partitions) to Grid Engine
+	// queues. Names which are not in the map are used unchanged.
+	Queues map[string]string
+	// ParallelEnvironments maps the kinds of parallel environments
+	// (ParallelPE, ThreadedPE) to the Grid Engine parallel
+	// environments.
+	ParallelEnvironments map[string]string
+	// MemoryResource is the Grid Engine resource for memory requests.
+	// It is requested per slot.
+	MemoryResource string
+	// GPUResource is the Grid Engine resource for GPU requests.
+	GPUResource string
+	// LimitUnit is the unit of LSF memory values without unit, like
+	// LSF_UNIT_FOR_LIMITS in lsf.conf ("KB", "MB", "GB", or "TB").
+	// Empty is KB, the default of LSF.
+	LimitUnit string
+	// MaxSize is the maximum size of a job script which is read.
+	MaxSize int64
+}
+
+// NewTranslator creates a translator for the dialect with default
+// settings.
+func NewTranslator(dialect *Dialect) *Translator {
+	return &Translator{
+		Dialect: dialect,
+		Queues:  make(map[string]string),
+		ParallelEnvironments: map[string]string{
+			ParallelPE: "mpi",
+			ThreadedPE: "smp",
+		},
+		MemoryResource: "h_vmem",
+		GPUResource:    "gpu",
+		MaxSize:        jobscript.DefaultMaxSize,
+	}
+}
+
+// Queue returns the Grid Engine queue for a queue name.
+func (t *Translator) Queue(name string) string {
+	if queue, exists := t.Queues[name]; exists {
+		return queue
+	}
+	return name
+}
+
+// ParallelEnvironment returns the changes which request the parallel
+// environment of the given kind with the given number of slots.
+func (t *Translator) ParallelEnvironment(kind string, slots int64) []Change {
+	pe, exists := t.ParallelEnvironments[kind]
+	if !exists {
+		pe = kind
+	}
+	count := fmt.Sprintf("%d", slots)
+	return []Change{
+		{Param: "pe_name", Value: pe},
+		{Param: "pe_min", Value: count},
+		{Param: "pe_max", Value: count},
+	}
+}
+
+// TranslateJob translates the directives of the job script of the
+// currently processed job.
+func (t *Translator) TranslateJob() (*Report, error) {
+	path, err := jobscript.Path()
+	if err != nil {
+		return nil, err
+	}
+	f, err := jobscript.Open(path, t.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	report, err := t.Translate(f)
+	if err != nil {
+		return nil, err
+	}
+	report.Script = path
+	return report, nil
+}
+
+// Translate translates the directives of the given job script.
+func (t *Translator) Translate(r io.Reader) (*Report, error) {
+	directives, err := t.Dialect.parse(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, d := range directives {
+		values[d.name] = d.value
+	}
+
+	report := &Report{Prefix: t.Dialect.Prefix}
+	for _, d := range directives {
+		mapping := Mapping{Line: d.line, Directive: d.text}
+		rule, exists := t.Dialect.Rules[d.name]
+		if !exists {
+			mapping.Status = Untranslatable
+			mapping.Reason = "no Grid Engine equivalent"
+			report.Mappings = append(report.Mappings, mapping)
+			continue
+		}
+		changes, err := rule(t, d.value, values)
+		if err != nil {
+			mapping.Status = Untranslatable
+			mapping.Reason = err.Error()
+		} else if len(changes) == 0 {
+			mapping.Reason = "translated together with other directives"
+		}
+		mapping.Changes = changes
+		report.Mappings = append(report.Mappings, mapping)
+	}
+	return report, nil
+}
+
+// directive is a single option of a directive line.
+type directive struct {
+	line  int
+	name  string
+	value string
+	text  string
+}
+
+// known returns true when the option name is defined by the dialect.
+func (d *Dialect) known(name string) bool {
+	if _, exists := d.Aliases[name]; exists {
+		return true
+	}
+	if _, exists := d.Rules[name]; exists {
+		return true
+	}
+	if _, exists := d.Lists[name]; exists {
+		return true
+	}
+	return d.Flags[name]
+}
+
+func (d *Dialect) canonical(name string) string {
+	if alias, exists := d.Aliases[name]; exists {
+		return alias
+	}
+	return name
+}
+
+// parse returns the options of all directive lines of the script.
+func (d *Dialect) parse(r io.Reader) ([]directive, error) {
+	var directives []directive
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), jobscript.DefaultMaxSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			if d.StopAtCommand {
+				break
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, d.Prefix) {
+			continue
+		}
+		args, err := jobscript.SplitArgs(strings.TrimPrefix(line, d.Prefix))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			option := directive{line: lineNumber, text: arg}
+			hasValue := false
+			switch {
+			case strings.HasPrefix(arg, "--"):
+				option.name, option.value, hasValue = strings.Cut(arg[2:], "=")
+			case strings.HasPrefix(arg, "-") && len(arg) > 1:
+				// "-oo file" or getopt style "-t10"
+				option.name = arg[1:]
+				if !d.known(option.name) && len(arg) > 2 {
+					option.name, option.value, hasValue = arg[1:2], arg[2:], true
+				}
+			default:
+				option.name = arg
+				hasValue = true
+			}
+			option.name = d.canonical(option.name)
+			if !hasValue && !d.Flags[option.name] && i+1 < len(args) {
+				i++
+				option.value = args[i]
+				option.text += " " + option.value
+			}
+
+			split, isList := d.Lists[option.name]
+			if !isList {
+				directives = append(directives, option)
+				continue
+			}
+			for _, item := range split(option.value) {
+				directives = append(directives, directive{
+					line:  option.line,
+					name:  option.name + " " + item.Name,
+					value: item.Value,
+					text:  option.text,
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job script: %w", err)
+	}
+	return directives, nil
+}
+
+// SplitResources splits a comma separated resource list like
+// "walltime=1:00:00,nodes=2:ppn=4" into items.
+func SplitResources(value string) []Item {
+	var items []Item
+	for _, resource := range strings.Split(value, ",") {
+		if resource == "" {
+			continue
+		}
+		name, v, _ := strings.Cut(resource, "=")
+		items = append(items, Item{Name: name, Value: v})
+	}
+	return items
+}
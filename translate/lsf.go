@@ -0,0 +1,284 @@
+package translate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewLSF creates a translator for LSF #BSUB directives.
+func NewLSF() *Translator {
+	return NewTranslator(LSFDialect())
+}
+
+// LSFDialect returns the dialect of LSF #BSUB directives. The resource
+// requirement string (-R) is split into its sections, each section is
+// translated by the rule "R <section>", like "R rusage".
+func LSFDialect() *Dialect {
+	return &Dialect{
+		Name:   "LSF",
+		Prefix: "#BSUB",
+		Aliases: map[string]string{
+			"oo": "o", "eo": "e",
+		},
+		Flags: map[string]bool{
+			"B": true, "N": true, "H": true, "I": true, "K": true,
+			"r": true, "rn": true, "x": true,
+		},
+		Lists:         map[string]Splitter{"R": SplitLSFResources},
+		StopAtCommand: true,
+		Rules: map[string]Rule{
+			"W":        lsfRuntime,
+			"n":        lsfSlots,
+			"R rusage": lsfRusage,
+			"R span":   lsfSpan,
+			"M":        lsfMemoryLimit,
+			"gpu":      lsfGPU,
+			"q":        lsfQueue,
+			"J":        lsfJobName,
+			"o":        lsfFilename("o"),
+			"e":        lsfFilename("e"),
+			"u":        simple("M"),
+			"B":        lsfMailBegin,
+			"N":        lsfMailEnd,
+			"P":        simple("P"),
+			"cwd":      simple("wd"),
+			"H":        hold,
+			"r":        lsfRerun("y"),
+			"rn":       lsfRerun("n"),
+		},
+	}
+}
+
+// SplitLSFResources splits a resource requirement string like
+// "select[mem>4000] rusage[mem=4000] span[hosts=1]" into its sections.
+// A string without section is a select section.
+func SplitLSFResources(value string) []Item {
+	var items []Item
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		first := strings.Index(rest, "[")
+		if first < 0 {
+			items = append(items, Item{Name: "select", Value: rest})
+			break
+		}
+		last := strings.Index(rest[first:], "]")
+		if last < 0 {
+			items = append(items, Item{Name: strings.TrimSpace(rest[:first]), Value: rest[first+1:]})
+			break
+		}
+		last += first
+		items = append(items, Item{Name: strings.TrimSpace(rest[:first]), Value: rest[first+1 : last]})
+		rest = strings.TrimSpace(rest[last+1:])
+	}
+	return items
+}
+
+var lsfMemoryUnits = map[string]float64{
+	"kb": 1.0 / 1024, "k": 1.0 / 1024, "mb": 1, "m": 1, "gb": 1024, "g": 1024, "tb": 1024 * 1024, "t": 1024 * 1024,
+}
+
+// lsfMegabytes converts an LSF memory value into megabytes. Values
+// without unit are in the LimitUnit of the translator.
+func (t *Translator) lsfMegabytes(value string) (int64, error) {
+	unit := strings.ToLower(t.LimitUnit)
+	if unit == "" {
+		unit = "kb"
+	}
+	return parseMegabytes(value, lsfMemoryUnits, unit)
+}
+
+// lsfRuntime translates "[hours:]minutes".
+func lsfRuntime(t *Translator, value string, values map[string]string) ([]Change, error) {
+	// a host specification like "1:00/hostA" is not supported
+	if strings.Contains(value, "/") {
+		return nil, fmt.Errorf("host normalized run limits are not supported")
+	}
+	minutes := value
+	var hours int64
+	if h, m, found := strings.Cut(value, ":"); found {
+		n, err := strconv.ParseInt(h, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid run limit %q", value)
+		}
+		hours, minutes = n, m
+	}
+	m, err := strconv.ParseInt(minutes, 10, 64)
+	if err != nil || m < 0 {
+		return nil, fmt.Errorf("invalid run limit %q", value)
+	}
+	return hardResource("h_rt", strconv.FormatInt(hours*3600+m*60, 10)), nil
+}
+
+// lsfSlots translates "-n min[,max]". Jobs with span[hosts=1] are
+// requested in the threaded parallel environment.
+func lsfSlots(t *Translator, value string, values map[string]string) ([]Change, error) {
+	first, last, isRange := strings.Cut(value, ",")
+	min, err := parseCount("number of tasks", first)
+	if err != nil {
+		return nil, err
+	}
+	max := min
+	if isRange {
+		if max, err = parseCount("number of tasks", last); err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, fmt.Errorf("invalid number of tasks %q", value)
+		}
+	}
+	kind := ParallelPE
+	if values["R span"] == "hosts=1" {
+		kind = ThreadedPE
+	}
+	changes := t.ParallelEnvironment(kind, min)
+	for i := range changes {
+		if changes[i].Param == "pe_max" {
+			changes[i].Value = strconv.FormatInt(max, 10)
+		}
+	}
+	return changes, nil
+}
+
+func lsfSpan(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if value != "hosts=1" {
+		return nil, fmt.Errorf("span %q is not supported", value)
+	}
+	if _, tasks := values["n"]; !tasks {
+		return nil, fmt.Errorf("span without -n is not supported")
+	}
+	// translated together with -n
+	return nil, nil
+}
+
+// lsfRusage translates the memory and GPU reservations of a rusage
+// section, like "mem=4000:duration=10". The memory is reserved per
+// slot.
+func lsfRusage(t *Translator, value string, values map[string]string) ([]Change, error) {
+	var changes []Change
+	for _, resource := range strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ',' }) {
+		name, v, _ := strings.Cut(resource, "=")
+		switch strings.TrimSpace(name) {
+		case "mem":
+			megabytes, err := t.lsfMegabytes(v)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, t.memoryChanges(megabytes, 1)...)
+		case "ngpus_physical", "ngpus":
+			if _, err := parseCount(name, v); err != nil {
+				return nil, err
+			}
+			changes = append(changes, hardResource(t.GPUResource, v)...)
+		case "duration", "decay":
+			// reservation details have no equivalent
+		default:
+			return nil, fmt.Errorf("resource %q is not supported", name)
+		}
+	}
+	return changes, nil
+}
+
+// lsfMemoryLimit translates the memory limit (-M) when no memory is
+// reserved with rusage.
+func lsfMemoryLimit(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if strings.Contains(values["R rusage"], "mem=") {
+		// translated with the rusage section
+		return nil, nil
+	}
+	megabytes, err := t.lsfMegabytes(value)
+	if err != nil {
+		return nil, err
+	}
+	return t.memoryChanges(megabytes, 1), nil
+}
+
+// lsfGPU translates GPU requirements like "num=2:mode=shared". The
+// default requirement "-" requests one GPU.
+func lsfGPU(t *Translator, value string, values map[string]string) ([]Change, error) {
+	count := "1"
+	if value != "-" {
+		for _, option := range strings.Split(value, ":") {
+			name, v, _ := strings.Cut(option, "=")
+			if name == "num" {
+				count = v
+			}
+		}
+	}
+	if _, err := parseCount("GPU count", count); err != nil {
+		return nil, err
+	}
+	return hardResource(t.GPUResource, count), nil
+}
+
+// lsfQueue translates a space separated list of queues.
+func lsfQueue(t *Translator, value string, values map[string]string) ([]Change, error) {
+	queues := strings.Fields(value)
+	if len(queues) == 0 {
+		return nil, fmt.Errorf("empty queue list")
+	}
+	for i, queue := range queues {
+		queues[i] = t.Queue(queue)
+	}
+	return set("q_hard", strings.Join(queues, ",")), nil
+}
+
+// lsfJobName translates job names which can contain an array
+// specification like "name[1-10:2]%4".
+func lsfJobName(t *Translator, value string, values map[string]string) ([]Change, error) {
+	first := strings.Index(value, "[")
+	if first < 0 {
+		return set("N", value), nil
+	}
+	last := strings.LastIndex(value, "]")
+	if last < first {
+		return nil, fmt.Errorf("invalid job array specification %q", value)
+	}
+	spec := value[first+1 : last]
+	if limit := value[last+1:]; limit != "" {
+		spec += limit
+	}
+	changes, err := arrayChanges(spec)
+	if err != nil {
+		return nil, err
+	}
+	if name := value[:first]; name != "" {
+		changes = append(set("N", name), changes...)
+	}
+	return changes, nil
+}
+
+var lsfPatterns = map[byte]string{'J': "$JOB_ID", 'I': "$TASK_ID", '%': "%"}
+
+func lsfFilename(param string) Rule {
+	return func(t *Translator, value string, values map[string]string) ([]Change, error) {
+		path, err := replacePatterns(value, lsfPatterns)
+		if err != nil {
+			return nil, err
+		}
+		return set(param, path), nil
+	}
+}
+
+// lsfMailBegin translates -B (mail at begin), together with -N.
+func lsfMailBegin(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, end := values["N"]; end {
+		return set("m", "be"), nil
+	}
+	return set("m", "b"), nil
+}
+
+// lsfMailEnd translates -N (mail at end).
+func lsfMailEnd(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, begin := values["B"]; begin {
+		// translated together with -B
+		return nil, nil
+	}
+	return set("m", "e"), nil
+}
+
+func lsfRerun(rerun string) Rule {
+	return func(t *Translator, value string, values map[string]string) ([]Change, error) {
+		return set("r", rerun), nil
+	}
+}
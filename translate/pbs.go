@@ -0,0 +1,278 @@
+package translate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewPBS creates a translator for PBS and Torque #PBS directives.
+func NewPBS() *Translator {
+	return NewTranslator(PBSDialect())
+}
+
+// PBSDialect returns the dialect of PBS/Torque #PBS directives. The
+// resource list (-l) is split into its resources, each resource is
+// translated by the rule "l <resource>".
+func PBSDialect() *Dialect {
+	return &Dialect{
+		Name:          "PBS",
+		Prefix:        "#PBS",
+		Flags:         map[string]bool{"V": true, "h": true, "I": true, "X": true},
+		Lists:         map[string]Splitter{"l": SplitResources},
+		StopAtCommand: true,
+		Rules: map[string]Rule{
+			"l walltime": pbsWalltime,
+			"l nodes":    pbsNodes,
+			"l ncpus":    pbsNcpus,
+			"l select":   pbsSelect,
+			"l mem":      pbsMemory,
+			"l vmem":     pbsMemory,
+			"l pmem":     pbsMemoryPerProcess,
+			"l pvmem":    pbsMemoryPerProcess,
+			"q":          pbsQueue,
+			"N":          simple("N"),
+			"J":          array,
+			"t":          array,
+			"o":          pbsPath("o"),
+			"e":          pbsPath("e"),
+			"j":          pbsJoin,
+			"M":          simple("M"),
+			"m":          pbsMail,
+			"A":          simple("A"),
+			"a":          pbsDateTime,
+			"d":          simple("wd"),
+			"w":          simple("wd"),
+			"h":          hold,
+			"p":          simple("p"),
+			"r":          simple("r"),
+			"S":          simple("S"),
+		},
+	}
+}
+
+var pbsMemoryUnits = map[string]float64{
+	"b": 1.0 / (1024 * 1024), "kb": 1.0 / 1024, "mb": 1, "gb": 1024, "tb": 1024 * 1024,
+	"w": 8.0 / (1024 * 1024), "kw": 8.0 / 1024, "mw": 8, "gw": 8 * 1024,
+}
+
+func pbsWalltime(t *Translator, value string, values map[string]string) ([]Change, error) {
+	seconds, err := parseClock(value, 1)
+	if err != nil {
+		return nil, err
+	}
+	return hardResource("h_rt", strconv.FormatInt(seconds, 10)), nil
+}
+
+// pbsNodes translates node specifications like "2:ppn=4:gpus=1".
+func pbsNodes(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if strings.Contains(value, "+") {
+		return nil, fmt.Errorf("multiple node specifications are not supported")
+	}
+	nodes, ppn, gpus, err := parsePBSNodes(value)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	kind := ParallelPE
+	if nodes == 1 {
+		kind = ThreadedPE
+	}
+	if slots := nodes * ppn; slots > 1 {
+		changes = append(changes, t.ParallelEnvironment(kind, slots)...)
+	}
+	if gpus != "" {
+		changes = append(changes, hardResource(t.GPUResource, gpus)...)
+	}
+	return changes, nil
+}
+
+func parsePBSNodes(value string) (int64, int64, string, error) {
+	fields := strings.Split(value, ":")
+	nodes, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || nodes <= 0 {
+		return 0, 0, "", fmt.Errorf("host lists are not supported")
+	}
+	ppn := int64(1)
+	gpus := ""
+	for _, field := range fields[1:] {
+		name, v, _ := strings.Cut(field, "=")
+		switch name {
+		case "ppn":
+			if ppn, err = parseCount("ppn", v); err != nil {
+				return 0, 0, "", err
+			}
+		case "gpus":
+			if _, err := parseCount("gpus", v); err != nil {
+				return 0, 0, "", err
+			}
+			gpus = v
+		default:
+			return 0, 0, "", fmt.Errorf("node property %q is not supported", field)
+		}
+	}
+	return nodes, ppn, gpus, nil
+}
+
+func pbsNcpus(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, nodes := values["l nodes"]; nodes {
+		return nil, fmt.Errorf("ncpus can't be combined with nodes")
+	}
+	slots, err := parseCount("ncpus", value)
+	if err != nil {
+		return nil, err
+	}
+	if slots == 1 {
+		return nil, nil
+	}
+	return t.ParallelEnvironment(ThreadedPE, slots), nil
+}
+
+// pbsSelect translates PBS Pro chunk specifications like
+// "2:ncpus=4:mem=8gb:ngpus=1".
+func pbsSelect(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if strings.Contains(value, "+") {
+		return nil, fmt.Errorf("multiple chunk specifications are not supported")
+	}
+	fields := strings.Split(value, ":")
+	chunks := int64(1)
+	if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid number of chunks %q", fields[0])
+		}
+		chunks = n
+		fields = fields[1:]
+	}
+	ncpus := int64(1)
+	var mem int64
+	gpus := ""
+	for _, field := range fields {
+		name, v, _ := strings.Cut(field, "=")
+		var err error
+		switch name {
+		case "ncpus":
+			ncpus, err = parseCount(name, v)
+		case "mpiprocs":
+			// the slots are defined by ncpus
+		case "mem":
+			mem, err = parseMegabytes(v, pbsMemoryUnits, "b")
+		case "ngpus":
+			_, err = parseCount(name, v)
+			gpus = v
+		default:
+			err = fmt.Errorf("chunk resource %q is not supported", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var changes []Change
+	kind := ParallelPE
+	if chunks == 1 {
+		kind = ThreadedPE
+	}
+	if slots := chunks * ncpus; slots > 1 {
+		changes = append(changes, t.ParallelEnvironment(kind, slots)...)
+	}
+	if mem > 0 {
+		// memory is per chunk
+		changes = append(changes, t.memoryChanges(mem, ncpus)...)
+	}
+	if gpus != "" {
+		changes = append(changes, hardResource(t.GPUResource, gpus)...)
+	}
+	return changes, nil
+}
+
+// pbsSlots returns the number of slots requested by the resource list.
+func pbsSlots(values map[string]string) int64 {
+	if nodes, exists := values["l nodes"]; exists {
+		n, ppn, _, err := parsePBSNodes(nodes)
+		if err == nil {
+			return n * ppn
+		}
+	}
+	if ncpus, exists := values["l ncpus"]; exists {
+		if n, err := parseCount("ncpus", ncpus); err == nil {
+			return n
+		}
+	}
+	return 1
+}
+
+// pbsMemory translates the memory of the job into memory per slot.
+func pbsMemory(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, perProcess := values["l pmem"]; perProcess {
+		return nil, fmt.Errorf("mem can't be combined with pmem")
+	}
+	megabytes, err := parseMegabytes(value, pbsMemoryUnits, "b")
+	if err != nil {
+		return nil, err
+	}
+	return t.memoryChanges(megabytes, pbsSlots(values)), nil
+}
+
+func pbsMemoryPerProcess(t *Translator, value string, values map[string]string) ([]Change, error) {
+	megabytes, err := parseMegabytes(value, pbsMemoryUnits, "b")
+	if err != nil {
+		return nil, err
+	}
+	return t.memoryChanges(megabytes, 1), nil
+}
+
+// pbsDateTime translates "[[[[CC]YY]MM]DD]hhmm[.SS]" into the
+// "[[CC]YY]MMDDhhmm[.SS]" format of qsub -a. Without month and day PBS
+// picks the next matching time after the submission, which can't be
+// expressed for qsub.
+func pbsDateTime(t *Translator, value string, values map[string]string) ([]Change, error) {
+	datetime, seconds, hasSeconds := strings.Cut(value, ".")
+	if hasSeconds && (len(seconds) != 2 || !digits(seconds)) {
+		return nil, fmt.Errorf("invalid date time %q", value)
+	}
+	if !digits(datetime) {
+		return nil, fmt.Errorf("invalid date time %q", value)
+	}
+	switch len(datetime) {
+	case 8, 10, 12:
+		return set("a", value), nil
+	case 4, 6:
+		return nil, fmt.Errorf("date time %q without month is relative to the submission time", value)
+	}
+	return nil, fmt.Errorf("invalid date time %q", value)
+}
+
+// pbsQueue translates "queue" or "queue@server".
+func pbsQueue(t *Translator, value string, values map[string]string) ([]Change, error) {
+	queue, _, _ := strings.Cut(value, "@")
+	if queue == "" {
+		return nil, fmt.Errorf("default queue of server %q is not supported", value)
+	}
+	return set("q_hard", t.Queue(queue)), nil
+}
+
+// pbsPath translates "[hostname:]path".
+func pbsPath(param string) Rule {
+	return func(t *Translator, value string, values map[string]string) ([]Change, error) {
+		if _, path, hasHost := strings.Cut(value, ":"); hasHost {
+			value = path
+		}
+		return set(param, value), nil
+	}
+}
+
+func pbsJoin(t *Translator, value string, values map[string]string) ([]Change, error) {
+	switch value {
+	case "oe", "eo":
+		return set("j", "y"), nil
+	case "n":
+		return set("j", "n"), nil
+	}
+	return nil, fmt.Errorf("join option %q is not supported", value)
+}
+
+func pbsMail(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if (value != "" && strings.Trim(value, "abe") == "") || value == "n" {
+		return set("m", value), nil
+	}
+	return nil, fmt.Errorf("mail option %q is not supported", value)
+}
@@ -0,0 +1,175 @@
+package translate_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/translate"
+)
+
+// changes returns all changes of a report and the untranslatable
+// directives.
+func changes(report *translate.Report) (map[string]string, []string) {
+	result := make(map[string]string)
+	var untranslatable []string
+	for _, m := range report.Mappings {
+		if m.Status == translate.Untranslatable {
+			untranslatable = append(untranslatable, m.Directive)
+		}
+		for _, c := range m.Changes {
+			result[strings.TrimSpace(c.Param+" "+c.SubParam)] = c.Value
+		}
+	}
+	return result, untranslatable
+}
+
+var _ = Describe("PBS", func() {
+
+	It("should translate #PBS directives", func() {
+		pbs := translate.NewPBS()
+		pbs.Queues["batch"] = "all.q"
+		pbs.ParallelEnvironments[translate.ParallelPE] = "openmpi"
+		report, err := pbs.Translate(strings.NewReader(`#!/bin/bash
+#PBS -l walltime=01:30:00,nodes=2:ppn=4,mem=8gb
+#PBS -q batch@server1
+#PBS -N myjob
+#PBS -J 1-100:10
+#PBS -j oe -m abe -o host:/tmp/out
+#PBS -l software=matlab
+#PBS -W depend=afterok:123
+`))
+		Expect(err).ToNot(HaveOccurred())
+		result, untranslatable := changes(report)
+		Expect(result).To(Equal(map[string]string{
+			"l_hard h_rt":   "5400",
+			"pe_name":       "openmpi",
+			"pe_min":        "8",
+			"pe_max":        "8",
+			"l_hard h_vmem": "1024M",
+			"q_hard":        "all.q",
+			"N":             "myjob",
+			"t_min":         "1",
+			"t_max":         "100",
+			"t_step":        "10",
+			"j":             "y",
+			"m":             "abe",
+			"o":             "/tmp/out",
+		}))
+		Expect(untranslatable).To(Equal([]string{"-l software=matlab", "-W depend=afterok:123"}))
+	})
+
+	It("should translate PBS Pro select statements", func() {
+		report, err := translate.NewPBS().Translate(strings.NewReader("#PBS -l select=1:ncpus=8:mem=16gb:ngpus=2"))
+		Expect(err).ToNot(HaveOccurred())
+		result, _ := changes(report)
+		Expect(result).To(Equal(map[string]string{
+			"pe_name":       "smp",
+			"pe_min":        "8",
+			"pe_max":        "8",
+			"l_hard h_vmem": "2048M",
+			"l_hard gpu":    "2",
+		}))
+	})
+
+	It("should only translate start times which qsub accepts", func() {
+		for _, value := range []string{"03011430", "2403011430.15", "202403011430"} {
+			report, err := translate.NewPBS().Translate(strings.NewReader("#PBS -a " + value))
+			Expect(err).ToNot(HaveOccurred())
+			result, untranslatable := changes(report)
+			Expect(untranslatable).To(BeEmpty(), value)
+			Expect(result).To(Equal(map[string]string{"a": value}), value)
+		}
+
+		for _, value := range []string{"1430", "011430.30", "14:30", "1430.5", "3011430"} {
+			report, err := translate.NewPBS().Translate(strings.NewReader("#PBS -a " + value))
+			Expect(err).ToNot(HaveOccurred())
+			_, untranslatable := changes(report)
+			Expect(untranslatable).To(Equal([]string{"-a " + value}), value)
+		}
+		report, err := translate.NewPBS().Translate(strings.NewReader("#PBS -a 1430"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Mappings[0].Reason).To(ContainSubstring("without month is relative to the submission time"))
+	})
+})
+
+var _ = Describe("LSF", func() {
+
+	It("should translate #BSUB directives", func() {
+		lsf := translate.NewLSF()
+		lsf.Queues["normal"] = "all.q"
+		lsf.LimitUnit = "MB"
+		report, err := lsf.Translate(strings.NewReader(`#!/bin/bash
+#BSUB -W 2:30
+#BSUB -n 4
+#BSUB -R "rusage[mem=4000] span[hosts=1] select[type==X86_64]"
+#BSUB -q normal
+#BSUB -J "sweep[1-20]%5"
+#BSUB -oo out.%J.%I
+#BSUB -B -N -u alice@example.com
+`))
+		Expect(err).ToNot(HaveOccurred())
+		result, untranslatable := changes(report)
+		Expect(result).To(Equal(map[string]string{
+			"l_hard h_rt":   "9000",
+			"pe_name":       "smp",
+			"pe_min":        "4",
+			"pe_max":        "4",
+			"l_hard h_vmem": "4000M",
+			"q_hard":        "all.q",
+			"N":             "sweep",
+			"t_min":         "1",
+			"t_max":         "20",
+			"t_step":        "1",
+			"tc":            "5",
+			"o":             "out.$JOB_ID.$TASK_ID",
+			"m":             "be",
+			"M":             "alice@example.com",
+		}))
+		Expect(untranslatable).To(HaveLen(1))
+		Expect(report.String()).To(ContainSubstring("select[type==X86_64]"))
+	})
+
+	It("should read memory values without unit in the limit unit", func() {
+		memory := func(lsf *translate.Translator, script string) string {
+			report, err := lsf.Translate(strings.NewReader(script))
+			Expect(err).ToNot(HaveOccurred())
+			result, _ := changes(report)
+			return result["l_hard h_vmem"]
+		}
+		// KB is the default of LSF_UNIT_FOR_LIMITS
+		lsf := translate.NewLSF()
+		Expect(memory(lsf, "#BSUB -M 4194304")).To(Equal("4096M"))
+		Expect(memory(lsf, `#BSUB -R "rusage[mem=2048]"`)).To(Equal("2M"))
+		Expect(memory(lsf, "#BSUB -M 4GB")).To(Equal("4096M"))
+
+		lsf.LimitUnit = "GB"
+		Expect(memory(lsf, "#BSUB -M 4")).To(Equal("4096M"))
+		Expect(memory(lsf, `#BSUB -R "rusage[mem=2]"`)).To(Equal("2048M"))
+		Expect(memory(lsf, "#BSUB -M 512MB")).To(Equal("512M"))
+	})
+
+	It("should translate slot ranges", func() {
+		report, err := translate.NewLSF().Translate(strings.NewReader("#BSUB -n 2,8"))
+		Expect(err).ToNot(HaveOccurred())
+		result, _ := changes(report)
+		Expect(result).To(Equal(map[string]string{
+			"pe_name": "mpi",
+			"pe_min":  "2",
+			"pe_max":  "8",
+		}))
+	})
+
+	It("should allow sites to add rules", func() {
+		lsf := translate.NewLSF()
+		lsf.Dialect.Rules["R select"] = func(t *translate.Translator, value string, values map[string]string) ([]translate.Change, error) {
+			return []translate.Change{{Param: "l_hard", SubParam: "arch", Value: "lx-amd64"}}, nil
+		}
+		report, err := lsf.Translate(strings.NewReader(`#BSUB -R "select[type==X86_64]"`))
+		Expect(err).ToNot(HaveOccurred())
+		result, untranslatable := changes(report)
+		Expect(untranslatable).To(BeEmpty())
+		Expect(result).To(Equal(map[string]string{"l_hard arch": "lx-amd64"}))
+	})
+})
@@ -0,0 +1,256 @@
+package translate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewSlurm creates a translator for #SBATCH directives.
+func NewSlurm() *Translator {
+	return NewTranslator(SlurmDialect())
+}
+
+// SlurmDialect returns the dialect of Slurm #SBATCH directives. Like
+// sbatch, directives after the first command are ignored.
+func SlurmDialect() *Dialect {
+	return &Dialect{
+		Name:   "Slurm",
+		Prefix: "#SBATCH",
+		Aliases: map[string]string{
+			"A": "account", "a": "array", "c": "cpus-per-task", "C": "constraint",
+			"D": "chdir", "d": "dependency", "e": "error", "G": "gpus",
+			"H": "hold", "J": "job-name", "N": "nodes", "n": "ntasks",
+			"o": "output", "p": "partition", "q": "qos", "t": "time",
+			"w": "nodelist", "x": "exclude",
+		},
+		Flags: map[string]bool{
+			"exclusive": true, "hold": true, "requeue": true, "no-requeue": true,
+			"overcommit": true, "contiguous": true, "get-user-env": true,
+			"parsable": true, "wait": true,
+		},
+		StopAtCommand: true,
+		Rules: map[string]Rule{
+			"time":          slurmTime,
+			"mem":           slurmMemory,
+			"mem-per-cpu":   slurmMemoryPerCPU,
+			"ntasks":        slurmTasks,
+			"cpus-per-task": slurmCPUs,
+			"gres":          slurmGres,
+			"gpus":          slurmGPUs,
+			"job-name":      simple("N"),
+			"output":        slurmFilename("o"),
+			"error":         slurmFilename("e"),
+			"mail-user":     simple("M"),
+			"mail-type":     slurmMailType,
+			"array":         array,
+			"partition":     slurmPartition,
+			"account":       simple("A"),
+			"chdir":         simple("wd"),
+			"hold":          hold,
+		},
+	}
+}
+
+// simple returns a rule which sets the parameter to the value of the
+// directive.
+func simple(param string) Rule {
+	return func(t *Translator, value string, values map[string]string) ([]Change, error) {
+		return set(param, value), nil
+	}
+}
+
+// array translates array specifications like "1-10:2%4".
+func array(t *Translator, value string, values map[string]string) ([]Change, error) {
+	return arrayChanges(value)
+}
+
+// hold translates a user hold.
+func hold(t *Translator, value string, values map[string]string) ([]Change, error) {
+	return set("h", "u"), nil
+}
+
+func slurmTime(t *Translator, value string, values map[string]string) ([]Change, error) {
+	seconds, err := parseSlurmTime(value)
+	if err != nil {
+		return nil, err
+	}
+	return hardResource("h_rt", strconv.FormatInt(seconds, 10)), nil
+}
+
+var slurmMemoryUnits = map[string]float64{"k": 1.0 / 1024, "m": 1, "g": 1024, "t": 1024 * 1024}
+
+// slurmMemory translates --mem, which is the memory per node.
+func slurmMemory(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, perCPU := values["mem-per-cpu"]; perCPU {
+		return nil, fmt.Errorf("--mem can't be combined with --mem-per-cpu")
+	}
+	megabytes, err := parseMegabytes(value, slurmMemoryUnits, "m")
+	if err != nil {
+		return nil, err
+	}
+	// Grid Engine requests memory per slot
+	slots, err := slurmSlots(values)
+	if err != nil {
+		return nil, err
+	}
+	return t.memoryChanges(megabytes, slots), nil
+}
+
+func slurmMemoryPerCPU(t *Translator, value string, values map[string]string) ([]Change, error) {
+	megabytes, err := parseMegabytes(value, slurmMemoryUnits, "m")
+	if err != nil {
+		return nil, err
+	}
+	return t.memoryChanges(megabytes, 1), nil
+}
+
+func slurmTasks(t *Translator, value string, values map[string]string) ([]Change, error) {
+	slots, err := slurmSlots(values)
+	if err != nil {
+		return nil, err
+	}
+	return t.ParallelEnvironment(ParallelPE, slots), nil
+}
+
+func slurmCPUs(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, tasks := values["ntasks"]; tasks {
+		// translated together with --ntasks
+		return nil, nil
+	}
+	slots, err := slurmSlots(values)
+	if err != nil {
+		return nil, err
+	}
+	return t.ParallelEnvironment(ThreadedPE, slots), nil
+}
+
+// slurmSlots returns the number of slots requested with --ntasks and
+// --cpus-per-task.
+func slurmSlots(values map[string]string) (int64, error) {
+	slots := int64(1)
+	for _, name := range []string{"ntasks", "cpus-per-task"} {
+		value, exists := values[name]
+		if !exists {
+			continue
+		}
+		n, err := parseCount("--"+name, value)
+		if err != nil {
+			return 0, err
+		}
+		slots *= n
+	}
+	return slots, nil
+}
+
+func slurmGres(t *Translator, value string, values map[string]string) ([]Change, error) {
+	name, count, _ := strings.Cut(value, ":")
+	if name != "gpu" {
+		return nil, fmt.Errorf("generic resource %q is unknown", name)
+	}
+	// gpu:2 or gpu:type:2
+	if i := strings.LastIndex(count, ":"); i >= 0 {
+		count = count[i+1:]
+	}
+	if count == "" {
+		count = "1"
+	}
+	return slurmGPUs(t, count, values)
+}
+
+func slurmGPUs(t *Translator, value string, values map[string]string) ([]Change, error) {
+	if _, err := parseCount("GPU count", value); err != nil {
+		return nil, err
+	}
+	return hardResource(t.GPUResource, value), nil
+}
+
+var slurmPatterns = map[byte]string{
+	'j': "$JOB_ID", 'A': "$JOB_ID", 'a': "$TASK_ID", 'x': "$JOB_NAME",
+	'u': "$USER", 'N': "$HOSTNAME", '%': "%",
+}
+
+func slurmFilename(param string) Rule {
+	return func(t *Translator, value string, values map[string]string) ([]Change, error) {
+		path, err := replacePatterns(value, slurmPatterns)
+		if err != nil {
+			return nil, err
+		}
+		return set(param, path), nil
+	}
+}
+
+func slurmPartition(t *Translator, value string, values map[string]string) ([]Change, error) {
+	queues := strings.Split(value, ",")
+	for i, partition := range queues {
+		queues[i] = t.Queue(partition)
+	}
+	return set("q_hard", strings.Join(queues, ",")), nil
+}
+
+// slurmMailType converts --mail-type events into qsub -m options.
+func slurmMailType(t *Translator, value string, values map[string]string) ([]Change, error) {
+	events := ""
+	add := func(e string) {
+		if !strings.Contains(events, e) {
+			events += e
+		}
+	}
+	for _, event := range strings.Split(value, ",") {
+		switch strings.ToUpper(event) {
+		case "NONE":
+			return set("m", "n"), nil
+		case "BEGIN":
+			add("b")
+		case "END":
+			add("e")
+		case "FAIL", "REQUEUE", "INVALID_DEPEND":
+			add("a")
+		case "ALL":
+			add("b")
+			add("e")
+			add("a")
+		default:
+			return nil, fmt.Errorf("mail type %s is not supported", event)
+		}
+	}
+	return set("m", events), nil
+}
+
+// parseSlurmTime converts the Slurm time formats "minutes",
+// "minutes:seconds", "hours:minutes:seconds", "days-hours",
+// "days-hours:minutes", and "days-hours:minutes:seconds" into seconds.
+func parseSlurmTime(value string) (int64, error) {
+	if value == "infinite" || value == "UNLIMITED" {
+		return 0, fmt.Errorf("unlimited time limit")
+	}
+	days, rest, hasDays := strings.Cut(value, "-")
+	if !hasDays {
+		rest = value
+		if strings.Count(rest, ":") > 2 {
+			return 0, fmt.Errorf("invalid time limit %q", value)
+		}
+		// minutes, minutes:seconds, or hours:minutes:seconds
+		if strings.Count(rest, ":") == 0 {
+			return parseClock(rest, 60)
+		}
+		return parseClock(rest, 1)
+	}
+	d, err := strconv.ParseInt(days, 10, 64)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid time limit %q", value)
+	}
+	// days-hours[:minutes[:seconds]]
+	fields := strings.Split(rest, ":")
+	if len(fields) > 3 {
+		return 0, fmt.Errorf("invalid time limit %q", value)
+	}
+	for len(fields) < 3 {
+		fields = append(fields, "0")
+	}
+	seconds, err := parseClock(strings.Join(fields, ":"), 1)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time limit %q", value)
+	}
+	return d*86400 + seconds, nil
+}
@@ -0,0 +1,89 @@
+package translate_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/jsv/translate"
+)
+
+var _ = Describe("Slurm", func() {
+
+	script := `#!/bin/bash
+#SBATCH --time=1-02:30:00
+#SBATCH --ntasks=4 --cpus-per-task=2
+#SBATCH --mem=16G
+#SBATCH -J myjob -o out_%j_%a.log
+#SBATCH --gres=gpu:v100:2
+#SBATCH --array=1-10:2%3
+#SBATCH --partition=short
+#SBATCH --mail-type=END,FAIL --mail-user=alice@example.com
+#SBATCH --nodes=2
+srun ./a.out
+#SBATCH --time=5
+`
+
+	It("should translate the directives", func() {
+		slurm := translate.NewSlurm()
+		slurm.Queues["short"] = "short.q"
+		report, err := slurm.Translate(strings.NewReader(script))
+		Expect(err).ToNot(HaveOccurred())
+
+		changes := make(map[string]string)
+		var untranslatable []string
+		for _, m := range report.Mappings {
+			if m.Status == translate.Untranslatable {
+				untranslatable = append(untranslatable, m.Directive)
+			}
+			for _, c := range m.Changes {
+				changes[c.Param+" "+c.SubParam] = c.Value
+			}
+		}
+		Expect(changes).To(Equal(map[string]string{
+			"l_hard h_rt":   "95400",
+			"pe_name ":      "mpi",
+			"pe_min ":       "8",
+			"pe_max ":       "8",
+			"l_hard h_vmem": "2048M",
+			"N ":            "myjob",
+			"o ":            "out_$JOB_ID_$TASK_ID.log",
+			"l_hard gpu":    "2",
+			"t_min ":        "1",
+			"t_max ":        "10",
+			"t_step ":       "2",
+			"tc ":           "3",
+			"q_hard ":       "short.q",
+			"m ":            "ea",
+			"M ":            "alice@example.com",
+		}))
+		Expect(untranslatable).To(Equal([]string{"--nodes=2"}))
+		Expect(report.String()).To(ContainSubstring("line 2: #SBATCH --time=1-02:30:00 -> l_hard h_rt=95400 (pending)"))
+	})
+
+	It("should translate the Slurm time formats", func() {
+		for value, seconds := range map[string]string{
+			"30":        "1800",
+			"30:15":     "1815",
+			"1:00:00":   "3600",
+			"2-0":       "172800",
+			"1-1:1":     "90060",
+			"0-00:00:5": "5",
+		} {
+			report, err := translate.NewSlurm().Translate(strings.NewReader("#SBATCH -t " + value))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Mappings).To(HaveLen(1))
+			Expect(report.Mappings[0].Changes[0].Value).To(Equal(seconds), value)
+		}
+	})
+
+	It("should report invalid directives as untranslatable", func() {
+		report, err := translate.NewSlurm().Translate(strings.NewReader("#SBATCH --array=1,3,5 --time=abc"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Mappings).To(HaveLen(2))
+		for _, m := range report.Mappings {
+			Expect(m.Status).To(Equal(translate.Untranslatable))
+		}
+	})
+})
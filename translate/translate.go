@@ -0,0 +1,230 @@
+// Package translate translates the batch directives of other workload
+// managers, which are embedded in job scripts, into Grid Engine job
+// parameters.
+//
+// Users migrating from other systems submit scripts with directives
+// like "#SBATCH --time=1:00:00" which are ignored by Grid Engine. A
+// translator reads the job script of the currently processed job,
+// maps the directives to JSV parameters, and applies them with the
+// JSV setters unless the user requested them explicitly:
+//
+//	report, err := translate.NewSlurm().TranslateJob()
+//	if err == nil && report.Apply() {
+//		jsv.Correct("Translated #SBATCH directives")
+//		return
+//	}
+//
+// Translators for Slurm (#SBATCH), PBS/Torque (#PBS), and LSF (#BSUB)
+// are built on the same Dialect and Rule types. Sites can map queue
+// and parallel environment names with the Queues and
+// ParallelEnvironments tables of a Translator, and add or replace
+// rules of a dialect:
+//
+//	pbs := translate.NewPBS()
+//	pbs.Queues["batch"] = "all.q"
+//	pbs.ParallelEnvironments[translate.ParallelPE] = "openmpi"
+//	pbs.Dialect.Rules["W"] = func(t *translate.Translator, value string, values map[string]string) ([]translate.Change, error) {
+//		...
+//	}
+package translate
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgruber/jsv"
+)
+
+// Change is the modification of a single JSV parameter.
+type Change struct {
+	// Param is the JSV parameter, like "N" or "l_hard".
+	Param string
+	// SubParam is the sub-parameter of list parameters like "h_rt"
+	// for "l_hard". It is empty for simple parameters.
+	SubParam string
+	// Value is the new value.
+	Value string
+}
+
+func (c Change) String() string {
+	if c.SubParam != "" {
+		return c.Param + " " + c.SubParam + "=" + c.Value
+	}
+	return c.Param + "=" + c.Value
+}
+
+// Status is the state of a mapping.
+type Status int
+
+const (
+	// Pending mappings were not applied yet.
+	Pending Status = iota
+	// Applied mappings changed the job.
+	Applied
+	// Skipped mappings were not applied because the user requested
+	// the parameters explicitly.
+	Skipped
+	// Untranslatable directives have no Grid Engine equivalent.
+	Untranslatable
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Applied:
+		return "applied"
+	case Skipped:
+		return "skipped"
+	case Untranslatable:
+		return "untranslatable"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Mapping is the translation of a single directive.
+type Mapping struct {
+	// Line is the line number of the directive in the job script.
+	Line int
+	// Directive is the original directive, like "--time=1:00:00".
+	Directive string
+	// Changes are the parameter modifications of the directive.
+	// All changes of a mapping are applied or skipped together.
+	Changes []Change
+	// Status is the state of the mapping.
+	Status Status
+	// Reason explains why a mapping is skipped or untranslatable.
+	Reason string
+}
+
+// Report lists the mappings of all directives of a job script.
+type Report struct {
+	// Prefix is the directive prefix, like "#SBATCH".
+	Prefix string
+	// Script is the path of the translated job script.
+	Script string
+	// Mappings are the translations in order of the directives.
+	Mappings []Mapping
+}
+
+// Apply applies the changes of all pending mappings to the currently
+// processed job unless the parameters were requested explicitly.
+// Untranslatable directives are logged with jsv.LogWarning(). Apply
+// returns true when the job was modified; the verification function
+// should then finish with jsv.Correct().
+func (r *Report) Apply() bool {
+	// the parameters are checked against the job as it was submitted,
+	// not against the changes of earlier mappings
+	submitted := r.submitted()
+	modified := false
+	for i := range r.Mappings {
+		m := &r.Mappings[i]
+		switch m.Status {
+		case Untranslatable:
+			jsv.LogWarning(fmt.Sprintf("%s %s (line %d) can't be translated: %s",
+				r.Prefix, m.Directive, m.Line, m.Reason))
+			continue
+		case Pending:
+		default:
+			continue
+		}
+		if len(m.Changes) == 0 {
+			m.Status = Applied
+			continue
+		}
+		if param, set := explicitlySet(submitted, m.Changes); set {
+			m.Status = Skipped
+			m.Reason = param + " was requested explicitly"
+			continue
+		}
+		for _, c := range m.Changes {
+			if c.SubParam != "" {
+				jsv.SubAddParam(c.Param, c.SubParam, c.Value)
+			} else {
+				jsv.SetParam(c.Param, c.Value)
+			}
+		}
+		m.Status = Applied
+		modified = true
+	}
+	return modified
+}
+
+// booleanDefaults are the values qmaster sends for boolean options
+// which were not requested.
+var booleanDefaults = map[string]string{
+	"b": "n", "j": "n", "notify": "n", "R": "n", "shell": "y",
+}
+
+// submitted returns the parameters of the pending changes which are
+// set for the job, sub-parameters as "<param> <sub-parameter>". The
+// job name (N) is always sent by Grid Engine, it counts as set when
+// it differs from the script name. Boolean options count as set when
+// they differ from the value qmaster sends when they are not
+// requested.
+func (r *Report) submitted() map[string]bool {
+	submitted := make(map[string]bool)
+	for _, m := range r.Mappings {
+		if m.Status != Pending {
+			continue
+		}
+		for _, c := range m.Changes {
+			if c.SubParam != "" {
+				if jsv.SubIsParam(c.Param, c.SubParam) {
+					submitted[c.Param+" "+c.SubParam] = true
+				}
+				continue
+			}
+			value, exists := jsv.GetParam(c.Param)
+			if !exists {
+				continue
+			}
+			if c.Param == "N" && (value == "" || value == filepath.Base(r.Script)) {
+				continue
+			}
+			if d, isBoolean := booleanDefaults[c.Param]; isBoolean && value == d {
+				continue
+			}
+			submitted[c.Param] = true
+		}
+	}
+	return submitted
+}
+
+// explicitlySet returns the first parameter of the changes which was
+// set when the job was submitted.
+func explicitlySet(submitted map[string]bool, changes []Change) (string, bool) {
+	for _, c := range changes {
+		param := c.Param
+		if c.SubParam != "" {
+			param += " " + c.SubParam
+		}
+		if submitted[param] {
+			return param, true
+		}
+	}
+	return "", false
+}
+
+// String returns the report with one line per mapping.
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, m := range r.Mappings {
+		fmt.Fprintf(&b, "line %d: %s %s -> ", m.Line, r.Prefix, m.Directive)
+		if len(m.Changes) > 0 {
+			changes := make([]string, 0, len(m.Changes))
+			for _, c := range m.Changes {
+				changes = append(changes, c.String())
+			}
+			b.WriteString(strings.Join(changes, ", "))
+			b.WriteString(" ")
+		}
+		b.WriteString("(" + m.Status.String())
+		if m.Reason != "" {
+			b.WriteString(": " + m.Reason)
+		}
+		b.WriteString(")\n")
+	}
+	return b.String()
+}